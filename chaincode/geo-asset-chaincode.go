@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"fabric-geo-consensus/geodesy"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -475,21 +476,10 @@ func (s *GeoAssetContract) GetTransactionHistory(ctx contractapi.TransactionCont
 	return transactions, nil
 }
 
-// calculateDistance calculates the distance between two geographic points using Haversine formula
+// calculateDistance returns the WGS-84 ellipsoidal distance in kilometers
+// between two geographic points
 func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const earthRadius = 6371 // Earth's radius in kilometers
-
-	// Convert latitude and longitude from degrees to radians
-	lat1Rad := lat1 * 3.14159265359 / 180
-	lat2Rad := lat2 * 3.14159265359 / 180
-	deltaLat := (lat2 - lat1) * 3.14159265359 / 180
-	deltaLon := (lon2 - lon1) * 3.14159265359 / 180
-
-	a := 0.5 - (1-((1+deltaLat)/2))/2 + (1-((1+lat1Rad)/2))*(1-((1+lat2Rad)/2))*(1-((1+deltaLon)/2))/2
-
-	// Calculate the distance
-	c := 2 * (0.5 - a + (a * (1 - a)))
-	return earthRadius * c
+	return geodesy.Distance(geodesy.Point{Lat: lat1, Lon: lon1}, geodesy.Point{Lat: lat2, Lon: lon2})
 }
 
 func main() {
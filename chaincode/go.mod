@@ -2,7 +2,10 @@ module geo-asset-chaincode
 
 go 1.24.5
 
-require github.com/hyperledger/fabric-contract-api-go v1.2.2
+require (
+	fabric-geo-consensus/geodesy v0.0.0
+	github.com/hyperledger/fabric-contract-api-go v1.2.2
+)
 
 require (
 	github.com/go-openapi/jsonpointer v0.20.0 // indirect
@@ -31,3 +34,5 @@ require (
 	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace fabric-geo-consensus/geodesy => ../geodesy
@@ -0,0 +1,780 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const auditHistorySize = 1000
+
+// AuditRecord describes a single call to the admin API
+type AuditRecord struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Principal string                 `json:"principal"`
+	Action    string                 `json:"action"`
+	Channel   string                 `json:"channel,omitempty"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	DryRun    bool                   `json:"dry_run"`
+	Outcome   string                 `json:"outcome"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// Audit outcomes
+const (
+	AuditOutcomeApplied  = "applied"
+	AuditOutcomeDryRun   = "dry-run"
+	AuditOutcomeRejected = "rejected"
+)
+
+// auditLog keeps recent admin API records in memory and, if configured,
+// appends them as JSON lines to a file
+type auditLog struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	file    *os.File
+}
+
+// newAuditLog creates an audit log, opening path for appending if set
+func newAuditLog(path string) (*auditLog, error) {
+	log := &auditLog{}
+	if path == "" {
+		return log, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return log, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	log.file = file
+	return log, nil
+}
+
+// record stores an audit record
+func (a *auditLog) record(record AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.records = append(a.records, record)
+	if len(a.records) > auditHistorySize {
+		a.records = a.records[len(a.records)-auditHistorySize:]
+	}
+
+	consenterLogger.Infof("Admin API audit: principal=%s action=%s channel=%s dry_run=%v outcome=%s %s",
+		record.Principal, record.Action, record.Channel, record.DryRun, record.Outcome, record.Error)
+
+	if a.file != nil {
+		line, err := json.Marshal(record)
+		if err == nil {
+			_, err = a.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			consenterLogger.Errorf("Failed to persist audit record: %v", err)
+		}
+	}
+}
+
+// list returns a copy of the retained audit records
+func (a *auditLog) list() []AuditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return append([]AuditRecord(nil), a.records...)
+}
+
+// close releases the audit log file
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// adminRequest is the body accepted by the admin endpoints
+type adminRequest struct {
+	Channel  string       `json:"channel"`
+	NodeID   uint64       `json:"node_id"`
+	Location *GeoLocation `json:"location,omitempty"`
+	Blocked  *bool        `json:"blocked,omitempty"`
+
+	// Config is the raw config patch, kept for the audit record
+	Config json.RawMessage `json:"-"`
+}
+
+// adminError is an admin API failure with its HTTP status
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &adminError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &adminError{status: http.StatusNotFound, message: fmt.Sprintf(format, args...)}
+}
+
+func conflict(format string, args ...interface{}) error {
+	return &adminError{status: http.StatusConflict, message: fmt.Sprintf(format, args...)}
+}
+
+// adminAction executes (or with dryRun only plans) an admin operation and
+// returns a description of its effect
+type adminAction func(req *adminRequest, dryRun bool) (map[string]interface{}, error)
+
+// registerAdminHandlers adds the admin endpoints to the mux
+func (gc *GeoConsenter) registerAdminHandlers(mux *http.ServeMux) {
+	mux.Handle("/admin/nodes", gc.authorize(RoleAdmin, http.HandlerFunc(gc.handleAdminNodes)))
+	mux.Handle("/admin/nodes/drain", gc.authorize(RoleAdmin, http.HandlerFunc(gc.handleAdminDrain)))
+	mux.Handle("/admin/leadership/transfer", gc.authorize(RoleAdmin, gc.adminHandler("transfer_leadership", http.MethodPost, gc.adminTransferLeadership)))
+	mux.Handle("/admin/leadership/block", gc.authorize(RoleAdmin, gc.adminHandler("block_leadership", http.MethodPost, gc.adminBlockLeadership)))
+	mux.Handle("/admin/config", gc.authorize(RoleAdmin, http.HandlerFunc(gc.handleAdminConfig)))
+	mux.Handle("/admin/audit", gc.authorize(RoleAdmin, http.HandlerFunc(gc.handleAdminAudit)))
+}
+
+// handleAdminNodes dispatches node registration, update and removal
+func (gc *GeoConsenter) handleAdminNodes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		gc.adminHandler("register_node", http.MethodPost, gc.adminRegisterNode).ServeHTTP(w, r)
+	case http.MethodPut:
+		gc.adminHandler("update_node", http.MethodPut, gc.adminUpdateNode).ServeHTTP(w, r)
+	case http.MethodDelete:
+		gc.adminHandler("remove_node", http.MethodDelete, gc.adminRemoveNode).ServeHTTP(w, r)
+	default:
+		w.Header().Set("Allow", "POST, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminHandler decodes the request, runs the action and audits the call.
+// Requests are dry runs when ?dry_run=true is given.
+func (gc *GeoConsenter) adminHandler(name, method string, action adminAction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+		req := &adminRequest{Channel: r.URL.Query().Get("channel")}
+		if nodeID := r.URL.Query().Get("node_id"); nodeID != "" {
+			parsed, err := strconv.ParseUint(nodeID, 10, 64)
+			if err != nil {
+				gc.writeAdminResult(w, r, name, req, dryRun, nil, badRequest("invalid node_id %q", nodeID))
+				return
+			}
+			req.NodeID = parsed
+		}
+		if r.Body != nil && r.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(req); err != nil {
+				gc.writeAdminResult(w, r, name, req, dryRun, nil, badRequest("invalid request body: %v", err))
+				return
+			}
+		}
+
+		result, err := action(req, dryRun)
+		gc.writeAdminResult(w, r, name, req, dryRun, result, err)
+	})
+}
+
+// writeAdminResult audits an admin call and writes its JSON response
+func (gc *GeoConsenter) writeAdminResult(w http.ResponseWriter, r *http.Request, action string, req *adminRequest, dryRun bool, result map[string]interface{}, err error) {
+	record := AuditRecord{
+		Timestamp: time.Now(),
+		Principal: principalFromContext(r.Context()).Name,
+		Action:    action,
+		Channel:   req.Channel,
+		Params:    auditParams(req),
+		DryRun:    dryRun,
+		Outcome:   AuditOutcomeApplied,
+	}
+	if dryRun {
+		record.Outcome = AuditOutcomeDryRun
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		record.Outcome = AuditOutcomeRejected
+		record.Error = err.Error()
+		status = http.StatusInternalServerError
+		if adminErr, ok := err.(*adminError); ok {
+			status = adminErr.status
+		}
+	}
+	gc.audit.record(record)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	response := map[string]interface{}{
+		"timestamp": record.Timestamp,
+		"action":    action,
+		"dry_run":   dryRun,
+		"outcome":   record.Outcome,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	} else {
+		response["result"] = result
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// auditParams extracts the request parameters recorded in the audit log
+func auditParams(req *adminRequest) map[string]interface{} {
+	params := map[string]interface{}{}
+	if req.NodeID != 0 {
+		params["node_id"] = req.NodeID
+	}
+	if req.Location != nil {
+		params["location"] = *req.Location
+	}
+	if req.Blocked != nil {
+		params["blocked"] = *req.Blocked
+	}
+	if len(req.Config) > 0 {
+		params["config"] = req.Config
+	}
+	return params
+}
+
+// targetChains returns the chains an admin request applies to: the named
+// channel, or every chain when no channel is given
+func (gc *GeoConsenter) targetChains(channel string) (map[string]*GeoEtcdRaft, error) {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+
+	if channel != "" {
+		chain, exists := gc.chains[channel]
+		if !exists {
+			return nil, notFound("chain %s not found", channel)
+		}
+		return map[string]*GeoEtcdRaft{channel: chain}, nil
+	}
+
+	chains := make(map[string]*GeoEtcdRaft, len(gc.chains))
+	for chainID, chain := range gc.chains {
+		chains[chainID] = chain
+	}
+	return chains, nil
+}
+
+// sortedChainIDs returns chain IDs in a stable order
+func sortedChainIDs(chains map[string]*GeoEtcdRaft) []string {
+	ids := make([]string, 0, len(chains))
+	for chainID := range chains {
+		ids = append(ids, chainID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// hasNode reports whether the node is registered on the chain
+func (g *GeoEtcdRaft) hasNode(nodeID uint64) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.nodes[nodeID] != nil
+}
+
+// adminRegisterNode registers a node with a location on the target chains
+func (gc *GeoConsenter) adminRegisterNode(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 || req.Location == nil {
+		return nil, badRequest("node_id and location are required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, chainID := range sortedChainIDs(chains) {
+		if chains[chainID].hasNode(req.NodeID) {
+			return nil, conflict("node %d is already registered on chain %s, use PUT to update it", req.NodeID, chainID)
+		}
+		changes[chainID] = "register"
+	}
+
+	if !dryRun {
+		for _, chainID := range sortedChainIDs(chains) {
+			if err := chains[chainID].RegisterNode(req.NodeID, *req.Location); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "chains": changes}, nil
+}
+
+// adminUpdateNode changes the location of a node on the target chains
+func (gc *GeoConsenter) adminUpdateNode(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 || req.Location == nil {
+		return nil, badRequest("node_id and location are required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, chainID := range sortedChainIDs(chains) {
+		if chains[chainID].hasNode(req.NodeID) {
+			changes[chainID] = "update"
+		}
+	}
+	if len(changes) == 0 {
+		return nil, notFound("node %d is not registered", req.NodeID)
+	}
+
+	if !dryRun {
+		for chainID := range changes {
+			if err := chains[chainID].UpdateNodeLocation(req.NodeID, *req.Location); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "chains": changes}, nil
+}
+
+// adminRemoveNode removes a node from the target chains
+func (gc *GeoConsenter) adminRemoveNode(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 {
+		return nil, badRequest("node_id is required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, chainID := range sortedChainIDs(chains) {
+		if !chains[chainID].hasNode(req.NodeID) {
+			continue
+		}
+		changes[chainID] = map[string]interface{}{
+			"was_leader": chains[chainID].currentLeader() == req.NodeID,
+		}
+	}
+	if len(changes) == 0 {
+		return nil, notFound("node %d is not registered", req.NodeID)
+	}
+
+	if !dryRun {
+		for chainID := range changes {
+			if err := chains[chainID].RemoveNode(req.NodeID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "chains": changes}, nil
+}
+
+// adminTransferLeadership moves leadership to the requested node
+func (gc *GeoConsenter) adminTransferLeadership(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.Channel == "" || req.NodeID == 0 {
+		return nil, badRequest("channel and node_id are required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+	chain := chains[req.Channel]
+
+	chain.mu.RLock()
+	node := chain.nodes[req.NodeID]
+	var blocked, draining bool
+	var score float64
+	if node != nil {
+		blocked = node.LeadershipBlocked
+		draining = node.Draining
+		score = chain.calculateLeaderScore(req.NodeID)
+	}
+	chain.mu.RUnlock()
+
+	if node == nil {
+		return nil, notFound("node %d is not registered on chain %s", req.NodeID, req.Channel)
+	}
+	if blocked {
+		return nil, conflict("node %d is blocked from leadership", req.NodeID)
+	}
+	if draining {
+		return nil, conflict("node %d is draining", req.NodeID)
+	}
+
+	result := map[string]interface{}{
+		"previous_leader":  chain.currentLeader(),
+		"new_leader":       req.NodeID,
+		"new_leader_score": score,
+	}
+
+	if !dryRun {
+		if err := chain.TransferLeadership(req.NodeID, "admin transfer"); err != nil {
+			return nil, conflict("%v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// adminBlockLeadership blocks or unblocks a node from leader candidacy
+func (gc *GeoConsenter) adminBlockLeadership(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 || req.Blocked == nil {
+		return nil, badRequest("node_id and blocked are required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, chainID := range sortedChainIDs(chains) {
+		if chains[chainID].hasNode(req.NodeID) {
+			changes[chainID] = map[string]interface{}{
+				"blocked":   *req.Blocked,
+				"is_leader": chains[chainID].currentLeader() == req.NodeID,
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, notFound("node %d is not registered", req.NodeID)
+	}
+
+	if !dryRun {
+		for chainID := range changes {
+			if err := chains[chainID].SetLeadershipBlocked(req.NodeID, *req.Blocked); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "chains": changes}, nil
+}
+
+// handleAdminDrain dispatches draining and undraining a node
+func (gc *GeoConsenter) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		gc.adminHandler("drain_node", http.MethodPost, gc.adminDrainNode).ServeHTTP(w, r)
+	case http.MethodDelete:
+		gc.adminHandler("undrain_node", http.MethodDelete, gc.adminUndrainNode).ServeHTTP(w, r)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminDrainNode marks a node as draining on every chain it belongs to and
+// moves the geo layer's leadership to proximity-ranked successors. Nothing
+// is drained unless every chain the node leads has an eligible successor.
+func (gc *GeoConsenter) adminDrainNode(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 {
+		return nil, badRequest("node_id is required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+	member := make(map[string]*GeoEtcdRaft)
+	for chainID, chain := range chains {
+		if chain.hasNode(req.NodeID) {
+			member[chainID] = chain
+		}
+	}
+	if len(member) == 0 {
+		return nil, notFound("node %d is not registered", req.NodeID)
+	}
+
+	// Every chain the node leads needs a successor before any is drained
+	predicted := make(map[string]uint64)
+	for _, chainID := range sortedChainIDs(member) {
+		if member[chainID].currentLeader() == req.NodeID {
+			successor := member[chainID].predictSuccessor(req.NodeID)
+			if successor == 0 {
+				return nil, conflict("chain %s: no eligible successor for node %d", chainID, req.NodeID)
+			}
+			predicted[chainID] = successor
+		}
+	}
+
+	changes := map[string]interface{}{}
+	var drained []string
+	for _, chainID := range sortedChainIDs(member) {
+		chain := member[chainID]
+
+		change := map[string]interface{}{"leader": chain.currentLeader()}
+		if dryRun {
+			if successor, leads := predicted[chainID]; leads {
+				change["successor"] = successor
+			}
+		} else {
+			wasDraining := chain.isDraining(req.NodeID)
+			leaderID, successors, err := chain.DrainNode(req.NodeID)
+			if err != nil {
+				// Leadership changed since the check: undo this request's drains
+				for _, drainedID := range drained {
+					member[drainedID].UndrainNode(req.NodeID)
+				}
+				return nil, conflict("chain %s: %v", chainID, err)
+			}
+			if !wasDraining {
+				drained = append(drained, chainID)
+			}
+			change["leader"] = leaderID
+			if len(successors) > 0 {
+				change["successors"] = successors
+			}
+		}
+		changes[chainID] = change
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "draining": true, "chains": changes}, nil
+}
+
+// adminUndrainNode makes a drained node eligible for leadership again on
+// every chain it belongs to
+func (gc *GeoConsenter) adminUndrainNode(req *adminRequest, dryRun bool) (map[string]interface{}, error) {
+	if req.NodeID == 0 {
+		return nil, badRequest("node_id is required")
+	}
+
+	chains, err := gc.targetChains(req.Channel)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{}
+	for _, chainID := range sortedChainIDs(chains) {
+		if chains[chainID].hasNode(req.NodeID) {
+			changes[chainID] = map[string]interface{}{
+				"was_draining": chains[chainID].isDraining(req.NodeID),
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return nil, notFound("node %d is not registered", req.NodeID)
+	}
+
+	if !dryRun {
+		for chainID := range changes {
+			if err := chains[chainID].UndrainNode(req.NodeID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return map[string]interface{}{"node_id": req.NodeID, "draining": false, "chains": changes}, nil
+}
+
+// handleAdminConfig returns (GET) or partially updates (PUT) the GeoConfig.
+// API and tracing settings can only be changed through the orderer
+// configuration and are ignored here. With a channel query parameter it
+// works on that channel's override instead, and DELETE removes it.
+func (gc *GeoConsenter) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if channel := r.URL.Query().Get("channel"); channel != "" {
+		gc.handleAdminChannelConfig(w, r, channel)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gc.currentConfig())
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	req := &adminRequest{}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		gc.writeAdminResult(w, r, "update_config", req, dryRun, nil, badRequest("invalid config: %v", err))
+		return
+	}
+	if json.Valid(body) {
+		req.Config = body
+	}
+
+	// Decode over a copy: the decoder writes into existing slices, which
+	// the current config shares with the chains
+	current := gc.currentConfig()
+	updated := current.Clone()
+	updated.Channels = nil
+	if err := json.Unmarshal(body, updated); err != nil {
+		gc.writeAdminResult(w, r, "update_config", req, dryRun, nil, badRequest("invalid config: %v", err))
+		return
+	}
+	updated.API = current.API
+	updated.Tracing = current.Tracing
+	updated.ElectionLogFile = current.ElectionLogFile
+	updated.Channels = current.Channels
+	if err := updated.Validate(); err != nil {
+		gc.writeAdminResult(w, r, "update_config", req, dryRun, nil, badRequest("%v", err))
+		return
+	}
+
+	result := map[string]interface{}{
+		"previous": current,
+		"current":  updated,
+	}
+
+	if !dryRun {
+		gc.setConfig(updated)
+	}
+
+	gc.writeAdminResult(w, r, "update_config", req, dryRun, result, nil)
+}
+
+// handleAdminChannelConfig returns (GET), merges settings into (PUT) or
+// removes (DELETE) a channel's config override
+func (gc *GeoConsenter) handleAdminChannelConfig(w http.ResponseWriter, r *http.Request, channel string) {
+	current := gc.currentConfig()
+
+	if r.Method == http.MethodGet {
+		effective, err := current.ForChannel(channel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"channel":   channel,
+			"override":  current.Channels[channel],
+			"effective": effective,
+			"timestamp": time.Now(),
+		})
+		return
+	}
+
+	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	req := &adminRequest{Channel: channel}
+	action := "update_channel_config"
+
+	var override json.RawMessage
+	if r.Method == http.MethodDelete {
+		action = "reset_channel_config"
+	} else {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			gc.writeAdminResult(w, r, action, req, dryRun, nil, badRequest("invalid config: %v", err))
+			return
+		}
+		if json.Valid(body) {
+			req.Config = body
+		}
+		if override, err = mergeConfigOverride(current.Channels[channel], body); err != nil {
+			gc.writeAdminResult(w, r, action, req, dryRun, nil, badRequest("invalid config: %v", err))
+			return
+		}
+	}
+
+	updated := *current
+	updated.Channels = make(map[string]json.RawMessage, len(current.Channels)+1)
+	for id, existing := range current.Channels {
+		updated.Channels[id] = existing
+	}
+	if override != nil {
+		updated.Channels[channel] = override
+	} else {
+		delete(updated.Channels, channel)
+	}
+
+	if err := updated.Validate(); err != nil {
+		gc.writeAdminResult(w, r, action, req, dryRun, nil, badRequest("%v", err))
+		return
+	}
+	previous, _ := current.ForChannel(channel)
+	effective, _ := updated.ForChannel(channel)
+
+	result := map[string]interface{}{
+		"override": override,
+		"previous": previous,
+		"current":  effective,
+	}
+
+	if !dryRun {
+		gc.setConfig(&updated)
+	}
+
+	gc.writeAdminResult(w, r, action, req, dryRun, result, nil)
+}
+
+// handleAdminAudit serves the retained admin audit records
+func (gc *GeoConsenter) handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"timestamp": time.Now(),
+		"records":   gc.audit.list(),
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// currentConfig returns the consenter-wide GeoConfig
+func (gc *GeoConsenter) currentConfig() *GeoConfig {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+
+	return gc.config
+}
+
+// setConfig replaces the consenter-wide GeoConfig and applies each chain's
+// effective config to the chains it changes
+func (gc *GeoConsenter) setConfig(config *GeoConfig) {
+	gc.mu.Lock()
+	gc.config = config
+	chains := make(map[string]*GeoEtcdRaft, len(gc.chains))
+	for chainID, chain := range gc.chains {
+		chains[chainID] = chain
+	}
+	gc.mu.Unlock()
+
+	for chainID, chain := range chains {
+		effective, err := config.ForChannel(chainID)
+		if err != nil {
+			consenterLogger.Errorf("Config of channel %s not updated: %v", chainID, err)
+			continue
+		}
+		if !reflect.DeepEqual(effective, chain.Config()) {
+			chain.UpdateConfig(effective)
+		}
+	}
+}
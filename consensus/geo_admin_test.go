@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// putAdminConfig sends a config update to the admin API
+func putAdminConfig(gc *GeoConsenter, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/admin/config"+query, strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	gc.handleAdminConfig(recorder, req)
+	return recorder
+}
+
+func TestAdminConfigLeavesCurrentConfigUntouched(t *testing.T) {
+	config := NewGeoConfig()
+	config.TopologyLabels = []TopologyLabel{{Name: "zone", Affinity: 1}}
+	config.Cost.Prices = []RegionPairPrice{{Regions: [2]string{"us-east", "eu-west"}, PricePerGB: 0.02}}
+	config.API.Tokens = []APIToken{{Name: "prometheus", SHA256: strings.Repeat("a", 64), Role: "reader"}}
+	gc, err := NewGeoConsenter(config)
+	require.NoError(t, err)
+	defer gc.Halt()
+
+	// A dry run, a rejected update and the ignored api settings must not
+	// write into the slices of the live config
+	recorder := putAdminConfig(gc, "?dry_run=true", `{"topology_labels":[{"name":"rack","affinity":2}]}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	recorder = putAdminConfig(gc, "", `{"cost":{"prices":[{"regions":["us-east","eu-west"],"price_per_gb":-1}]}}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	recorder = putAdminConfig(gc, "?dry_run=true", `{"api":{"tokens":[{"name":"intruder","sha256":"`+strings.Repeat("b", 64)+`","role":"admin"}]}}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+
+	current := gc.currentConfig()
+	require.Equal(t, []TopologyLabel{{Name: "zone", Affinity: 1}}, current.TopologyLabels)
+	require.Equal(t, 0.02, current.Cost.Prices[0].PricePerGB)
+	require.Equal(t, "prometheus", current.API.Tokens[0].Name)
+
+	recorder = putAdminConfig(gc, "", `{"topology_labels":[{"name":"rack","affinity":2}]}`)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Equal(t, []TopologyLabel{{Name: "rack", Affinity: 2}}, gc.currentConfig().TopologyLabels)
+	require.Equal(t, []TopologyLabel{{Name: "zone", Affinity: 1}}, current.TopologyLabels)
+}
+
+func TestForChannelDoesNotShareSlices(t *testing.T) {
+	config := NewGeoConfig()
+	config.TopologyLabels = []TopologyLabel{{Name: "zone", Affinity: 1}}
+	config.Channels = map[string]json.RawMessage{
+		"ch1": json.RawMessage(`{"topology_labels":[{"name":"rack","affinity":3}]}`),
+	}
+
+	effective, err := config.ForChannel("ch1")
+	require.NoError(t, err)
+	require.Equal(t, "rack", effective.TopologyLabels[0].Name)
+	require.Equal(t, "zone", config.TopologyLabels[0].Name)
+
+	require.NoError(t, config.Validate())
+	require.Equal(t, "zone", config.TopologyLabels[0].Name)
+}
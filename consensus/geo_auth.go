@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// APIRole is the access level granted to an HTTP API caller
+type APIRole int
+
+const (
+	// RoleNone grants no access beyond the health check
+	RoleNone APIRole = iota
+	// RoleReader grants access to metrics, topology and chain views
+	RoleReader
+	// RoleAdmin additionally grants access to endpoints that change state
+	RoleAdmin
+)
+
+// String returns the configuration name of the role
+func (r APIRole) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// parseAPIRole converts a configured role name into an APIRole
+func parseAPIRole(name string) (APIRole, error) {
+	switch strings.ToLower(name) {
+	case "reader", "read-only", "readonly":
+		return RoleReader, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown API role %q", name)
+	}
+}
+
+// DefaultAPIListenAddress is used when APIConfig.ListenAddress is empty
+const DefaultAPIListenAddress = ":8080"
+
+// APIConfig controls the listen address, transport security and
+// authorization of the HTTP API
+type APIConfig struct {
+	ListenAddress    string       `json:"listen_address"`
+	TLS              APITLSConfig `json:"tls"`
+	AllowedOrigins   []string     `json:"allowed_origins"`
+	AnonymousAccess  bool         `json:"anonymous_access"`
+	AdminOUs         []string     `json:"admin_ous"`
+	AdminCommonNames []string     `json:"admin_common_names"`
+	ReaderOUs        []string     `json:"reader_ous"`
+	Tokens           []APIToken   `json:"tokens"`
+	AuditLogFile     string       `json:"audit_log_file"`
+}
+
+// APITLSConfig holds the server certificate and client verification
+// settings. ClientCAFiles and the CA folders of MSPDir are used to verify
+// client certificates.
+type APITLSConfig struct {
+	Enabled            bool     `json:"enabled"`
+	CertFile           string   `json:"cert_file"`
+	KeyFile            string   `json:"key_file"`
+	ClientAuthRequired bool     `json:"client_auth_required"`
+	ClientCAFiles      []string `json:"client_ca_files"`
+	MSPDir             string   `json:"msp_dir"`
+}
+
+// APIToken maps a bearer token to a role. Only the SHA-256 digest of the
+// token is kept in configuration.
+type APIToken struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+	Role   string `json:"role"`
+}
+
+// apiPrincipal identifies an authenticated API caller
+type apiPrincipal struct {
+	Name string
+	Role APIRole
+}
+
+type principalContextKey struct{}
+
+// principalFromContext returns the caller resolved by the auth middleware
+func principalFromContext(ctx context.Context) apiPrincipal {
+	principal, _ := ctx.Value(principalContextKey{}).(apiPrincipal)
+	return principal
+}
+
+// mspCAFolders are the MSP folders whose certificates may issue API clients
+var mspCAFolders = []string{"cacerts", "intermediatecerts", "tlscacerts", "tlsintermediatecerts"}
+
+// buildTLSConfig creates the server TLS configuration for the HTTP API. It
+// returns nil when TLS is disabled.
+func buildTLSConfig(cfg APITLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API server certificate: %v", err)
+	}
+
+	caFiles := append([]string{}, cfg.ClientCAFiles...)
+	if cfg.MSPDir != "" {
+		for _, folder := range mspCAFolders {
+			matches, err := filepath.Glob(filepath.Join(cfg.MSPDir, folder, "*.pem"))
+			if err != nil {
+				return nil, err
+			}
+			caFiles = append(caFiles, matches...)
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+		ClientAuth:   tls.NoClientCert,
+	}
+
+	if len(caFiles) > 0 {
+		pool := x509.NewCertPool()
+		for _, file := range caFiles {
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read client CA %s: %v", file, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in client CA %s", file)
+			}
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if cfg.ClientAuthRequired {
+		if tlsConfig.ClientCAs == nil {
+			return nil, fmt.Errorf("client authentication requires client_ca_files or msp_dir")
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// resolvePrincipal determines the caller and role from the verified client
+// certificate or bearer token of the request
+func (cfg *APIConfig) resolvePrincipal(r *http.Request) apiPrincipal {
+	principal := apiPrincipal{Name: "anonymous", Role: RoleNone}
+	if cfg.AnonymousAccess {
+		principal.Role = RoleReader
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if certPrincipal := cfg.certificatePrincipal(r.TLS.VerifiedChains[0][0]); certPrincipal.Role > principal.Role {
+			principal = certPrincipal
+		}
+	}
+
+	if token := bearerToken(r); token != "" {
+		if tokenPrincipal := cfg.tokenPrincipal(token); tokenPrincipal.Role > principal.Role {
+			principal = tokenPrincipal
+		}
+	}
+
+	return principal
+}
+
+// certificatePrincipal maps a verified client certificate to a role
+func (cfg *APIConfig) certificatePrincipal(cert *x509.Certificate) apiPrincipal {
+	principal := apiPrincipal{Name: cert.Subject.CommonName, Role: RoleNone}
+
+	if containsFold(cfg.AdminCommonNames, cert.Subject.CommonName) {
+		principal.Role = RoleAdmin
+		return principal
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if containsFold(cfg.AdminOUs, ou) {
+			principal.Role = RoleAdmin
+			return principal
+		}
+	}
+
+	if len(cfg.ReaderOUs) == 0 {
+		principal.Role = RoleReader
+		return principal
+	}
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		if containsFold(cfg.ReaderOUs, ou) {
+			principal.Role = RoleReader
+			return principal
+		}
+	}
+
+	return principal
+}
+
+// tokenPrincipal maps a bearer token to a role
+func (cfg *APIConfig) tokenPrincipal(token string) apiPrincipal {
+	digest := sha256.Sum256([]byte(token))
+	presented := hex.EncodeToString(digest[:])
+
+	for _, configured := range cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(strings.ToLower(configured.SHA256))) != 1 {
+			continue
+		}
+		role, err := parseAPIRole(configured.Role)
+		if err != nil {
+			consenterLogger.Warnf("Ignoring API token %s: %v", configured.Name, err)
+			return apiPrincipal{Role: RoleNone}
+		}
+		return apiPrincipal{Name: "token:" + configured.Name, Role: role}
+	}
+
+	return apiPrincipal{Role: RoleNone}
+}
+
+// bearerToken extracts the token from an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return strings.TrimSpace(header[len(prefix):])
+	}
+	return ""
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyCORS sets CORS headers for configured origins. It reports whether
+// the request was a preflight that has been fully answered.
+func (cfg *APIConfig) applyCORS(w http.ResponseWriter, r *http.Request) bool {
+	// With origins configured every response depends on the Origin header,
+	// including those that do not match, so caches must key on it
+	if len(cfg.AllowedOrigins) > 0 {
+		w.Header().Add("Vary", "Origin")
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		for _, allowed := range cfg.AllowedOrigins {
+			if allowed == "*" || allowed == origin {
+				w.Header().Set("Access-Control-Allow-Origin", allowed)
+				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID")
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				break
+			}
+		}
+	}
+
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+	return false
+}
+
+// authorize wraps a handler so that it only runs for callers holding at
+// least the required role
+func (gc *GeoConsenter) authorize(required APIRole, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiConfig := &gc.currentConfig().API
+
+		if apiConfig.applyCORS(w, r) {
+			return
+		}
+
+		principal := apiConfig.resolvePrincipal(r)
+		if principal.Role < required {
+			if principal.Role == RoleNone {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="geo-consenter"`)
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Role %s required", required), http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey{}, principal)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tokenDigest returns the configured form of a bearer token
+func tokenDigest(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
+
+// authRequest builds a request presenting a verified client certificate
+// and a bearer token, either of which may be omitted
+func authRequest(cert *x509.Certificate, token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/chains", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// clientCert returns a certificate with the given subject
+func clientCert(commonName string, units ...string) *x509.Certificate {
+	return &x509.Certificate{Subject: pkix.Name{CommonName: commonName, OrganizationalUnit: units}}
+}
+
+func TestResolvePrincipal(t *testing.T) {
+	config := APIConfig{
+		AdminCommonNames: []string{"ops-admin"},
+		AdminOUs:         []string{"orderer-admins"},
+		ReaderOUs:        []string{"monitoring"},
+		Tokens: []APIToken{
+			{Name: "prometheus", SHA256: tokenDigest("scrape-secret"), Role: "reader"},
+			{Name: "operator", SHA256: strings.ToUpper(tokenDigest("operate-secret")), Role: "admin"},
+			{Name: "broken", SHA256: tokenDigest("broken-secret"), Role: "superuser"},
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		anonymous bool
+		readerOUs []string
+		cert      *x509.Certificate
+		token     string
+		principal apiPrincipal
+	}{
+		{name: "no credentials", principal: apiPrincipal{Name: "anonymous", Role: RoleNone}},
+		{name: "anonymous access", anonymous: true, principal: apiPrincipal{Name: "anonymous", Role: RoleReader}},
+		{name: "reader token", token: "scrape-secret", principal: apiPrincipal{Name: "token:prometheus", Role: RoleReader}},
+		{name: "admin token with upper case digest", token: "operate-secret", principal: apiPrincipal{Name: "token:operator", Role: RoleAdmin}},
+		{name: "unknown token", token: "guessed-secret", principal: apiPrincipal{Name: "anonymous", Role: RoleNone}},
+		{name: "token digest instead of token", token: tokenDigest("scrape-secret"), principal: apiPrincipal{Name: "anonymous", Role: RoleNone}},
+		{name: "token with unknown role", token: "broken-secret", principal: apiPrincipal{Name: "anonymous", Role: RoleNone}},
+		{name: "unknown token with anonymous access", anonymous: true, token: "guessed-secret", principal: apiPrincipal{Name: "anonymous", Role: RoleReader}},
+		{name: "admin common name", cert: clientCert("ops-admin", "monitoring"), principal: apiPrincipal{Name: "ops-admin", Role: RoleAdmin}},
+		{name: "admin common name ignores case", cert: clientCert("OPS-Admin"), principal: apiPrincipal{Name: "OPS-Admin", Role: RoleAdmin}},
+		{name: "admin unit", cert: clientCert("alice", "orderer-admins"), principal: apiPrincipal{Name: "alice", Role: RoleAdmin}},
+		{name: "reader unit", cert: clientCert("grafana", "monitoring"), principal: apiPrincipal{Name: "grafana", Role: RoleReader}},
+		{name: "reader common name is not an admin", cert: clientCert("ops-reader", "monitoring"), principal: apiPrincipal{Name: "ops-reader", Role: RoleReader}},
+		{name: "other unit", cert: clientCert("mallory", "peers"), principal: apiPrincipal{Name: "anonymous", Role: RoleNone}},
+		{name: "any certificate without reader units", readerOUs: []string{}, cert: clientCert("mallory", "peers"), principal: apiPrincipal{Name: "mallory", Role: RoleReader}},
+		{name: "token raises certificate role", cert: clientCert("grafana", "monitoring"), token: "operate-secret", principal: apiPrincipal{Name: "token:operator", Role: RoleAdmin}},
+		{name: "reader token does not lower admin certificate", cert: clientCert("ops-admin"), token: "scrape-secret", principal: apiPrincipal{Name: "ops-admin", Role: RoleAdmin}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := config
+			config.AnonymousAccess = tc.anonymous
+			if tc.readerOUs != nil {
+				config.ReaderOUs = tc.readerOUs
+			}
+			require.Equal(t, tc.principal, config.resolvePrincipal(authRequest(tc.cert, tc.token)))
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	config := NewGeoConfig()
+	config.API.Tokens = []APIToken{
+		{Name: "prometheus", SHA256: tokenDigest("scrape-secret"), Role: "reader"},
+		{Name: "operator", SHA256: tokenDigest("operate-secret"), Role: "admin"},
+	}
+	gc, err := NewGeoConsenter(config)
+	require.NoError(t, err)
+	defer gc.Halt()
+
+	var served apiPrincipal
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = principalFromContext(r.Context())
+	})
+
+	for _, tc := range []struct {
+		name      string
+		anonymous bool
+		required  APIRole
+		token     string
+		status    int
+	}{
+		{name: "health check without credentials", required: RoleNone, status: http.StatusOK},
+		{name: "reader view without credentials", required: RoleReader, status: http.StatusUnauthorized},
+		{name: "reader view with anonymous access", anonymous: true, required: RoleReader, status: http.StatusOK},
+		{name: "admin endpoint with anonymous access", anonymous: true, required: RoleAdmin, status: http.StatusForbidden},
+		{name: "reader view with reader token", required: RoleReader, token: "scrape-secret", status: http.StatusOK},
+		{name: "admin endpoint with reader token", required: RoleAdmin, token: "scrape-secret", status: http.StatusForbidden},
+		{name: "admin endpoint with admin token", required: RoleAdmin, token: "operate-secret", status: http.StatusOK},
+		{name: "admin endpoint with unknown token", required: RoleAdmin, token: "guessed-secret", status: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gc.mu.Lock()
+			gc.config.API.AnonymousAccess = tc.anonymous
+			gc.mu.Unlock()
+			served = apiPrincipal{}
+
+			recorder := httptest.NewRecorder()
+			gc.authorize(tc.required, handler).ServeHTTP(recorder, authRequest(nil, tc.token))
+			require.Equal(t, tc.status, recorder.Code, recorder.Body.String())
+			if tc.status == http.StatusUnauthorized {
+				require.NotEmpty(t, recorder.Header().Get("WWW-Authenticate"))
+			}
+			if tc.status == http.StatusOK {
+				require.GreaterOrEqual(t, served.Role, tc.required)
+			} else {
+				require.Equal(t, apiPrincipal{}, served)
+			}
+		})
+	}
+}
+
+func TestApplyCORS(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		allowed   []string
+		origin    string
+		preflight bool
+		allow     string
+		vary      bool
+		answered  bool
+	}{
+		{name: "no origins configured", origin: "https://dashboard.example.com"},
+		{name: "allowed origin", allowed: []string{"https://dashboard.example.com"}, origin: "https://dashboard.example.com", allow: "https://dashboard.example.com", vary: true},
+		{name: "disallowed origin", allowed: []string{"https://dashboard.example.com"}, origin: "https://evil.example.com", vary: true},
+		{name: "request without origin", allowed: []string{"https://dashboard.example.com"}, vary: true},
+		{name: "any origin", allowed: []string{"*"}, origin: "https://evil.example.com", allow: "*", vary: true},
+		{name: "allowed preflight", allowed: []string{"https://dashboard.example.com"}, origin: "https://dashboard.example.com", preflight: true, allow: "https://dashboard.example.com", vary: true, answered: true},
+		{name: "disallowed preflight", allowed: []string{"https://dashboard.example.com"}, origin: "https://evil.example.com", preflight: true, vary: true, answered: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &APIConfig{AllowedOrigins: tc.allowed}
+			req := httptest.NewRequest(http.MethodGet, "/chains", nil)
+			if tc.preflight {
+				req.Method = http.MethodOptions
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			if tc.origin != "" {
+				req.Header.Set("Origin", tc.origin)
+			}
+
+			recorder := httptest.NewRecorder()
+			require.Equal(t, tc.answered, config.applyCORS(recorder, req))
+			require.Equal(t, tc.allow, recorder.Header().Get("Access-Control-Allow-Origin"))
+			if tc.allow == "" {
+				require.Empty(t, recorder.Header().Get("Access-Control-Allow-Methods"))
+			}
+			if tc.vary {
+				require.Equal(t, []string{"Origin"}, recorder.Header().Values("Vary"))
+			} else {
+				require.Empty(t, recorder.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestReaderViewsRedactAPIConfig(t *testing.T) {
+	config := NewGeoConfig()
+	config.API.AdminCommonNames = []string{"ops-admin"}
+	config.API.Tokens = []APIToken{{Name: "operator", SHA256: tokenDigest("operate-secret"), Role: "admin"}}
+	config.API.TLS.KeyFile = "/etc/geo/api.key"
+	gc, err := NewGeoConsenter(config)
+	require.NoError(t, err)
+	defer gc.Halt()
+
+	chain := newTestChain(t)
+	chain.UpdateConfig(config)
+	gc.chains["testchannel"] = chain
+
+	for path, handler := range map[string]http.HandlerFunc{
+		"/chains":                gc.handleChains,
+		"/chains?id=testchannel": gc.handleChains,
+		"/topology":              gc.handleTopology,
+	} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, recorder.Code, path)
+		body := recorder.Body.String()
+		require.Contains(t, body, `"latency_threshold"`, path)
+		for _, secret := range []string{"ops-admin", tokenDigest("operate-secret"), "api.key"} {
+			require.NotContains(t, body, secret, path)
+		}
+	}
+
+	require.Equal(t, "ops-admin", chain.Config().API.AdminCommonNames[0])
+}
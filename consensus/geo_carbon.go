@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCarbonEnergyPerGB is the network energy, in kWh, of moving a
+// gigabyte between regions when Carbon.EnergyPerGB is not set
+const defaultCarbonEnergyPerGB = 0.06
+
+// defaultCarbonRefreshInterval is how often the carbon source is reloaded
+// when CarbonSource.RefreshInterval is not set
+const defaultCarbonRefreshInterval = 15 * time.Minute
+
+// carbonFetchTimeout bounds a request to an HTTP carbon source
+const carbonFetchTimeout = 10 * time.Second
+
+// maxCarbonSourceBytes bounds the size of an HTTP carbon source response
+const maxCarbonSourceBytes = 16 << 20
+
+// CarbonConfig weighs grid carbon intensity in leader scoring and sizes the
+// channel's emission estimate
+type CarbonConfig struct {
+	// Weight scales the carbon penalty in leader scoring; zero reports
+	// emissions without affecting elections. The latency factors count a
+	// second as 1, so Weight may not exceed LatencyThreshold in seconds:
+	// carbon then never outweighs more latency than the threshold allows.
+	Weight float64 `json:"weight"`
+	// EnergyPerGB is the energy, in kWh, of replicating a gigabyte to a
+	// follower
+	EnergyPerGB float64 `json:"energy_per_gb"`
+}
+
+// CarbonSourceConfig locates the per-region carbon intensities. Only one of
+// File and URL may be set; either is reloaded every RefreshInterval.
+type CarbonSourceConfig struct {
+	// File is a .json or .csv file in the format of LoadCarbonIntensity
+	File string `json:"file"`
+	// URL serves the JSON format over HTTP
+	URL             string        `json:"url"`
+	RefreshInterval time.Duration `json:"refresh_interval"`
+}
+
+// CarbonEstimate is the channel's current carbon picture. Intensities are
+// in gCO2eq/kWh; emissions are in grams of CO2 equivalent.
+type CarbonEstimate struct {
+	RegionIntensity map[string]float64 `json:"region_intensity"`
+	LeaderIntensity float64            `json:"leader_intensity"`
+	EmissionsGrams  float64            `json:"emissions_grams"`
+	GramsPerHour    float64            `json:"grams_per_hour"`
+}
+
+// CarbonIntensitySource provides the grid carbon intensity of a region, in
+// gCO2eq/kWh. ok is false if the source has no value for the region at that
+// time.
+type CarbonIntensitySource interface {
+	Intensity(region string, at time.Time) (intensity float64, ok bool)
+}
+
+// CarbonSample is the carbon intensity of a region from a point in time
+// until the region's next sample. A zero Time applies from the start.
+type CarbonSample struct {
+	Time      time.Time
+	Region    string
+	Intensity float64
+}
+
+// CarbonIntensityTrace is a recorded or forecast carbon intensity per region
+// over time
+type CarbonIntensityTrace struct {
+	regions map[string][]CarbonSample
+}
+
+// NewCarbonIntensityTrace indexes samples by region and time
+func NewCarbonIntensityTrace(samples []CarbonSample) (*CarbonIntensityTrace, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("carbon intensity source has no samples")
+	}
+
+	trace := &CarbonIntensityTrace{regions: make(map[string][]CarbonSample)}
+	for _, sample := range samples {
+		if sample.Region == "" {
+			return nil, fmt.Errorf("carbon intensity sample without a region")
+		}
+		if sample.Intensity < 0 {
+			return nil, fmt.Errorf("carbon intensity of %s is negative", sample.Region)
+		}
+		trace.regions[sample.Region] = append(trace.regions[sample.Region], sample)
+	}
+	for _, regionSamples := range trace.regions {
+		sort.SliceStable(regionSamples, func(i, j int) bool {
+			return regionSamples[i].Time.Before(regionSamples[j].Time)
+		})
+	}
+	return trace, nil
+}
+
+// Intensity returns the latest intensity of a region at or before at
+func (t *CarbonIntensityTrace) Intensity(region string, at time.Time) (float64, bool) {
+	samples := t.regions[region]
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Time.After(at)
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return samples[i-1].Intensity, true
+}
+
+// LoadCarbonIntensity reads carbon intensities from a .csv or .json file, or
+// from an http(s) URL serving JSON.
+//
+// CSV files have a header row with the columns time, region and intensity.
+// JSON holds {"intensities": [{"time", "region", "intensity"}, ...]}.
+// Intensities are in gCO2eq/kWh and times are RFC 3339 timestamps; a sample
+// without a time applies until the region's first timed sample.
+func LoadCarbonIntensity(ctx context.Context, source string) (*CarbonIntensityTrace, error) {
+	var samples []CarbonSample
+	var err error
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		samples, err = fetchCarbonJSON(ctx, source)
+	} else {
+		samples, err = readCarbonFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read carbon intensity source %s: %v", source, err)
+	}
+	return NewCarbonIntensityTrace(samples)
+}
+
+// readCarbonFile parses a CSV or JSON carbon intensity file
+func readCarbonFile(path string) ([]CarbonSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return readCarbonCSV(file)
+	case ".json":
+		return readCarbonJSON(file)
+	default:
+		return nil, fmt.Errorf("unsupported carbon intensity format %q, use .csv or .json", filepath.Ext(path))
+	}
+}
+
+// fetchCarbonJSON requests JSON carbon intensities over HTTP
+func fetchCarbonJSON(ctx context.Context, url string) ([]CarbonSample, error) {
+	ctx, cancel := context.WithTimeout(ctx, carbonFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return readCarbonJSON(io.LimitReader(resp.Body, maxCarbonSourceBytes))
+}
+
+// readCarbonCSV parses CSV carbon intensity samples
+func readCarbonCSV(r io.Reader) ([]CarbonSample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"time", "region", "intensity"} {
+		if _, exists := columns[required]; !exists {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var samples []CarbonSample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sample := CarbonSample{Region: strings.TrimSpace(record[columns["region"]])}
+		if sample.Time, err = carbonTime(strings.TrimSpace(record[columns["time"]])); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		value := strings.TrimSpace(record[columns["intensity"]])
+		if sample.Intensity, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid intensity %q", line, value)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// carbonIntensityJSON is the JSON carbon intensity format
+type carbonIntensityJSON struct {
+	Intensities []struct {
+		Time      string  `json:"time"`
+		Region    string  `json:"region"`
+		Intensity float64 `json:"intensity"`
+	} `json:"intensities"`
+}
+
+// readCarbonJSON parses JSON carbon intensity samples
+func readCarbonJSON(r io.Reader) ([]CarbonSample, error) {
+	var doc carbonIntensityJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	samples := make([]CarbonSample, 0, len(doc.Intensities))
+	for i, entry := range doc.Intensities {
+		t, err := carbonTime(entry.Time)
+		if err != nil {
+			return nil, fmt.Errorf("intensities[%d]: %v", i, err)
+		}
+		samples = append(samples, CarbonSample{Time: t, Region: entry.Region, Intensity: entry.Intensity})
+	}
+	return samples, nil
+}
+
+// carbonTime parses an RFC 3339 sample time; an empty time is zero
+func carbonTime(text string) (time.Time, error) {
+	if text == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339", text)
+	}
+	return t, nil
+}
+
+// carbonIntensity is the consenter's carbon source. It serves the latest
+// successfully loaded trace and keeps it when a reload fails.
+type carbonIntensity struct {
+	mu    sync.RWMutex
+	trace *CarbonIntensityTrace
+}
+
+func (c *carbonIntensity) Intensity(region string, at time.Time) (float64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.trace == nil {
+		return 0, false
+	}
+	return c.trace.Intensity(region, at)
+}
+
+// location returns the configured file or URL, or "" if none is set
+func (c CarbonSourceConfig) location() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return c.File
+}
+
+// load reloads the configured source. Nothing changes if no source is
+// configured or loading fails.
+func (c *carbonIntensity) load(ctx context.Context, config CarbonSourceConfig) error {
+	source := config.location()
+	if source == "" {
+		return nil
+	}
+	trace, err := LoadCarbonIntensity(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.trace = trace
+	c.mu.Unlock()
+	return nil
+}
+
+// refreshCarbon reloads the consenter's carbon source every refresh
+// interval until ctx is done. The source and interval are read from the
+// current config on each round.
+func (gc *GeoConsenter) refreshCarbon(ctx context.Context) {
+	defer gc.wg.Done()
+
+	for {
+		interval := gc.currentConfig().CarbonSource.RefreshInterval
+		if interval <= 0 {
+			interval = defaultCarbonRefreshInterval
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+			if err := gc.carbon.load(ctx, gc.currentConfig().CarbonSource); err != nil {
+				consenterLogger.Warningf("Keeping previous carbon intensities: %v", err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// UseCarbonSource sets where the chain reads regional carbon intensities
+// from. A nil source disables carbon scoring and emission estimates.
+func (g *GeoEtcdRaft) UseCarbonSource(source CarbonIntensitySource) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.carbonSource = source
+}
+
+// carbonIntensity returns a region's current carbon intensity. Callers must
+// hold g.mu.
+func (g *GeoEtcdRaft) carbonIntensity(region string) (float64, bool) {
+	if g.carbonSource == nil {
+		return 0, false
+	}
+	return g.carbonSource.Intensity(region, g.now())
+}
+
+// energyPerGB returns the configured replication energy per gigabyte
+func (c CarbonConfig) energyPerGB() float64 {
+	if c.EnergyPerGB > 0 {
+		return c.EnergyPerGB
+	}
+	return defaultCarbonEnergyPerGB
+}
+
+// replicationEmissions estimates the grams of CO2 equivalent emitted
+// replicating bytes from a leader to every follower. Each transfer is
+// charged the mean intensity of the two regions, or the one that is known.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) replicationEmissions(leaderID uint64, bytes float64) float64 {
+	leader := g.nodes[leaderID]
+	if leader == nil {
+		return 0
+	}
+
+	kWh := bytes / bytesPerGB * g.config.Carbon.energyPerGB()
+	leaderIntensity, leaderKnown := g.carbonIntensity(leader.Location.Region)
+
+	grams := 0.0
+	for followerID, follower := range g.nodes {
+		if followerID == leaderID {
+			continue
+		}
+		followerIntensity, followerKnown := g.carbonIntensity(follower.Location.Region)
+		switch {
+		case leaderKnown && followerKnown:
+			grams += kWh * (leaderIntensity + followerIntensity) / 2
+		case leaderKnown:
+			grams += kWh * leaderIntensity
+		case followerKnown:
+			grams += kWh * followerIntensity
+		}
+	}
+	return grams
+}
+
+// carbonPenalty is Carbon.Weight times the intensity of a node's region
+// relative to the most carbon-intensive region of the channel. A region
+// without a known intensity is charged the mean of the known ones, so it is
+// neither preferred nor avoided. Callers must hold g.mu.
+func (g *GeoEtcdRaft) carbonPenalty(nodeID uint64) float64 {
+	node := g.nodes[nodeID]
+	if g.config.Carbon.Weight <= 0 || node == nil {
+		return 0
+	}
+
+	known := make(map[string]float64)
+	highest, sum := 0.0, 0.0
+	for _, other := range g.nodes {
+		region := other.Location.Region
+		if _, seen := known[region]; seen {
+			continue
+		}
+		if intensity, ok := g.carbonIntensity(region); ok {
+			known[region] = intensity
+			sum += intensity
+			if intensity > highest {
+				highest = intensity
+			}
+		}
+	}
+	if highest == 0 {
+		return 0
+	}
+
+	intensity, ok := known[node.Location.Region]
+	if !ok {
+		intensity = sum / float64(len(known))
+	}
+	return g.config.Carbon.Weight * intensity / highest
+}
+
+// updateCarbonEstimate refreshes the regional intensities and the emission
+// rate in the metrics. Callers must hold g.mu.
+func (g *GeoEtcdRaft) updateCarbonEstimate() {
+	estimate := &g.metrics.Carbon
+	estimate.RegionIntensity = make(map[string]float64)
+	for _, node := range g.nodes {
+		if intensity, ok := g.carbonIntensity(node.Location.Region); ok {
+			estimate.RegionIntensity[node.Location.Region] = intensity
+		}
+	}
+
+	leaderID := g.leaderID()
+	estimate.LeaderIntensity = 0
+	if leader := g.nodes[leaderID]; leader != nil {
+		estimate.LeaderIntensity = estimate.RegionIntensity[leader.Location.Region]
+	}
+	estimate.GramsPerHour = g.replicationEmissions(leaderID, g.blockBytesPerSecond()*time.Hour.Seconds())
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// staticCarbon is a carbon source with fixed intensities per region
+type staticCarbon map[string]float64
+
+func (s staticCarbon) Intensity(region string, at time.Time) (float64, bool) {
+	intensity, ok := s[region]
+	return intensity, ok
+}
+
+func TestReadCarbonCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		csv     string
+		samples []CarbonSample
+		err     string
+	}{
+		{
+			name: "columns in any order with comments and untimed samples",
+			csv: "# exported from the grid provider\n" +
+				"Region, Intensity, Time\n" +
+				"eu-west, 120, 2026-10-18T06:00:00Z\n" +
+				"us-east, 380,\n",
+			samples: []CarbonSample{
+				{Time: time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC), Region: "eu-west", Intensity: 120},
+				{Region: "us-east", Intensity: 380},
+			},
+		},
+		{name: "empty file", csv: "", err: "missing header: EOF"},
+		{name: "missing column", csv: "time,region\n,eu-west\n", err: `missing column "intensity"`},
+		{name: "bad time", csv: "time,region,intensity\n2026-10-18 06:00,eu-west,120\n", err: `line 2: invalid time "2026-10-18 06:00", expected RFC 3339`},
+		{name: "bad intensity", csv: "time,region,intensity\n,eu-west,120\n,us-east,high\n", err: `line 3: invalid intensity "high"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			samples, err := readCarbonCSV(strings.NewReader(tc.csv))
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.samples, samples)
+		})
+	}
+}
+
+func TestReadCarbonJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		json    string
+		samples []CarbonSample
+		err     string
+	}{
+		{
+			name: "timed and untimed samples",
+			json: `{"intensities": [{"time": "2026-10-18T00:00:00Z", "region": "eu-west", "intensity": 120},
+			                    {"region": "us-east", "intensity": 380}]}`,
+			samples: []CarbonSample{
+				{Time: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), Region: "eu-west", Intensity: 120},
+				{Region: "us-east", Intensity: 380},
+			},
+		},
+		{name: "bad time", json: `{"intensities": [{"region": "us-east", "intensity": 1}, {"time": "yesterday", "region": "eu-west"}]}`, err: `intensities[1]: invalid time "yesterday", expected RFC 3339`},
+		{name: "not json", json: `time,region,intensity`, err: "invalid character"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			samples, err := readCarbonJSON(strings.NewReader(tc.json))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.samples, samples)
+		})
+	}
+}
+
+func TestNewCarbonIntensityTraceRejectsInvalidSamples(t *testing.T) {
+	_, err := NewCarbonIntensityTrace(nil)
+	require.EqualError(t, err, "carbon intensity source has no samples")
+
+	_, err = NewCarbonIntensityTrace([]CarbonSample{{Intensity: 100}})
+	require.EqualError(t, err, "carbon intensity sample without a region")
+
+	_, err = NewCarbonIntensityTrace([]CarbonSample{{Region: "eu-west", Intensity: -1}})
+	require.EqualError(t, err, "carbon intensity of eu-west is negative")
+}
+
+func TestCarbonIntensityTraceLookup(t *testing.T) {
+	morning := time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+	evening := morning.Add(12 * time.Hour)
+
+	// Samples may arrive in any order
+	trace, err := NewCarbonIntensityTrace([]CarbonSample{
+		{Time: evening, Region: "eu-west", Intensity: 210},
+		{Region: "eu-west", Intensity: 150},
+		{Time: morning, Region: "eu-west", Intensity: 120},
+		{Time: morning, Region: "us-east", Intensity: 380},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		region    string
+		at        time.Time
+		intensity float64
+		ok        bool
+	}{
+		{name: "untimed sample before the first timed one", region: "eu-west", at: morning.Add(-time.Nanosecond), intensity: 150, ok: true},
+		{name: "at a sample's time", region: "eu-west", at: morning, intensity: 120, ok: true},
+		{name: "between samples", region: "eu-west", at: evening.Add(-time.Nanosecond), intensity: 120, ok: true},
+		{name: "at the last sample's time", region: "eu-west", at: evening, intensity: 210, ok: true},
+		{name: "after the last sample", region: "eu-west", at: evening.Add(24 * time.Hour), intensity: 210, ok: true},
+		{name: "before a region's first sample", region: "us-east", at: morning.Add(-time.Nanosecond)},
+		{name: "unknown region", region: "ap-south", at: evening},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			intensity, ok := trace.Intensity(tc.region, tc.at)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.intensity, intensity)
+		})
+	}
+}
+
+func TestReplicationEmissions(t *testing.T) {
+	chain := newTestChain(t)
+	chain.UseCarbonSource(staticCarbon{"us-west": 100, "us-east": 300})
+
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	// A gigabyte to us-east at the mean of both regions, and to eu-west at
+	// the leader's intensity alone
+	require.InDelta(t, 0.06*200+0.06*100, chain.replicationEmissions(1, bytesPerGB), 1e-9)
+	// A leader in an unknown region is charged its followers' intensities
+	require.InDelta(t, 0.06*100+0.06*300, chain.replicationEmissions(3, bytesPerGB), 1e-9)
+	require.Zero(t, chain.replicationEmissions(9, bytesPerGB))
+
+	chain.carbonSource = nil
+	require.Zero(t, chain.replicationEmissions(1, bytesPerGB))
+}
+
+func TestCarbonPenalty(t *testing.T) {
+	chain := newTestChain(t)
+	chain.config.Carbon.Weight = 0.5
+	chain.UseCarbonSource(staticCarbon{"us-west": 100, "us-east": 400})
+
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	require.Equal(t, 0.125, chain.carbonPenalty(1))
+	require.Equal(t, 0.5, chain.carbonPenalty(2))
+	// eu-west has no known intensity and is charged the mean of the others,
+	// so it is not preferred over the cleaner us-west
+	require.Equal(t, 0.3125, chain.carbonPenalty(3))
+	require.Greater(t, chain.carbonPenalty(3), chain.carbonPenalty(1))
+	require.Zero(t, chain.carbonPenalty(9))
+
+	chain.carbonSource = staticCarbon{}
+	require.Zero(t, chain.carbonPenalty(1))
+
+	chain.carbonSource = staticCarbon{"us-west": 100}
+	chain.config.Carbon.Weight = 0
+	require.Zero(t, chain.carbonPenalty(1))
+}
+
+func TestCarbonWeightIsCappedByLatencyThreshold(t *testing.T) {
+	config := NewGeoConfig()
+	config.Carbon.Weight = 0.5
+	require.NoError(t, config.Validate())
+
+	config.Carbon.Weight = 0.6
+	var configErr *ConfigError
+	require.True(t, errors.As(config.Validate(), &configErr))
+	require.Equal(t, []*FieldError{
+		{Field: "Carbon.Weight", Value: 0.6, Reason: "must not exceed LatencyThreshold in seconds (0.5)"},
+	}, configErr.Fields)
+
+	config.LatencyThreshold = time.Second
+	require.NoError(t, config.Validate())
+}
+
+func TestCarbonReloadKeepsPreviousTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "carbon.csv")
+	require.NoError(t, os.WriteFile(path, []byte("time,region,intensity\n,eu-west,120\n"), 0644))
+
+	carbon := &carbonIntensity{}
+	_, ok := carbon.Intensity("eu-west", time.Now())
+	require.False(t, ok)
+
+	source := CarbonSourceConfig{File: path}
+	require.NoError(t, carbon.load(context.Background(), source))
+	intensity, ok := carbon.Intensity("eu-west", time.Now())
+	require.True(t, ok)
+	require.Equal(t, 120.0, intensity)
+
+	// A broken or missing source leaves the last good trace in place
+	require.NoError(t, os.WriteFile(path, []byte("time,region\n,eu-west\n"), 0644))
+	require.ErrorContains(t, carbon.load(context.Background(), source), `missing column "intensity"`)
+	require.NoError(t, os.Remove(path))
+	require.Error(t, carbon.load(context.Background(), source))
+	intensity, ok = carbon.Intensity("eu-west", time.Now())
+	require.True(t, ok)
+	require.Equal(t, 120.0, intensity)
+
+	// Without a source nothing is loaded and nothing changes
+	require.NoError(t, carbon.load(context.Background(), CarbonSourceConfig{}))
+	intensity, _ = carbon.Intensity("eu-west", time.Now())
+	require.Equal(t, 120.0, intensity)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Catch-up kinds: replaying blocks, or installing a snapshot when the
+// follower is behind the leader's compacted log
+const (
+	CatchUpBlocks   = "blocks"
+	CatchUpSnapshot = "snapshot"
+)
+
+// catchUpStaleAfter is how long a node may go unseen, or a progress report
+// may age, before the node is no longer used as a catch-up source
+const catchUpStaleAfter = time.Minute
+
+// catchUpHeightHistory is how many written blocks are remembered to turn the
+// raft indexes followers acknowledge into ledger heights
+const catchUpHeightHistory = 1024
+
+// committedHeight is the ledger height reached by the block written at a
+// raft index
+type committedHeight struct {
+	index  uint64
+	height uint64
+}
+
+// ReplicationProgress is how far a node has replicated the channel: its
+// ledger height and the raft index of its latest snapshot
+type ReplicationProgress struct {
+	BlockHeight   uint64    `json:"block_height"`
+	SnapshotIndex uint64    `json:"snapshot_index"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// position returns the progress that matters for a kind of catch-up
+func (p ReplicationProgress) position(kind string) uint64 {
+	if kind == CatchUpSnapshot {
+		return p.SnapshotIndex
+	}
+	return p.BlockHeight
+}
+
+// CatchUpSelection is the replica a lagging node was steered to. Fallback
+// is set when no replica closer than the leader was caught up far enough.
+// Alternatives are the remaining qualifying replicas, nearest first, ending
+// with the leader.
+type CatchUpSelection struct {
+	NodeID       uint64        `json:"node_id"`
+	Kind         string        `json:"kind"`
+	Target       uint64        `json:"target"`
+	Source       uint64        `json:"source"`
+	SourceRegion string        `json:"source_region"`
+	Fallback     bool          `json:"fallback"`
+	Latency      time.Duration `json:"latency"`
+	Alternatives []uint64      `json:"alternatives,omitempty"`
+	SelectedAt   time.Time     `json:"selected_at"`
+}
+
+// ReportProgress records a node's replication progress. The chain tracks
+// progress itself: the local node's from the blocks it writes and, on the
+// leader, the followers' from the appends and snapshots they acknowledge.
+// ReportProgress replaces that for progress learned by other means.
+func (g *GeoEtcdRaft) ReportProgress(nodeID uint64, progress ReplicationProgress) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.nodes[nodeID] == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
+	}
+	if progress.UpdatedAt.IsZero() {
+		progress.UpdatedAt = g.now()
+	}
+	g.progress[nodeID] = progress
+	return nil
+}
+
+// recordCommittedHeight remembers the ledger height the local node reached
+// with the block written at a raft index and records it as the local node's
+// progress
+func (g *GeoEtcdRaft) recordCommittedHeight(index, height uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if index > 0 && (len(g.heights) == 0 || index > g.heights[len(g.heights)-1].index) {
+		g.heights = append(g.heights, committedHeight{index: index, height: height})
+		if len(g.heights) > catchUpHeightHistory {
+			g.heights = append([]committedHeight(nil), g.heights[len(g.heights)-catchUpHeightHistory:]...)
+		}
+	}
+	g.advanceProgress(g.localNodeID, height, 0)
+}
+
+// recordAppendProgress records the progress of a node that holds the raft
+// entries up to index. Indexes older than the remembered blocks are
+// ignored.
+func (g *GeoEtcdRaft) recordAppendProgress(nodeID, index uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// The height is that of the last block written at or before the index
+	i := sort.Search(len(g.heights), func(i int) bool { return g.heights[i].index > index })
+	if i > 0 {
+		g.advanceProgress(nodeID, g.heights[i-1].height, 0)
+	}
+}
+
+// recordSnapshotProgress records the raft index of a snapshot sent to a
+// node
+func (g *GeoEtcdRaft) recordSnapshotProgress(nodeID, index uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.advanceProgress(nodeID, 0, index)
+}
+
+// advanceProgress raises the recorded progress of a registered node. Callers
+// must hold g.mu.
+func (g *GeoEtcdRaft) advanceProgress(nodeID, blockHeight, snapshotIndex uint64) {
+	if g.nodes[nodeID] == nil {
+		return
+	}
+	progress := g.progress[nodeID]
+	if blockHeight > progress.BlockHeight {
+		progress.BlockHeight = blockHeight
+	}
+	if snapshotIndex > progress.SnapshotIndex {
+		progress.SnapshotIndex = snapshotIndex
+	}
+	progress.UpdatedAt = g.now()
+	g.progress[nodeID] = progress
+}
+
+// CatchUpSource chooses the replica a lagging node should pull blocks or a
+// snapshot from: the nearest live node, by the proximity matrix, that is
+// ahead of the node and within CatchUpMaxLag of target. A zero target means
+// the leader's progress, or the furthest reported progress if the leader
+// has not reported. The leader is always a candidate and is used when no
+// closer replica qualifies. The selection is recorded in the chain metrics.
+func (g *GeoEtcdRaft) CatchUpSource(nodeID uint64, kind string, target uint64) (*CatchUpSelection, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if kind != CatchUpBlocks && kind != CatchUpSnapshot {
+		return nil, fmt.Errorf("unknown catch-up kind %q, use %s or %s", kind, CatchUpBlocks, CatchUpSnapshot)
+	}
+	if g.nodes[nodeID] == nil {
+		return nil, fmt.Errorf("node %d is not registered", nodeID)
+	}
+	leaderID := g.leaderID()
+	if leaderID == 0 {
+		return nil, fmt.Errorf("no catch-up source for node %d: the channel has no leader", nodeID)
+	}
+	if leaderID == nodeID {
+		return nil, fmt.Errorf("node %d is the leader and has nothing to catch up", nodeID)
+	}
+	if target == 0 {
+		if progress, reported := g.progress[leaderID]; reported {
+			target = progress.position(kind)
+		} else {
+			for _, progress := range g.progress {
+				if progress.position(kind) > target {
+					target = progress.position(kind)
+				}
+			}
+		}
+	}
+
+	sources := g.rankCatchUpSources(nodeID, kind, target)
+	// The leader holds every committed entry
+	sources = append(sources, leaderID)
+
+	now := g.now()
+	source := sources[0]
+	selection := &CatchUpSelection{
+		NodeID:       nodeID,
+		Kind:         kind,
+		Target:       target,
+		Source:       source,
+		SourceRegion: g.nodes[source].Location.Region,
+		Fallback:     source == leaderID && len(sources) == 1,
+		Latency:      g.pairLatency(nodeID, source),
+		Alternatives: append([]uint64(nil), sources[1:]...),
+		SelectedAt:   now,
+	}
+
+	g.metrics.CatchUpSelections++
+	if selection.Fallback {
+		g.metrics.CatchUpFallbacks++
+	}
+	g.metrics.CatchUpSources[nodeID] = *selection
+
+	logger.Infof("Node %d catches up (%s to %d) from node %d in %s, fallback %t",
+		nodeID, kind, target, source, selection.SourceRegion, selection.Fallback)
+
+	return selection, nil
+}
+
+// rankCatchUpSources returns the live replicas other than the node and the
+// leader that are caught up far enough and closer than the leader, nearest
+// first. Callers must hold g.mu.
+func (g *GeoEtcdRaft) rankCatchUpSources(nodeID uint64, kind string, target uint64) []uint64 {
+	now := g.now()
+	leaderID := g.leaderID()
+	own := g.progress[nodeID].position(kind)
+
+	var sources []uint64
+	for otherID, other := range g.nodes {
+		if otherID == nodeID || otherID == leaderID || now.Sub(other.LastSeen) > catchUpStaleAfter {
+			continue
+		}
+		progress, reported := g.progress[otherID]
+		if !reported || now.Sub(progress.UpdatedAt) > catchUpStaleAfter {
+			continue
+		}
+		if progress.position(kind) <= own || progress.position(kind)+g.config.CatchUpMaxLag < target {
+			continue
+		}
+		sources = append(sources, otherID)
+	}
+
+	// Leader included for ordering: a closer leader beats a farther replica
+	sources = append(sources, leaderID)
+	proximity := g.proximityMatrix[nodeID]
+	sort.Slice(sources, func(i, j int) bool {
+		if proximity[sources[i]] != proximity[sources[j]] {
+			return proximity[sources[i]] > proximity[sources[j]]
+		}
+		latencyI, latencyJ := g.pairLatency(nodeID, sources[i]), g.pairLatency(nodeID, sources[j])
+		if latencyI != latencyJ {
+			return latencyI < latencyJ
+		}
+		return sources[i] < sources[j]
+	})
+
+	// Replicas farther than the leader gain nothing over it
+	for i, sourceID := range sources {
+		if sourceID == leaderID {
+			return sources[:i]
+		}
+	}
+	return sources
+}
+
+// handleCatchUp chooses the replica a lagging node should catch up from.
+// The selection is recorded in the chain metrics like any other.
+func (gc *GeoConsenter) handleCatchUp(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	chainID := query.Get("id")
+	if chainID == "" {
+		http.Error(w, "Query parameter id is required", http.StatusBadRequest)
+		return
+	}
+	nodeID, err := strconv.ParseUint(query.Get("node"), 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid node: %v", err), http.StatusBadRequest)
+		return
+	}
+	kind := query.Get("kind")
+	if kind == "" {
+		kind = CatchUpBlocks
+	}
+	if kind != CatchUpBlocks && kind != CatchUpSnapshot {
+		http.Error(w, fmt.Sprintf("Unknown kind %q, use %s or %s", kind, CatchUpBlocks, CatchUpSnapshot), http.StatusBadRequest)
+		return
+	}
+	var target uint64
+	if value := query.Get("target"); value != "" {
+		if target, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid target: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	gc.mu.RLock()
+	chain, exists := gc.chains[chainID]
+	gc.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, fmt.Sprintf("Chain %s not found", chainID), http.StatusNotFound)
+		return
+	}
+
+	selection, err := chain.CatchUpSource(nodeID, kind, target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(selection)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+// observe feeds a raft message to the chain as the transport would
+func observe(t *testing.T, chain *GeoEtcdRaft, msg raftpb.Message) {
+	chain.observeRaftMessage(raftRequest(t, msg).Payload)
+}
+
+func TestProgressFollowsBlocksAndAcknowledgements(t *testing.T) {
+	chain := newTestChain(t)
+	chain.SetLocalNode(1)
+	chain.nodes[1].IsLeader = true
+
+	support := chain.WrapSupport(&testSupport{})
+	for number, index := range []uint64{3, 4, 6, 9} {
+		block, _ := testBlock(t, uint64(number), &cb.Envelope{Payload: []byte("transaction")})
+		support.WriteBlock(block, raftMetadata(t, index))
+	}
+	require.Equal(t, uint64(4), chain.progress[1].BlockHeight)
+
+	// Node 2 holds the entries up to index 7, so the blocks up to index 6;
+	// node 3 only acknowledged entries before the first remembered block
+	observe(t, chain, raftpb.Message{Type: raftpb.MsgAppResp, From: 2, To: 1, Index: 7})
+	observe(t, chain, raftpb.Message{Type: raftpb.MsgAppResp, From: 3, To: 1, Index: 2})
+	observe(t, chain, raftpb.Message{Type: raftpb.MsgAppResp, From: 3, To: 1, Index: 9, Reject: true})
+	require.Equal(t, uint64(3), chain.progress[2].BlockHeight)
+	require.NotContains(t, chain.progress, uint64(3))
+
+	observe(t, chain, raftpb.Message{
+		Type:     raftpb.MsgSnap,
+		From:     1,
+		To:       3,
+		Snapshot: raftpb.Snapshot{Metadata: raftpb.SnapshotMetadata{Index: 6}},
+	})
+	require.Equal(t, uint64(6), chain.progress[3].SnapshotIndex)
+
+	// Progress only moves forward
+	observe(t, chain, raftpb.Message{Type: raftpb.MsgAppResp, From: 2, To: 1, Index: 4})
+	require.Equal(t, uint64(3), chain.progress[2].BlockHeight)
+
+	// Node 3 in London now catches up from node 2 in New York
+	selection, err := chain.CatchUpSource(3, CatchUpBlocks, 3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), selection.Source)
+	require.False(t, selection.Fallback)
+}
+
+func TestHandleCatchUp(t *testing.T) {
+	chain := newTestChain(t)
+	chain.nodes[1].IsLeader = true
+	gc := &GeoConsenter{chains: map[string]*GeoEtcdRaft{"testchannel": chain}}
+
+	for query, status := range map[string]int{
+		"?id=testchannel&node=3":               http.StatusOK,
+		"?id=testchannel&node=3&kind=snapshot": http.StatusOK,
+		"?id=testchannel&node=3&kind=ledger":   http.StatusBadRequest,
+		"?id=testchannel&node=x":               http.StatusBadRequest,
+		"?id=testchannel&node=3&target=-1":     http.StatusBadRequest,
+		"?id=other&node=3":                     http.StatusNotFound,
+		"?id=testchannel&node=1":               http.StatusConflict,
+	} {
+		recorder := httptest.NewRecorder()
+		gc.handleCatchUp(recorder, httptest.NewRequest(http.MethodGet, "/chains/catchup"+query, nil))
+		require.Equal(t, status, recorder.Code, query)
+		if status == http.StatusOK {
+			var selection CatchUpSelection
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(&selection))
+			require.Equal(t, uint64(1), selection.Source, query)
+			require.True(t, selection.Fallback, query)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// consenterConfigKeys are the GeoConfig settings shared by every channel,
+// which channel overrides cannot change
+var consenterConfigKeys = []string{"api", "tracing", "election_log_file", "carbon_source", "channels"}
+
+// ForChannel returns the effective configuration of a channel: the global
+// settings with the channel's override from Channels applied
+func (c *GeoConfig) ForChannel(channelID string) (*GeoConfig, error) {
+	effective := c.Clone()
+	effective.Channels = nil
+
+	override, ok := c.Channels[channelID]
+	if !ok {
+		return effective, nil
+	}
+	if err := applyConfigOverride(effective, override); err != nil {
+		return nil, fmt.Errorf("invalid config override for channel %s: %v", channelID, err)
+	}
+	return effective, nil
+}
+
+// applyConfigOverride decodes a partial GeoConfig over config, which must
+// not share slices with another config (see Clone). Unknown and
+// consenter-wide settings are rejected.
+func applyConfigOverride(config *GeoConfig, override json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(override, &fields); err != nil {
+		return err
+	}
+	for _, key := range consenterConfigKeys {
+		if _, ok := fields[key]; ok {
+			return fmt.Errorf("%s cannot be overridden per channel", key)
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(override))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(config)
+}
+
+// mergeConfigOverride adds the settings of patch to an existing override,
+// replacing settings present in both
+func mergeConfigOverride(existing, patch json.RawMessage) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(existing) > 0 {
+		if err := json.Unmarshal(existing, &fields); err != nil {
+			return nil, err
+		}
+	}
+	var updates map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &updates); err != nil {
+		return nil, err
+	}
+	for key, value := range updates {
+		fields[key] = value
+	}
+	return json.Marshal(fields)
+}
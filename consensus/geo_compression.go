@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms for cross-region append messages
+const (
+	CompressionNone   = "none"
+	CompressionSnappy = "snappy"
+	CompressionZstd   = "zstd"
+)
+
+// frameMagic is the first byte of every append frame. A marshalled raft
+// message always starts with the tag of its type field (0x08), so a payload
+// without the magic byte is a single raft message sent as it is, which is
+// what orderers without the geo layer send and expect.
+const frameMagic byte = 0xfe
+
+// Codec identifiers in the byte after frameMagic
+const (
+	frameCodecNone byte = iota
+	frameCodecSnappy
+	frameCodecZstd
+)
+
+// maxFrameMessages bounds the number of messages decoded from one frame
+const maxFrameMessages = 1 << 16
+
+// maxFrameBytes bounds the decompressed size of a frame, matching the
+// cluster's default gRPC message limit, so that a small compressed frame
+// cannot expand without bound
+const maxFrameBytes = 100 << 20
+
+// CompressionConfig controls compression and coalescing of append messages
+// between nodes in different regions. Same-region traffic is never
+// compressed or delayed.
+type CompressionConfig struct {
+	// Algorithm is used for region pairs without an entry in Pairs
+	Algorithm string                  `json:"algorithm"`
+	Pairs     []RegionPairCompression `json:"pairs,omitempty"`
+	// MinBytes is the smallest frame worth compressing
+	MinBytes int `json:"min_bytes"`
+	// BatchLatencyBudget is how long an append may wait to be coalesced
+	// with later ones for the same peer; zero disables batching
+	BatchLatencyBudget time.Duration `json:"batch_latency_budget"`
+	// BatchMaxBytes flushes a batch once it holds this many bytes
+	BatchMaxBytes int `json:"batch_max_bytes"`
+}
+
+// RegionPairCompression selects the algorithm between two regions, in both
+// directions
+type RegionPairCompression struct {
+	Regions   [2]string `json:"regions"`
+	Algorithm string    `json:"algorithm"`
+}
+
+// CompressionStats are the cross-region append totals of one region pair.
+// Ratio is raw bytes over sent bytes.
+type CompressionStats struct {
+	Algorithm  string  `json:"algorithm"`
+	Messages   int64   `json:"messages"`
+	Frames     int64   `json:"frames"`
+	RawBytes   int64   `json:"raw_bytes"`
+	SentBytes  int64   `json:"sent_bytes"`
+	BytesSaved int64   `json:"bytes_saved"`
+	Ratio      float64 `json:"ratio"`
+}
+
+// algorithm returns the algorithm configured between two regions
+func (c CompressionConfig) algorithm(from, to string) string {
+	if from == to {
+		return CompressionNone
+	}
+	for _, pair := range c.Pairs {
+		if (pair.Regions[0] == from && pair.Regions[1] == to) || (pair.Regions[0] == to && pair.Regions[1] == from) {
+			return pair.Algorithm
+		}
+	}
+	if c.Algorithm == "" {
+		return CompressionNone
+	}
+	return c.Algorithm
+}
+
+// validCompression reports whether an algorithm name is known
+func validCompression(algorithm string) bool {
+	switch algorithm {
+	case "", CompressionNone, CompressionSnappy, CompressionZstd:
+		return true
+	}
+	return false
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodec returns the shared zstd encoder and decoder, which are safe for
+// concurrent EncodeAll and DecodeAll calls
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		if zstdErr == nil {
+			zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxFrameBytes))
+		}
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// EncodeAppends frames append messages from one node to another. Between
+// regions the frame is compressed with the pair's algorithm, and the pair's
+// compression statistics are updated. Frames from or to a node that is not
+// registered are not compressed. A single message that is not compressed is
+// returned unframed.
+func (g *GeoEtcdRaft) EncodeAppends(from, to uint64, messages [][]byte) ([]byte, error) {
+	g.mu.RLock()
+	fromNode, toNode := g.nodes[from], g.nodes[to]
+	if fromNode == nil || toNode == nil {
+		g.mu.RUnlock()
+		return encodeFrame(CompressionNone, messages, frameBody(messages))
+	}
+	fromRegion, toRegion := fromNode.Location.Region, toNode.Location.Region
+	config := g.config.Compression
+	g.mu.RUnlock()
+
+	body := frameBody(messages)
+	configured := config.algorithm(fromRegion, toRegion)
+	algorithm := configured
+	if len(body) < config.MinBytes {
+		algorithm = CompressionNone
+	}
+
+	frame, err := encodeFrame(algorithm, messages, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if fromRegion != toRegion {
+		g.mu.Lock()
+		g.metrics.CrossRegionMessages += int64(len(messages))
+		key := regionPairKey(fromRegion, toRegion)
+		stats := g.metrics.Compression[key]
+		stats.Algorithm = configured
+		stats.Messages += int64(len(messages))
+		stats.Frames++
+		stats.RawBytes += int64(len(body))
+		stats.SentBytes += int64(len(frame))
+		stats.BytesSaved = stats.RawBytes - stats.SentBytes
+		if stats.SentBytes > 0 {
+			stats.Ratio = float64(stats.RawBytes) / float64(stats.SentBytes)
+		}
+		g.metrics.Compression[key] = stats
+		g.mu.Unlock()
+	}
+
+	return frame, nil
+}
+
+// DecodeAppends returns the append messages of a frame built by
+// EncodeAppends. A payload that is not a frame is returned as the only
+// message.
+func DecodeAppends(frame []byte) ([][]byte, error) {
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("empty append frame")
+	}
+	if frame[0] != frameMagic {
+		return [][]byte{frame}, nil
+	}
+	if len(frame) < 2 {
+		return nil, fmt.Errorf("truncated append frame")
+	}
+
+	var body []byte
+	var err error
+	data := frame[2:]
+	switch frame[1] {
+	case frameCodecNone:
+		body = data
+	case frameCodecSnappy:
+		var size int
+		if size, err = snappy.DecodedLen(data); err == nil && size > maxFrameBytes {
+			return nil, fmt.Errorf("append frame decompresses to %d bytes, more than %d", size, maxFrameBytes)
+		}
+		if err == nil {
+			body, err = snappy.Decode(nil, data)
+		}
+	case frameCodecZstd:
+		var decoder *zstd.Decoder
+		if _, decoder, err = zstdCodec(); err == nil {
+			body, err = decoder.DecodeAll(data, nil)
+		}
+	default:
+		return nil, fmt.Errorf("unknown append frame codec %d", frame[1])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress append frame: %v", err)
+	}
+
+	var messages [][]byte
+	for len(body) > 0 {
+		size, n := binary.Uvarint(body)
+		if n <= 0 || size > uint64(len(body)-n) {
+			return nil, fmt.Errorf("truncated append frame")
+		}
+		if len(messages) == maxFrameMessages {
+			return nil, fmt.Errorf("append frame holds more than %d messages", maxFrameMessages)
+		}
+		messages = append(messages, body[n:n+int(size)])
+		body = body[n+int(size):]
+	}
+	return messages, nil
+}
+
+// frameBody concatenates length-prefixed messages
+func frameBody(messages [][]byte) []byte {
+	size := 0
+	for _, message := range messages {
+		size += binary.MaxVarintLen64 + len(message)
+	}
+	body := make([]byte, 0, size)
+	for _, message := range messages {
+		body = binary.AppendUvarint(body, uint64(len(message)))
+		body = append(body, message...)
+	}
+	return body
+}
+
+// encodeFrame returns the payload that carries messages. A single message
+// that is not compressed is sent unframed, so that traffic needing neither
+// compression nor batching stays readable by any orderer.
+func encodeFrame(algorithm string, messages [][]byte, body []byte) ([]byte, error) {
+	if (algorithm == "" || algorithm == CompressionNone) && len(messages) == 1 &&
+		len(messages[0]) > 0 && messages[0][0] != frameMagic {
+		return messages[0], nil
+	}
+	return compressFrame(algorithm, body)
+}
+
+// compressFrame prefixes the frame header and compresses the body
+func compressFrame(algorithm string, body []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionSnappy:
+		return append([]byte{frameMagic, frameCodecSnappy}, snappy.Encode(nil, body)...), nil
+	case CompressionZstd:
+		encoder, _, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("zstd unavailable: %v", err)
+		}
+		return encoder.EncodeAll(body, []byte{frameMagic, frameCodecZstd}), nil
+	case "", CompressionNone:
+		return append([]byte{frameMagic, frameCodecNone}, body...), nil
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm %q", algorithm)
+	}
+}
+
+// AppendBatcher coalesces small append messages from the local node to
+// each peer in another region for at most the configured latency budget.
+// Each peer has its own queue, whose lock is held while its frames are sent
+// so messages to a peer keep their order, whether batched or sent at once
+// with SubmitNow, while a slow peer does not hold up the others.
+type AppendBatcher struct {
+	chain *GeoEtcdRaft
+	from  uint64
+	send  func(to uint64, frame []byte) error
+
+	mu     sync.Mutex
+	peers  map[uint64]*appendBatch
+	closed bool
+}
+
+// appendBatch is the messages waiting for one peer
+type appendBatch struct {
+	mu       sync.Mutex
+	messages [][]byte
+	bytes    int
+	timer    *time.Timer
+	closed   bool
+	// err is the failure of a flush run by the timer, returned by the next
+	// submit to the peer so that the caller learns the peer is unreachable
+	err error
+}
+
+// NewAppendBatcher returns a batcher for messages sent by node from, or by
+// the chain's local node if from is zero. send delivers an encoded frame to
+// a peer.
+func (g *GeoEtcdRaft) NewAppendBatcher(from uint64, send func(to uint64, frame []byte) error) *AppendBatcher {
+	return &AppendBatcher{
+		chain: g,
+		from:  from,
+		send:  send,
+		peers: make(map[uint64]*appendBatch),
+	}
+}
+
+// Submit queues an append message for a peer. Same-region messages, and
+// all messages when batching is disabled, are sent at once along with
+// anything already queued for the peer. If the last timed flush to the peer
+// failed, its error is returned.
+func (b *AppendBatcher) Submit(to uint64, message []byte) error {
+	return b.submit(to, message, false)
+}
+
+// SubmitNow sends a message to a peer at once, after anything already
+// queued for it
+func (b *AppendBatcher) SubmitNow(to uint64, message []byte) error {
+	return b.submit(to, message, true)
+}
+
+// submit queues a message and sends the peer's batch if it is due or now is
+// set
+func (b *AppendBatcher) submit(to uint64, message []byte, now bool) error {
+	b.chain.mu.RLock()
+	config := b.chain.config.Compression
+	fromNode, toNode := b.chain.nodes[b.sender()], b.chain.nodes[to]
+	crossRegion := fromNode != nil && toNode != nil && fromNode.Location.Region != toNode.Location.Region
+	b.chain.mu.RUnlock()
+
+	batch, err := b.peer(to)
+	if err != nil {
+		return err
+	}
+
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	if batch.closed {
+		return fmt.Errorf("append batcher is closed")
+	}
+	flushErr := batch.err
+	batch.err = nil
+	batch.messages = append(batch.messages, message)
+	batch.bytes += len(message)
+
+	if now || !crossRegion || config.BatchLatencyBudget <= 0 || (config.BatchMaxBytes > 0 && batch.bytes >= config.BatchMaxBytes) {
+		if err := b.deliver(to, batch.take()); err != nil {
+			return err
+		}
+		return flushErr
+	}
+	if batch.timer == nil {
+		batch.timer = time.AfterFunc(config.BatchLatencyBudget, func() { b.flushTimed(to, batch) })
+	}
+	return flushErr
+}
+
+// peer returns the queue of a peer, creating it on first use
+func (b *AppendBatcher) peer(to uint64) (*appendBatch, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, fmt.Errorf("append batcher is closed")
+	}
+	batch := b.peers[to]
+	if batch == nil {
+		batch = &appendBatch{}
+		b.peers[to] = batch
+	}
+	return batch, nil
+}
+
+// flushTimed sends a peer's batch once its latency budget ran out, keeping
+// the error for the next submit to the peer
+func (b *AppendBatcher) flushTimed(to uint64, batch *appendBatch) {
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	if err := b.deliver(to, batch.take()); err != nil {
+		batch.err = err
+	}
+}
+
+// Flush sends the messages queued for a peer
+func (b *AppendBatcher) Flush(to uint64) error {
+	b.mu.Lock()
+	batch := b.peers[to]
+	b.mu.Unlock()
+	if batch == nil {
+		return nil
+	}
+
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	return b.deliver(to, batch.take())
+}
+
+// Close sends everything still queued and rejects further messages
+func (b *AppendBatcher) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	peers := make(map[uint64]*appendBatch, len(b.peers))
+	for to, batch := range b.peers {
+		peers[to] = batch
+	}
+	b.mu.Unlock()
+
+	var firstErr error
+	for to, batch := range peers {
+		batch.mu.Lock()
+		batch.closed = true
+		if err := b.deliver(to, batch.take()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		batch.mu.Unlock()
+	}
+	return firstErr
+}
+
+// take empties the batch and returns its messages. Callers must hold
+// batch.mu.
+func (batch *appendBatch) take() [][]byte {
+	if batch.timer != nil {
+		batch.timer.Stop()
+		batch.timer = nil
+	}
+	messages := batch.messages
+	batch.messages, batch.bytes = nil, 0
+	return messages
+}
+
+// sender returns the node the batcher sends as. Callers must hold
+// b.chain.mu.
+func (b *AppendBatcher) sender() uint64 {
+	if b.from != 0 {
+		return b.from
+	}
+	return b.chain.localNodeID
+}
+
+// deliver encodes and sends messages to a peer. Callers must hold the
+// peer's batch lock.
+func (b *AppendBatcher) deliver(to uint64, messages [][]byte) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	b.chain.mu.RLock()
+	from := b.sender()
+	b.chain.mu.RUnlock()
+
+	frame, err := b.chain.EncodeAppends(from, to, messages)
+	if err != nil {
+		return err
+	}
+	if err := b.send(to, frame); err != nil {
+		logger.Warningf("Failed to send %d append messages to node %d: %v", len(messages), to, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Documented GeoConfig defaults, see docs/architecture.md
+const (
+	defaultLatencyThreshold = 500 * time.Millisecond
+	defaultRegionWeight     = 2.0
+	defaultProximityWeight  = 1.5
+	defaultCrossRegionRatio = 0.3
+)
+
+// NewGeoConfig returns a GeoConfig with the documented defaults. Callers
+// decoding a configuration file should decode over it so that omitted
+// settings keep their defaults.
+func NewGeoConfig() *GeoConfig {
+	return &GeoConfig{
+		LatencyThreshold:   defaultLatencyThreshold,
+		RegionWeight:       defaultRegionWeight,
+		ProximityWeight:    defaultProximityWeight,
+		LoadBalanceEnabled: true,
+		CrossRegionRatio:   defaultCrossRegionRatio,
+		AdaptiveTimeout:    true,
+		HierarchicalMode:   true,
+		LatencyWindow:      defaultLatencyWindow,
+		ScoringMode:        ScoringModeProximity,
+	}
+}
+
+// Clone returns a deep copy of the configuration. Decoding over a clone
+// never writes to the slices and maps of the original, which running chains
+// and concurrent readers may hold.
+func (c *GeoConfig) Clone() *GeoConfig {
+	clone := *c
+	clone.TopologyLabels = append([]TopologyLabel(nil), c.TopologyLabels...)
+	clone.Compression.Pairs = append([]RegionPairCompression(nil), c.Compression.Pairs...)
+	clone.Cost.Prices = append([]RegionPairPrice(nil), c.Cost.Prices...)
+	clone.API.AllowedOrigins = append([]string(nil), c.API.AllowedOrigins...)
+	clone.API.AdminOUs = append([]string(nil), c.API.AdminOUs...)
+	clone.API.AdminCommonNames = append([]string(nil), c.API.AdminCommonNames...)
+	clone.API.ReaderOUs = append([]string(nil), c.API.ReaderOUs...)
+	clone.API.Tokens = append([]APIToken(nil), c.API.Tokens...)
+	clone.API.TLS.ClientCAFiles = append([]string(nil), c.API.TLS.ClientCAFiles...)
+	if c.Channels != nil {
+		clone.Channels = make(map[string]json.RawMessage, len(c.Channels))
+		for channelID, override := range c.Channels {
+			clone.Channels[channelID] = append(json.RawMessage(nil), override...)
+		}
+	}
+	return &clone
+}
+
+// Redacted returns a copy of the configuration without the API section,
+// which holds the token digests, admin identities and TLS key paths. Views
+// served to readers show the redacted configuration.
+func (c *GeoConfig) Redacted() *GeoConfig {
+	redacted := c.Clone()
+	redacted.API = APIConfig{}
+	return redacted
+}
+
+// FieldError is an invalid GeoConfig setting. Value is nil if the setting
+// could not be decoded.
+type FieldError struct {
+	Field  string
+	Value  interface{}
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("%s %s", e.Field, e.Reason)
+	}
+	if value, ok := e.Value.(string); ok {
+		return fmt.Sprintf("%s %s (got %q)", e.Field, e.Reason, value)
+	}
+	return fmt.Sprintf("%s %s (got %v)", e.Field, e.Reason, e.Value)
+}
+
+// ConfigError lists every invalid setting of a GeoConfig
+type ConfigError struct {
+	Fields []*FieldError
+}
+
+func (e *ConfigError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return "invalid GeoConfig: " + strings.Join(messages, "; ")
+}
+
+// configValidator collects the invalid settings of a config
+type configValidator struct {
+	fields []*FieldError
+}
+
+func (v *configValidator) invalid(field string, value interface{}, reason string) {
+	v.fields = append(v.fields, &FieldError{Field: field, Value: value, Reason: reason})
+}
+
+// Validate checks every setting and returns a *ConfigError listing all
+// invalid ones, or nil. Channel overrides are checked on the effective
+// channel config; settings a channel inherits are only reported once.
+func (c *GeoConfig) Validate() error {
+	v := &configValidator{}
+	c.validate(v)
+
+	inherited := make(map[string]bool, len(v.fields))
+	for _, field := range v.fields {
+		inherited[field.Error()] = true
+	}
+
+	channels := make([]string, 0, len(c.Channels))
+	for channelID := range c.Channels {
+		channels = append(channels, channelID)
+	}
+	sort.Strings(channels)
+	for _, channelID := range channels {
+		field := fmt.Sprintf("Channels[%s]", channelID)
+		effective := c.Clone()
+		effective.Channels = nil
+		if err := applyConfigOverride(effective, c.Channels[channelID]); err != nil {
+			v.invalid(field, nil, fmt.Sprintf("is not a valid override: %v", err))
+			continue
+		}
+		channel := &configValidator{}
+		effective.validateChannel(channel)
+		for _, invalid := range channel.fields {
+			if !inherited[invalid.Error()] {
+				invalid.Field = field + "." + invalid.Field
+				v.fields = append(v.fields, invalid)
+			}
+		}
+	}
+
+	if len(v.fields) > 0 {
+		return &ConfigError{Fields: v.fields}
+	}
+	return nil
+}
+
+// validate checks the consenter-wide and channel settings
+func (c *GeoConfig) validate(v *configValidator) {
+	c.validateChannel(v)
+
+	switch c.Tracing.Exporter {
+	case TraceExporterNone, TraceExporterOTLP, TraceExporterStdout:
+	case TraceExporterFile:
+		if c.Tracing.FilePath == "" {
+			v.invalid("Tracing.FilePath", c.Tracing.FilePath, "is required by the file exporter")
+		}
+	default:
+		v.invalid("Tracing.Exporter", c.Tracing.Exporter, fmt.Sprintf("must be one of %q, %q or %q", TraceExporterOTLP, TraceExporterFile, TraceExporterStdout))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.invalid("Tracing.SampleRatio", c.Tracing.SampleRatio, "must be between 0 and 1")
+	}
+
+	if c.CarbonSource.File != "" && c.CarbonSource.URL != "" {
+		v.invalid("CarbonSource.URL", c.CarbonSource.URL, "must not be set together with CarbonSource.File")
+	}
+	if c.CarbonSource.URL != "" && !strings.HasPrefix(c.CarbonSource.URL, "http://") && !strings.HasPrefix(c.CarbonSource.URL, "https://") {
+		v.invalid("CarbonSource.URL", c.CarbonSource.URL, "must be an http or https URL")
+	}
+	if c.CarbonSource.RefreshInterval < 0 {
+		v.invalid("CarbonSource.RefreshInterval", c.CarbonSource.RefreshInterval, "must not be negative")
+	}
+
+	for i, token := range c.API.Tokens {
+		field := fmt.Sprintf("API.Tokens[%d]", i)
+		if token.Name == "" {
+			v.invalid(field+".Name", token.Name, "must not be empty")
+		}
+		if digest, err := hex.DecodeString(token.SHA256); err != nil || len(digest) != 32 {
+			v.invalid(field+".SHA256", token.SHA256, "must be a hex-encoded SHA-256 digest")
+		}
+		if _, err := parseAPIRole(token.Role); err != nil {
+			v.invalid(field+".Role", token.Role, "must be admin or reader")
+		}
+	}
+}
+
+// validateChannel checks the settings a channel override can change
+func (c *GeoConfig) validateChannel(v *configValidator) {
+	if c.LatencyThreshold <= 0 {
+		v.invalid("LatencyThreshold", c.LatencyThreshold, "must be positive")
+	}
+	if c.RegionWeight <= 0 {
+		v.invalid("RegionWeight", c.RegionWeight, "must be positive")
+	}
+	if c.ProximityWeight < 0 {
+		v.invalid("ProximityWeight", c.ProximityWeight, "must not be negative")
+	}
+	if c.CrossRegionRatio < 0 || c.CrossRegionRatio > 1 {
+		v.invalid("CrossRegionRatio", c.CrossRegionRatio, "must be between 0 and 1")
+	}
+	if c.LatencyWindow < 0 {
+		v.invalid("LatencyWindow", c.LatencyWindow, "must not be negative")
+	}
+
+	switch c.ScoringMode {
+	case "", ScoringModeProximity, ScoringModeTailLatency, ScoringModeQuorumLatency:
+	default:
+		v.invalid("ScoringMode", c.ScoringMode, fmt.Sprintf("must be one of %q, %q or %q", ScoringModeProximity, ScoringModeTailLatency, ScoringModeQuorumLatency))
+	}
+
+	compression := c.Compression
+	if !validCompression(compression.Algorithm) {
+		v.invalid("Compression.Algorithm", compression.Algorithm, fmt.Sprintf("must be one of %q, %q or %q", CompressionNone, CompressionSnappy, CompressionZstd))
+	}
+	for i, pair := range compression.Pairs {
+		field := fmt.Sprintf("Compression.Pairs[%d]", i)
+		if pair.Regions[0] == "" || pair.Regions[1] == "" {
+			v.invalid(field+".Regions", fmt.Sprint(pair.Regions), "must name two regions")
+		}
+		if !validCompression(pair.Algorithm) {
+			v.invalid(field+".Algorithm", pair.Algorithm, fmt.Sprintf("must be one of %q, %q or %q", CompressionNone, CompressionSnappy, CompressionZstd))
+		}
+	}
+	if compression.MinBytes < 0 {
+		v.invalid("Compression.MinBytes", compression.MinBytes, "must not be negative")
+	}
+	if compression.BatchLatencyBudget < 0 {
+		v.invalid("Compression.BatchLatencyBudget", compression.BatchLatencyBudget, "must not be negative")
+	} else if compression.BatchLatencyBudget >= c.LatencyThreshold && c.LatencyThreshold > 0 {
+		v.invalid("Compression.BatchLatencyBudget", compression.BatchLatencyBudget, "must be below LatencyThreshold")
+	}
+	if compression.BatchMaxBytes < 0 {
+		v.invalid("Compression.BatchMaxBytes", compression.BatchMaxBytes, "must not be negative")
+	}
+
+	if c.Cost.Weight < 0 {
+		v.invalid("Cost.Weight", c.Cost.Weight, "must not be negative")
+	}
+	if c.Cost.DefaultPricePerGB < 0 {
+		v.invalid("Cost.DefaultPricePerGB", c.Cost.DefaultPricePerGB, "must not be negative")
+	}
+	for i, price := range c.Cost.Prices {
+		field := fmt.Sprintf("Cost.Prices[%d]", i)
+		if price.Regions[0] == "" || price.Regions[1] == "" {
+			v.invalid(field+".Regions", fmt.Sprint(price.Regions), "must name two regions")
+		}
+		if price.PricePerGB < 0 {
+			v.invalid(field+".PricePerGB", price.PricePerGB, "must not be negative")
+		}
+	}
+
+	if c.Degraded.SustainedFor < 0 {
+		v.invalid("Degraded.SustainedFor", c.Degraded.SustainedFor, "must not be negative")
+	}
+	if c.Degraded.RecoverAfter < 0 {
+		v.invalid("Degraded.RecoverAfter", c.Degraded.RecoverAfter, "must not be negative")
+	}
+	if c.Degraded.TimeoutFactor != 0 && c.Degraded.TimeoutFactor < 1 {
+		v.invalid("Degraded.TimeoutFactor", c.Degraded.TimeoutFactor, "must be at least 1")
+	}
+
+	if c.Carbon.Weight < 0 {
+		v.invalid("Carbon.Weight", c.Carbon.Weight, "must not be negative")
+	} else if c.LatencyThreshold > 0 && c.Carbon.Weight > c.LatencyThreshold.Seconds() {
+		v.invalid("Carbon.Weight", c.Carbon.Weight, fmt.Sprintf("must not exceed LatencyThreshold in seconds (%g)", c.LatencyThreshold.Seconds()))
+	}
+	if c.Carbon.EnergyPerGB < 0 {
+		v.invalid("Carbon.EnergyPerGB", c.Carbon.EnergyPerGB, "must not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i, label := range c.TopologyLabels {
+		field := fmt.Sprintf("TopologyLabels[%d]", i)
+		if label.Name == "" {
+			v.invalid(field+".Name", label.Name, "must not be empty")
+		} else if names[label.Name] {
+			v.invalid(field+".Name", label.Name, "is listed more than once")
+		}
+		names[label.Name] = true
+		if label.Affinity < 0 {
+			v.invalid(field+".Affinity", label.Affinity, "must not be negative")
+		}
+	}
+}
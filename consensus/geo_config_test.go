@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGeoConfigMatchesDocumentedDefaults(t *testing.T) {
+	// The defaults listed under Configuration Parameters in
+	// docs/architecture.md
+	config := NewGeoConfig()
+	require.NoError(t, config.Validate())
+
+	require.Equal(t, 500*time.Millisecond, config.LatencyThreshold)
+	require.Equal(t, 2.0, config.RegionWeight)
+	require.Equal(t, 1.5, config.ProximityWeight)
+	require.True(t, config.LoadBalanceEnabled)
+	require.Equal(t, 0.3, config.CrossRegionRatio)
+	require.True(t, config.AdaptiveTimeout)
+	require.True(t, config.HierarchicalMode)
+	require.Equal(t, 5*time.Minute, config.LatencyWindow)
+	require.Equal(t, ScoringModeProximity, config.ScoringMode)
+	require.Equal(t, TraceExporterNone, config.Tracing.Exporter)
+	require.Empty(t, config.ElectionLogFile)
+	require.Equal(t, []TopologyLabel{{Name: LabelRegion, Affinity: 2.0}, {Name: LabelZone, Affinity: 1.5}}, config.topologyLabels())
+	require.Zero(t, config.CatchUpMaxLag)
+	require.Equal(t, CompressionNone, config.Compression.algorithm("us-east", "eu-west"))
+	require.Empty(t, config.Cost.Prices)
+	require.Zero(t, config.Cost.Weight)
+	require.Zero(t, config.Carbon.Weight)
+	require.Equal(t, 0.06, config.Carbon.energyPerGB())
+	require.Equal(t, time.Minute, config.Degraded.sustainedFor())
+	require.Equal(t, 2*time.Minute, config.Degraded.recoverAfter())
+	require.Equal(t, 2.0, config.Degraded.timeoutFactor())
+	require.Empty(t, config.CarbonSource.location())
+	require.Zero(t, config.CarbonSource.RefreshInterval)
+	require.Equal(t, 15*time.Minute, defaultCarbonRefreshInterval)
+	require.Empty(t, config.Channels)
+}
+
+func TestValidateReportsEveryInvalidField(t *testing.T) {
+	config := NewGeoConfig()
+	config.LatencyThreshold = 0
+	config.ProximityWeight = -1
+	config.CrossRegionRatio = 1.5
+	config.ScoringMode = "fastest"
+	config.Compression.MinBytes = -1
+	config.Degraded.TimeoutFactor = 0.5
+	config.TopologyLabels = []TopologyLabel{{Name: "zone", Affinity: 1}, {Name: "zone", Affinity: -1}}
+	config.Tracing.Exporter = "jaeger"
+	config.Tracing.SampleRatio = 2
+	config.API.Tokens = []APIToken{{SHA256: "zz", Role: "root"}}
+	config.Channels = map[string]json.RawMessage{
+		"eu":  json.RawMessage(`{"region_weight":-2}`),
+		"bad": json.RawMessage(`{"api":{}}`),
+	}
+
+	_, err := NewGeoConsenter(config)
+	var configErr *ConfigError
+	require.True(t, errors.As(err, &configErr), "%v", err)
+
+	// Settings a channel inherits are only reported for the global config
+	expected := []*FieldError{
+		{Field: "LatencyThreshold", Value: config.LatencyThreshold, Reason: "must be positive"},
+		{Field: "ProximityWeight", Value: config.ProximityWeight, Reason: "must not be negative"},
+		{Field: "CrossRegionRatio", Value: config.CrossRegionRatio, Reason: "must be between 0 and 1"},
+		{Field: "ScoringMode", Value: config.ScoringMode, Reason: fmt.Sprintf("must be one of %q, %q or %q", ScoringModeProximity, ScoringModeTailLatency, ScoringModeQuorumLatency)},
+		{Field: "Compression.MinBytes", Value: config.Compression.MinBytes, Reason: "must not be negative"},
+		{Field: "Degraded.TimeoutFactor", Value: config.Degraded.TimeoutFactor, Reason: "must be at least 1"},
+		{Field: "TopologyLabels[1].Name", Value: "zone", Reason: "is listed more than once"},
+		{Field: "TopologyLabels[1].Affinity", Value: -1.0, Reason: "must not be negative"},
+		{Field: "Tracing.Exporter", Value: config.Tracing.Exporter, Reason: fmt.Sprintf("must be one of %q, %q or %q", TraceExporterOTLP, TraceExporterFile, TraceExporterStdout)},
+		{Field: "Tracing.SampleRatio", Value: config.Tracing.SampleRatio, Reason: "must be between 0 and 1"},
+		{Field: "API.Tokens[0].Name", Value: "", Reason: "must not be empty"},
+		{Field: "API.Tokens[0].SHA256", Value: "zz", Reason: "must be a hex-encoded SHA-256 digest"},
+		{Field: "API.Tokens[0].Role", Value: "root", Reason: "must be admin or reader"},
+		{Field: "Channels[bad]", Reason: "is not a valid override: api cannot be overridden per channel"},
+		{Field: "Channels[eu].RegionWeight", Value: -2.0, Reason: "must be positive"},
+	}
+	require.Equal(t, expected, configErr.Fields)
+
+	require.Equal(t, "LatencyThreshold must be positive (got 0s)", configErr.Fields[0].Error())
+	require.Equal(t, "API.Tokens[0].SHA256 must be a hex-encoded SHA-256 digest (got \"zz\")", configErr.Fields[11].Error())
+	require.Equal(t, "Channels[bad] is not a valid override: api cannot be overridden per channel", configErr.Fields[13].Error())
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric/common/flogging"
 	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 var consenterLogger = flogging.MustGetLogger("geo-consenter")
@@ -21,6 +25,23 @@ type GeoConsenter struct {
 	config      *GeoConfig
 	metrics     *ConsenterMetrics
 	httpServer  *http.Server
+	registry    *prometheus.Registry
+	tracerProvider *sdktrace.TracerProvider
+	events      *eventBroker
+	audit       *auditLog
+	elections   *electionLog
+	carbon      *carbonIntensity
+	chainBuilder RaftChainBuilder
+	
+	// Number of /placement searches in progress
+	placements  int
+	
+	// Lifecycle of the consenter goroutines
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+	startOnce   sync.Once
+	haltOnce    sync.Once
 }
 
 // ConsenterMetrics tracks overall consenter performance
@@ -32,23 +53,84 @@ type ConsenterMetrics struct {
 	ChainMetrics    map[string]*GeoMetrics `json:"chain_metrics"`
 }
 
-// NewGeoConsenter creates a new geo-aware consenter
-func NewGeoConsenter(config *GeoConfig) *GeoConsenter {
+// NewGeoConsenter creates a new geo-aware consenter. It returns a
+// *ConfigError if the configuration is invalid.
+func NewGeoConsenter(config *GeoConfig) (*GeoConsenter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	
 	consenter := &GeoConsenter{
 		chains:  make(map[string]*GeoEtcdRaft),
 		config:  config,
 		metrics: &ConsenterMetrics{
 			ChainMetrics: make(map[string]*GeoMetrics),
 		},
+		events:  newEventBroker(),
+	}
+	consenter.ctx, consenter.cancel = context.WithCancel(context.Background())
+	consenter.registry = newPrometheusRegistry(consenter)
+	
+	// Set up ordering path tracing
+	tracerProvider, err := newTracerProvider(config.Tracing)
+	if err != nil {
+		consenterLogger.Errorf("Tracing disabled: %v", err)
+	}
+	consenter.tracerProvider = tracerProvider
+	
+	// Set up the admin API audit log
+	audit, err := newAuditLog(config.API.AuditLogFile)
+	if err != nil {
+		consenterLogger.Errorf("Admin audit records will not be persisted: %v", err)
 	}
+	consenter.audit = audit
 	
-	// Start metrics collection
-	go consenter.collectMetrics()
+	// Set up the leader election history
+	elections, err := newElectionLog(config.ElectionLogFile)
+	if err != nil {
+		consenterLogger.Errorf("Election records will not be persisted: %v", err)
+	}
+	consenter.elections = elections
 	
-	// Start HTTP API server for monitoring
-	consenter.startHTTPServer()
+	// Load the regional carbon intensities
+	consenter.carbon = &carbonIntensity{}
+	if err := consenter.carbon.load(consenter.ctx, config.CarbonSource); err != nil {
+		consenterLogger.Errorf("Carbon intensities unavailable until the next refresh: %v", err)
+	}
 	
-	return consenter
+	return consenter, nil
+}
+
+// Start starts metrics collection and the HTTP API server. The consenter
+// halts when ctx is done or Halt is called. Start returns an error if the
+// API listener cannot be opened; calling it again has no effect.
+func (gc *GeoConsenter) Start(ctx context.Context) error {
+	var err error
+	gc.startOnce.Do(func() {
+		// Start HTTP API server for monitoring
+		if err = gc.startHTTPServer(); err != nil {
+			return
+		}
+		
+		// Start metrics collection
+		gc.wg.Add(1)
+		go gc.collectMetrics(gc.ctx)
+		
+		// Keep the carbon intensities current
+		gc.wg.Add(1)
+		go gc.refreshCarbon(gc.ctx)
+		
+		// Halt everything once the caller's context is done. The watcher
+		// is not tracked by wg because Halt waits on wg.
+		go func() {
+			select {
+			case <-ctx.Done():
+				gc.Halt()
+			case <-gc.ctx.Done():
+			}
+		}()
+	})
+	return err
 }
 
 // HandleChain creates and manages a new consensus chain
@@ -57,12 +139,35 @@ func (gc *GeoConsenter) HandleChain(support consensus.ConsenterSupport, metadata
 	
 	consenterLogger.Infof("Creating new geo-aware chain for channel: %s", chainID)
 	
-	// Create base etcdraft chain (this would integrate with actual Fabric etcdraft)
-	// For this example, we'll simulate the base chain creation
-	baseChain := &etcdraft.Chain{} // This should be properly initialized
+	gc.mu.RLock()
+	builder := gc.chainBuilder
+	gc.mu.RUnlock()
+	if builder == nil {
+		return nil, fmt.Errorf("no raft chain builder set for channel %s", chainID)
+	}
+	
+	// Create geo-enhanced chain with the channel's overrides applied
+	config, err := gc.currentConfig().ForChannel(chainID)
+	if err != nil {
+		return nil, err
+	}
+	geoChain := NewGeoEtcdRaft(nil, config)
+	if gc.tracerProvider != nil {
+		geoChain.EnableTracing(gc.tracerProvider, chainID)
+	}
+	
+	// Build the base etcdraft chain on the geo layer's support and transport
+	baseChain, err := newRaftChain(builder, geoChain, support)
+	if err != nil {
+		geoChain.Halt()
+		return nil, fmt.Errorf("failed to create raft chain for channel %s: %v", chainID, err)
+	}
+	geoChain.Chain = baseChain
 	
-	// Create geo-enhanced chain
-	geoChain := NewGeoEtcdRaft(baseChain, gc.config)
+	geoChain.attachEvents(gc.events, chainID)
+	geoChain.attachElectionLog(gc.elections)
+	geoChain.UseCarbonSource(gc.carbon)
+	geoChain.attachLifecycle(gc.ctx, func() { gc.removeChain(chainID, geoChain) })
 	
 	// Initialize with default geo-nodes (these would come from network configuration)
 	gc.initializeGeoNodes(geoChain, chainID)
@@ -72,6 +177,10 @@ func (gc *GeoConsenter) HandleChain(support consensus.ConsenterSupport, metadata
 	gc.metrics.ActiveChains = len(gc.chains)
 	gc.mu.Unlock()
 	
+	gc.events.publish(chainID, EventChainCreated, map[string]interface{}{
+		"nodes": len(geoChain.nodes),
+	})
+	
 	consenterLogger.Infof("Successfully created geo-aware chain for channel: %s", chainID)
 	
 	return geoChain, nil
@@ -144,8 +253,11 @@ func (gc *GeoConsenter) initializeGeoNodes(chain *GeoEtcdRaft, chainID string) {
 	}
 }
 
-// collectMetrics continuously collects metrics from all chains
-func (gc *GeoConsenter) collectMetrics() {
+// collectMetrics continuously collects metrics from all chains until ctx
+// is done
+func (gc *GeoConsenter) collectMetrics(ctx context.Context) {
+	defer gc.wg.Done()
+	
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 	
@@ -153,6 +265,8 @@ func (gc *GeoConsenter) collectMetrics() {
 		select {
 		case <-ticker.C:
 			gc.updateConsenterMetrics()
+		case <-ctx.Done():
+			return
 		}
 	}
 }
@@ -170,42 +284,101 @@ func (gc *GeoConsenter) updateConsenterMetrics() {
 	}
 }
 
-// startHTTPServer starts the monitoring HTTP server
-func (gc *GeoConsenter) startHTTPServer() {
+// startHTTPServer opens the API listener and serves the monitoring HTTP
+// server until the consenter halts
+func (gc *GeoConsenter) startHTTPServer() error {
 	mux := http.NewServeMux()
 	
-	// Metrics endpoint
-	mux.HandleFunc("/metrics", gc.handleMetrics)
+	// Prometheus metrics endpoint
+	mux.Handle("/metrics", gc.authorize(RoleReader, promhttp.HandlerFor(gc.registry, promhttp.HandlerOpts{})))
+	
+	// JSON metrics endpoint
+	mux.Handle("/metrics/json", gc.authorize(RoleReader, http.HandlerFunc(gc.handleMetrics)))
 	
 	// Topology endpoint
-	mux.HandleFunc("/topology", gc.handleTopology)
+	mux.Handle("/topology", gc.authorize(RoleReader, http.HandlerFunc(gc.handleTopology)))
 	
 	// Health check endpoint
-	mux.HandleFunc("/health", gc.handleHealth)
+	mux.Handle("/health", gc.authorize(RoleNone, http.HandlerFunc(gc.handleHealth)))
 	
 	// Chain-specific metrics
-	mux.HandleFunc("/chains", gc.handleChains)
+	mux.Handle("/chains", gc.authorize(RoleReader, http.HandlerFunc(gc.handleChains)))
+	
+	// Leader election history
+	mux.Handle("/chains/elections", gc.authorize(RoleReader, http.HandlerFunc(gc.handleElections)))
+	
+	// Current leadership scores
+	mux.Handle("/chains/explain", gc.authorize(RoleReader, http.HandlerFunc(gc.handleExplain)))
+	
+	// Catch-up source selection for lagging nodes
+	mux.Handle("/chains/catchup", gc.authorize(RoleReader, http.HandlerFunc(gc.handleCatchUp)))
+	
+	// What-if planning of topology changes
+	mux.Handle("/chains/whatif", gc.authorize(RoleReader, http.HandlerFunc(gc.handleWhatIf)))
+	
+	// Orderer placement advisor
+	mux.Handle("/placement", gc.authorize(RoleReader, http.HandlerFunc(gc.handlePlacement)))
+	
+	// Live topology event stream
+	mux.Handle("/events", gc.authorize(RoleReader, http.HandlerFunc(gc.handleEvents)))
+	
+	// Admin write API
+	gc.registerAdminHandlers(mux)
+	
+	tlsConfig, err := buildTLSConfig(gc.config.API.TLS)
+	if err != nil {
+		// Never fall back to plain HTTP when TLS was requested
+		return fmt.Errorf("geo-consensus monitoring server not started: %v", err)
+	}
 	
-	gc.httpServer = &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	address := gc.config.API.ListenAddress
+	if address == "" {
+		address = DefaultAPIListenAddress
 	}
 	
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", address, err)
+	}
+	
+	server := &http.Server{
+		Addr:      address,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+		BaseContext: func(net.Listener) context.Context {
+			return gc.ctx
+		},
+	}
+	gc.mu.Lock()
+	gc.httpServer = server
+	gc.mu.Unlock()
+	
+	gc.wg.Add(1)
 	go func() {
-		consenterLogger.Infof("Starting geo-consensus monitoring server on :8080")
-		if err := gc.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		defer gc.wg.Done()
+		
+		var err error
+		if tlsConfig != nil {
+			consenterLogger.Infof("Starting geo-consensus monitoring server on %s (TLS, client auth: %v)", listener.Addr(), tlsConfig.ClientAuth)
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			consenterLogger.Infof("Starting geo-consensus monitoring server on %s", listener.Addr())
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			consenterLogger.Errorf("HTTP server error: %v", err)
 		}
 	}()
+	
+	return nil
 }
 
-// handleMetrics serves aggregated metrics
+// handleMetrics serves aggregated metrics as JSON
 func (gc *GeoConsenter) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	gc.mu.RLock()
 	defer gc.mu.RUnlock()
 	
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	
 	response := map[string]interface{}{
 		"timestamp":        time.Now(),
@@ -223,11 +396,20 @@ func (gc *GeoConsenter) handleMetrics(w http.ResponseWriter, r *http.Request) {
 
 // handleTopology serves network topology information
 func (gc *GeoConsenter) handleTopology(w http.ResponseWriter, r *http.Request) {
+	switch format := r.URL.Query().Get("format"); format {
+	case "", TopologyFormatJSON:
+	case TopologyFormatGeoJSON, TopologyFormatDOT:
+		gc.writeTopologyExport(w, format, r.URL.Query().Get("channel"))
+		return
+	default:
+		http.Error(w, fmt.Sprintf("Unknown topology format %q", format), http.StatusBadRequest)
+		return
+	}
+	
 	gc.mu.RLock()
 	defer gc.mu.RUnlock()
 	
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	
 	topology := make(map[string]interface{})
 	
@@ -247,16 +429,26 @@ func (gc *GeoConsenter) handleTopology(w http.ResponseWriter, r *http.Request) {
 func (gc *GeoConsenter) handleHealth(w http.ResponseWriter, r *http.Request) {
 	gc.mu.RLock()
 	activeChains := len(gc.chains)
+	chains := make(map[string]*GeoEtcdRaft, len(gc.chains))
+	for chainID, chain := range gc.chains {
+		chains[chainID] = chain
+	}
 	gc.mu.RUnlock()
 	
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	
+	status := "healthy"
+	degraded := degradedChains(chains)
+	if len(degraded) > 0 {
+		status = "degraded"
+	}
 	
 	health := map[string]interface{}{
-		"status":        "healthy",
-		"timestamp":     time.Now(),
-		"active_chains": activeChains,
-		"uptime":        time.Since(time.Now().Add(-time.Hour)), // Placeholder
+		"status":          status,
+		"timestamp":       time.Now(),
+		"active_chains":   activeChains,
+		"degraded_chains": degraded,
+		"uptime":          time.Since(time.Now().Add(-time.Hour)), // Placeholder
 	}
 	
 	json.NewEncoder(w).Encode(health)
@@ -268,7 +460,6 @@ func (gc *GeoConsenter) handleChains(w http.ResponseWriter, r *http.Request) {
 	defer gc.mu.RUnlock()
 	
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	
 	chainID := r.URL.Query().Get("id")
 	
@@ -276,10 +467,12 @@ func (gc *GeoConsenter) handleChains(w http.ResponseWriter, r *http.Request) {
 		// Return specific chain information
 		if chain, exists := gc.chains[chainID]; exists {
 			response := map[string]interface{}{
-				"chain_id":  chainID,
-				"metrics":   chain.GetMetrics(),
-				"topology":  chain.GetTopology(),
-				"timestamp": time.Now(),
+				"chain_id":        chainID,
+				"metrics":         chain.GetMetrics(),
+				"topology":        chain.GetTopology(),
+				"config":          chain.Config().Redacted(),
+				"config_override": gc.config.Channels[chainID],
+				"timestamp":       time.Now(),
 			}
 			json.NewEncoder(w).Encode(response)
 		} else {
@@ -290,8 +483,10 @@ func (gc *GeoConsenter) handleChains(w http.ResponseWriter, r *http.Request) {
 		chains := make(map[string]interface{})
 		for id, chain := range gc.chains {
 			chains[id] = map[string]interface{}{
-				"metrics":  chain.GetMetrics(),
-				"topology": chain.GetTopology(),
+				"metrics":         chain.GetMetrics(),
+				"topology":        chain.GetTopology(),
+				"config":          chain.Config().Redacted(),
+				"config_override": gc.config.Channels[id],
 			}
 		}
 		
@@ -303,29 +498,106 @@ func (gc *GeoConsenter) handleChains(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Shutdown gracefully shuts down the consenter
-func (gc *GeoConsenter) Shutdown() error {
-	consenterLogger.Info("Shutting down geo-aware consenter")
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// HaltChain halts a single channel and removes it from the consenter
+func (gc *GeoConsenter) HaltChain(chainID string) error {
+	gc.mu.RLock()
+	chain, exists := gc.chains[chainID]
+	gc.mu.RUnlock()
 	
-	if gc.httpServer != nil {
-		if err := gc.httpServer.Shutdown(ctx); err != nil {
-			consenterLogger.Errorf("Error shutting down HTTP server: %v", err)
-			return err
-		}
+	if !exists {
+		return fmt.Errorf("chain %s not found", chainID)
 	}
 	
-	// Clean up chains
+	chain.Halt()
+	return nil
+}
+
+// removeChain forgets a halted chain. It runs once the chain has halted,
+// whether it was halted on its own or by the consenter.
+func (gc *GeoConsenter) removeChain(chainID string, chain *GeoEtcdRaft) {
 	gc.mu.Lock()
-	for chainID := range gc.chains {
-		delete(gc.chains, chainID)
+	if gc.chains[chainID] != chain {
+		gc.mu.Unlock()
+		return
 	}
+	delete(gc.chains, chainID)
+	delete(gc.metrics.ChainMetrics, chainID)
+	gc.metrics.ActiveChains = len(gc.chains)
 	gc.mu.Unlock()
 	
-	consenterLogger.Info("Geo-aware consenter shutdown complete")
-	return nil
+	reason := "channel halted"
+	if gc.ctx.Err() != nil {
+		reason = "consenter shutdown"
+	}
+	gc.events.publish(chainID, EventChainHalted, map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// Halt stops the HTTP server, all chains and the metrics collection, and
+// waits for every goroutine started by the consenter to exit. It is safe
+// to call more than once.
+func (gc *GeoConsenter) Halt() error {
+	var haltErr error
+	gc.haltOnce.Do(func() {
+		consenterLogger.Info("Shutting down geo-aware consenter")
+		
+		// Cancelling first ends event streams so the server can drain
+		gc.cancel()
+		
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		
+		gc.mu.RLock()
+		server := gc.httpServer
+		gc.mu.RUnlock()
+		
+		if server != nil {
+			if err := server.Shutdown(ctx); err != nil {
+				consenterLogger.Errorf("Error shutting down HTTP server: %v", err)
+				server.Close()
+				haltErr = err
+			}
+		}
+		
+		// Halt chains
+		gc.mu.RLock()
+		chains := make([]*GeoEtcdRaft, 0, len(gc.chains))
+		for _, chain := range gc.chains {
+			chains = append(chains, chain)
+		}
+		gc.mu.RUnlock()
+		
+		for _, chain := range chains {
+			chain.Halt()
+		}
+		
+		gc.wg.Wait()
+		
+		if gc.tracerProvider != nil {
+			if err := gc.tracerProvider.Shutdown(ctx); err != nil {
+				consenterLogger.Errorf("Error flushing traces: %v", err)
+			}
+		}
+		
+		gc.events.close()
+		
+		if err := gc.audit.close(); err != nil {
+			consenterLogger.Errorf("Error closing audit log: %v", err)
+		}
+		
+		if err := gc.elections.close(); err != nil {
+			consenterLogger.Errorf("Error closing election log: %v", err)
+		}
+		
+		consenterLogger.Info("Geo-aware consenter shutdown complete")
+	})
+	return haltErr
+}
+
+// Shutdown gracefully shuts down the consenter
+func (gc *GeoConsenter) Shutdown() error {
+	return gc.Halt()
 }
 
 // GetMetrics returns overall consenter metrics
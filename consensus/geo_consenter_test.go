@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.uber.org/goleak"
+)
+
+// testChainBuilder records what HandleChain builds chains with. Its chains
+// are nil, so only the geo layer runs.
+type testChainBuilder struct {
+	opts     etcdraft.Options
+	rpc      testRPC
+	support  consensus.ConsenterSupport
+	chainRPC etcdraft.RPC
+	applied  []etcdraft.Options
+}
+
+func (b *testChainBuilder) RaftOptions(support consensus.ConsenterSupport) (etcdraft.Options, error) {
+	return b.opts, nil
+}
+
+func (b *testChainBuilder) RPC(channelID string) etcdraft.RPC { return &b.rpc }
+
+func (b *testChainBuilder) NewChain(support consensus.ConsenterSupport, opts etcdraft.Options, rpc etcdraft.RPC) (*etcdraft.Chain, error) {
+	b.support, b.chainRPC = support, rpc
+	return nil, nil
+}
+
+func (b *testChainBuilder) ApplyTimeouts(chain *etcdraft.Chain, opts etcdraft.Options) error {
+	b.applied = append(b.applied, opts)
+	return nil
+}
+
+// freeAddress returns a local address nothing listens on
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestConsenterHaltStopsAllGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	config := NewGeoConfig()
+	config.API.ListenAddress = freeAddress(t)
+	config.API.AnonymousAccess = true
+	gc, err := NewGeoConsenter(config)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, gc.Start(ctx))
+
+	gc.UseRaftChainBuilder(&testChainBuilder{})
+	for _, channelID := range []string{"ch1", "ch2"} {
+		chain, err := gc.HandleChain(&testSupport{channelID: channelID}, nil)
+		require.NoError(t, err)
+		chain.Start()
+	}
+	require.NoError(t, gc.HaltChain("ch1"))
+
+	// A connected event stream must not hold up the shutdown
+	resp, err := http.Get(fmt.Sprintf("http://%s/events", config.API.ListenAddress))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, gc.Halt())
+	require.Empty(t, gc.chains)
+	http.DefaultClient.CloseIdleConnections()
+}
+
+func TestHandleChainWiresGeoLayerIntoRaftChain(t *testing.T) {
+	gc, err := NewGeoConsenter(NewGeoConfig())
+	require.NoError(t, err)
+	defer gc.Halt()
+
+	_, err = gc.HandleChain(&testSupport{channelID: "ch1"}, nil)
+	require.EqualError(t, err, "no raft chain builder set for channel ch1")
+
+	builder := &testChainBuilder{opts: etcdraft.Options{RaftID: 2, TickInterval: 100 * time.Millisecond, HeartbeatTick: 1, ElectionTick: 10}}
+	gc.UseRaftChainBuilder(builder)
+	support := &testSupport{channelID: "ch1"}
+	chain, err := gc.HandleChain(support, nil)
+	require.NoError(t, err)
+	geoChain := chain.(*GeoEtcdRaft)
+
+	require.Equal(t, uint64(2), geoChain.localNodeID)
+	require.Equal(t, ConsensusTimeouts{HeartbeatInterval: 100 * time.Millisecond, ElectionTimeout: time.Second}, geoChain.Timeouts())
+
+	// Raft messages go out through the geo transport
+	require.IsType(t, &geoRPC{}, builder.chainRPC)
+	require.NoError(t, builder.chainRPC.SendConsensus(1, raftRequest(t, raftpb.Message{Type: raftpb.MsgHeartbeat, From: 2, To: 1})))
+	require.Len(t, builder.rpc.sent, 1)
+
+	// Written blocks reach the geo layer before the ledger
+	block, _ := testBlock(t, 3)
+	builder.support.WriteBlock(block, raftMetadata(t, 9))
+	require.Len(t, support.written, 1)
+	require.Equal(t, int64(1), geoChain.GetMetrics().EgressCost.Blocks)
+}
+
+func TestHandleChainAppliesDegradedTimeouts(t *testing.T) {
+	gc, err := NewGeoConsenter(NewGeoConfig())
+	require.NoError(t, err)
+	defer gc.Halt()
+
+	builder := &testChainBuilder{opts: etcdraft.Options{RaftID: 1, TickInterval: 200 * time.Millisecond, HeartbeatTick: 2, ElectionTick: 20}}
+	gc.UseRaftChainBuilder(builder)
+	chain, err := gc.HandleChain(&testSupport{channelID: "ch1"}, nil)
+	require.NoError(t, err)
+	geoChain := chain.(*GeoEtcdRaft)
+
+	geoChain.timeoutHook(ConsensusTimeouts{HeartbeatInterval: 1200 * time.Millisecond, ElectionTimeout: 12 * time.Second})
+	geoChain.timeoutHook(ConsensusTimeouts{HeartbeatInterval: 400 * time.Millisecond, ElectionTimeout: 4 * time.Second})
+	require.Equal(t, []etcdraft.Options{
+		{RaftID: 1, TickInterval: 200 * time.Millisecond, HeartbeatTick: 6, ElectionTick: 60},
+		{RaftID: 1, TickInterval: 200 * time.Millisecond, HeartbeatTick: 2, ElectionTick: 20},
+	}, builder.applied)
+}
+
+func TestRaftTimeoutOptionsRoundsUpToWholeTicks(t *testing.T) {
+	opts := etcdraft.Options{TickInterval: 500 * time.Millisecond, HeartbeatTick: 1, ElectionTick: 10}
+
+	scaled := raftTimeoutOptions(opts, ConsensusTimeouts{HeartbeatInterval: 750 * time.Millisecond, ElectionTimeout: 7600 * time.Millisecond})
+	require.Equal(t, 2, scaled.HeartbeatTick)
+	require.Equal(t, 16, scaled.ElectionTick)
+
+	// The election timeout always outlasts the heartbeat
+	short := raftTimeoutOptions(opts, ConsensusTimeouts{HeartbeatInterval: time.Millisecond, ElectionTimeout: time.Millisecond})
+	require.Equal(t, 1, short.HeartbeatTick)
+	require.Equal(t, 2, short.ElectionTick)
+
+	// Without a tick interval there is nothing to scale
+	require.Equal(t, etcdraft.Options{HeartbeatTick: 1}, raftTimeoutOptions(etcdraft.Options{HeartbeatTick: 1}, ConsensusTimeouts{ElectionTimeout: time.Second}))
+}
@@ -0,0 +1,136 @@
+package main
+
+import "time"
+
+// costMonth is the period egress costs are projected over
+const costMonth = 30 * 24 * time.Hour
+
+// bytesPerGB converts bytes to the decimal gigabytes clouds bill egress in
+const bytesPerGB = 1e9
+
+// CostConfig prices the network egress of consensus traffic between
+// regions. Same-region traffic is free unless a pair lists the region twice.
+type CostConfig struct {
+	// Weight scales the cost penalty in leader scoring; zero reports costs
+	// without affecting elections
+	Weight float64 `json:"weight"`
+	// DefaultPricePerGB applies between regions without an entry in Prices
+	DefaultPricePerGB float64           `json:"default_price_per_gb"`
+	Prices            []RegionPairPrice `json:"prices,omitempty"`
+}
+
+// RegionPairPrice is the egress price between two regions, in both
+// directions, per gigabyte
+type RegionPairPrice struct {
+	Regions    [2]string `json:"regions"`
+	PricePerGB float64   `json:"price_per_gb"`
+}
+
+// EgressCostEstimate is the consensus egress the channel's observed blocks
+// produce. MonthlyCost projects the cost of replicating them from each node
+// as leader to every other node at the observed rate.
+type EgressCostEstimate struct {
+	Blocks            int64              `json:"blocks"`
+	BlockBytes        int64              `json:"block_bytes"`
+	Since             time.Time          `json:"since"`
+	BytesPerSecond    float64            `json:"bytes_per_second"`
+	MonthlyCost       map[uint64]float64 `json:"monthly_cost"`
+	LeaderMonthlyCost float64            `json:"leader_monthly_cost"`
+}
+
+// price returns the egress price per gigabyte between two regions
+func (c CostConfig) price(from, to string) float64 {
+	for _, pair := range c.Prices {
+		if (pair.Regions[0] == from && pair.Regions[1] == to) || (pair.Regions[0] == to && pair.Regions[1] == from) {
+			return pair.PricePerGB
+		}
+	}
+	if from == to {
+		return 0
+	}
+	return c.DefaultPricePerGB
+}
+
+// ObserveBlock records a block cut by the channel. The support returned by
+// WrapSupport calls it for every block written. The byte rate is averaged
+// since the first observed block.
+func (g *GeoEtcdRaft) ObserveBlock(transactions int, bytes int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.metrics.TotalTransactions += int64(transactions)
+	estimate := &g.metrics.EgressCost
+	if estimate.Blocks == 0 {
+		estimate.Since = g.now()
+	}
+	estimate.Blocks++
+	estimate.BlockBytes += int64(bytes)
+	g.metrics.Carbon.EmissionsGrams += g.replicationEmissions(g.leaderID(), float64(bytes))
+}
+
+// blockBytesPerSecond is the observed rate of block bytes. Callers must hold g.mu.
+func (g *GeoEtcdRaft) blockBytesPerSecond() float64 {
+	estimate := g.metrics.EgressCost
+	elapsed := g.now().Sub(estimate.Since)
+	if estimate.Blocks < 2 || elapsed <= 0 {
+		return 0
+	}
+	return float64(estimate.BlockBytes) / elapsed.Seconds()
+}
+
+// monthlyEgressCost projects the monthly cost of replicating the observed
+// blocks with a node as leader. Callers must hold g.mu.
+func (g *GeoEtcdRaft) monthlyEgressCost(leaderID uint64) float64 {
+	leader := g.nodes[leaderID]
+	if leader == nil {
+		return 0
+	}
+
+	pricePerGB := 0.0
+	for followerID, follower := range g.nodes {
+		if followerID != leaderID {
+			pricePerGB += g.config.Cost.price(leader.Location.Region, follower.Location.Region)
+		}
+	}
+	return g.blockBytesPerSecond() * costMonth.Seconds() / bytesPerGB * pricePerGB
+}
+
+// monthlyEgressCosts returns the projected monthly egress cost of every node
+// as leader. Callers must hold g.mu.
+func (g *GeoEtcdRaft) monthlyEgressCosts() map[uint64]float64 {
+	costs := make(map[uint64]float64, len(g.nodes))
+	for nodeID := range g.nodes {
+		costs[nodeID] = g.monthlyEgressCost(nodeID)
+	}
+	return costs
+}
+
+// costPenalty is Cost.Weight times a node's projected egress cost relative to
+// the most expensive node, so the penalty stays within [0, Weight] whatever
+// the currency and traffic. Callers must hold g.mu.
+func (g *GeoEtcdRaft) costPenalty(nodeID uint64) float64 {
+	if g.config.Cost.Weight <= 0 {
+		return 0
+	}
+
+	costs := g.monthlyEgressCosts()
+	highest := 0.0
+	for _, cost := range costs {
+		if cost > highest {
+			highest = cost
+		}
+	}
+	if highest == 0 {
+		return 0
+	}
+	return g.config.Cost.Weight * costs[nodeID] / highest
+}
+
+// updateEgressCost refreshes the projected egress costs in the metrics.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) updateEgressCost() {
+	estimate := &g.metrics.EgressCost
+	estimate.BytesPerSecond = g.blockBytesPerSecond()
+	estimate.MonthlyCost = g.monthlyEgressCosts()
+	estimate.LeaderMonthlyCost = estimate.MonthlyCost[g.leaderID()]
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrittenBlocksMoveEgressEstimate(t *testing.T) {
+	chain := newTestChain(t)
+	chain.config.Cost.DefaultPricePerGB = 0.02
+	chain.nodes[1].IsLeader = true
+	clock := NewVirtualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	chain.SetClock(clock)
+	support := chain.WrapSupport(&testSupport{})
+
+	first, _ := testBlock(t, 0, &cb.Envelope{Payload: []byte("one")}, &cb.Envelope{Payload: []byte("two")})
+	support.WriteBlock(first, raftMetadata(t, 3))
+	chain.mu.Lock()
+	require.Zero(t, chain.monthlyEgressCost(1))
+	chain.mu.Unlock()
+
+	// Blocks count even when their raft metadata cannot be read
+	clock.Advance(10 * time.Second)
+	second, _ := testBlock(t, 1, &cb.Envelope{Payload: []byte("three")})
+	support.WriteConfigBlock(second, []byte("not raft metadata"))
+
+	metrics := chain.GetMetrics()
+	require.Equal(t, int64(2), metrics.EgressCost.Blocks)
+	require.Equal(t, int64(3), metrics.TotalTransactions)
+	bytes := int64(proto.Size(first) + proto.Size(second))
+	require.Equal(t, bytes, metrics.EgressCost.BlockBytes)
+
+	chain.mu.Lock()
+	defer chain.mu.Unlock()
+	require.InDelta(t, float64(bytes)/10, chain.blockBytesPerSecond(), 1e-9)
+	require.InDelta(t, float64(bytes)/10*costMonth.Seconds()/bytesPerGB*2*0.02, chain.monthlyEgressCost(1), 1e-12)
+}
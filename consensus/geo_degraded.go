@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+)
+
+// Consensus timeouts outside degraded mode until UseRaftOptions is called,
+// matching the etcdraft defaults of a 500ms tick, one tick per heartbeat and
+// ten per election
+const (
+	defaultHeartbeatInterval = 500 * time.Millisecond
+	defaultElectionTimeout   = 5 * time.Second
+)
+
+// Degraded mode defaults, see DegradedModeConfig
+const (
+	defaultDegradedSustainedFor  = time.Minute
+	defaultDegradedRecoverAfter  = 2 * time.Minute
+	defaultDegradedTimeoutFactor = 2.0
+)
+
+// Reasons a channel enters degraded mode
+const (
+	DegradedQuorumCommitLatency = "quorum_commit_latency"
+	DegradedLeaderLatency       = "leader_latency"
+)
+
+// DegradedModeConfig controls when a channel whose latencies exceed
+// LatencyThreshold is declared degraded and when it recovers
+type DegradedModeConfig struct {
+	// SustainedFor is how long the threshold must be exceeded before the
+	// channel degrades
+	SustainedFor time.Duration `json:"sustained_for"`
+	// RecoverAfter is how long latencies must stay within the threshold
+	// before the channel recovers
+	RecoverAfter time.Duration `json:"recover_after"`
+	// TimeoutFactor multiplies the consensus timeouts while degraded when
+	// AdaptiveTimeout is enabled
+	TimeoutFactor float64 `json:"timeout_factor"`
+}
+
+// ConsensusTimeouts are the timeouts the raft integration should run with
+type ConsensusTimeouts struct {
+	HeartbeatInterval time.Duration `json:"heartbeat_interval"`
+	ElectionTimeout   time.Duration `json:"election_timeout"`
+}
+
+// DegradedStatus is whether a channel is in degraded mode and why. Breaches
+// lists the current threshold breaches, which may not yet have lasted long
+// enough to degrade the channel.
+type DegradedStatus struct {
+	Active        bool              `json:"active"`
+	Since         time.Time         `json:"since,omitempty"`
+	Reasons       []string          `json:"reasons,omitempty"`
+	Breaches      []string          `json:"breaches,omitempty"`
+	BreachingFrom time.Time         `json:"breaching_from,omitempty"`
+	HealthyFrom   time.Time         `json:"healthy_from,omitempty"`
+	Entries       int64             `json:"entries"`
+	Timeouts      ConsensusTimeouts `json:"timeouts"`
+}
+
+func (c DegradedModeConfig) sustainedFor() time.Duration {
+	if c.SustainedFor > 0 {
+		return c.SustainedFor
+	}
+	return defaultDegradedSustainedFor
+}
+
+func (c DegradedModeConfig) recoverAfter() time.Duration {
+	if c.RecoverAfter > 0 {
+		return c.RecoverAfter
+	}
+	return defaultDegradedRecoverAfter
+}
+
+func (c DegradedModeConfig) timeoutFactor() float64 {
+	if c.TimeoutFactor > 0 {
+		return c.TimeoutFactor
+	}
+	return defaultDegradedTimeoutFactor
+}
+
+// UseRaftOptions takes the local node and the consensus timeouts outside
+// degraded mode from the options the etcdraft chain runs with: the heartbeat
+// interval is HeartbeatTick ticks and the election timeout ElectionTick
+// ticks. Options without ticks keep the etcdraft defaults.
+func (g *GeoEtcdRaft) UseRaftOptions(opts etcdraft.Options) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if opts.RaftID != 0 {
+		g.localNodeID = opts.RaftID
+	}
+	if opts.TickInterval > 0 && opts.HeartbeatTick > 0 {
+		g.baseTimeouts.HeartbeatInterval = opts.TickInterval * time.Duration(opts.HeartbeatTick)
+	}
+	if opts.TickInterval > 0 && opts.ElectionTick > 0 {
+		g.baseTimeouts.ElectionTimeout = opts.TickInterval * time.Duration(opts.ElectionTick)
+	}
+	g.metrics.Degraded.Timeouts = g.timeouts()
+}
+
+// OnTimeoutsChanged sets a hook called with the new consensus timeouts
+// whenever entering or leaving degraded mode changes them, so that the raft
+// integration can apply them. The hook runs on the measurement goroutine
+// without the chain's lock held.
+func (g *GeoEtcdRaft) OnTimeoutsChanged(hook func(ConsensusTimeouts)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.timeoutHook = hook
+}
+
+// Timeouts returns the consensus timeouts for the channel's current mode
+func (g *GeoEtcdRaft) Timeouts() ConsensusTimeouts {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.timeouts()
+}
+
+// timeouts returns the consensus timeouts, lengthened while degraded.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) timeouts() ConsensusTimeouts {
+	timeouts := g.baseTimeouts
+	if g.metrics.Degraded.Active && g.config.AdaptiveTimeout {
+		factor := g.config.Degraded.timeoutFactor()
+		timeouts.HeartbeatInterval = time.Duration(float64(timeouts.HeartbeatInterval) * factor)
+		timeouts.ElectionTimeout = time.Duration(float64(timeouts.ElectionTimeout) * factor)
+	}
+	return timeouts
+}
+
+// latencyBreaches returns what currently exceeds LatencyThreshold: the
+// leader's quorum commit latency and each node's latency to the leader.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) latencyBreaches() []string {
+	leaderID := g.leaderID()
+	if leaderID == 0 || g.config.LatencyThreshold <= 0 {
+		return nil
+	}
+
+	var breaches []string
+	if g.metrics.QuorumCommitLatency[leaderID] > g.config.LatencyThreshold {
+		breaches = append(breaches, DegradedQuorumCommitLatency)
+	}
+	for _, nodeID := range g.nodeIDs() {
+		if nodeID != leaderID && g.pairLatency(nodeID, leaderID) > g.config.LatencyThreshold {
+			breaches = append(breaches, fmt.Sprintf("%s:%d", DegradedLeaderLatency, nodeID))
+		}
+	}
+	return breaches
+}
+
+// updateDegradedMode checks the latest measurements against LatencyThreshold.
+// A channel that breaches it for SustainedFor enters degraded mode: its
+// timeouts are lengthened, leadership is re-evaluated and an alert event is
+// published. It recovers once no breach has been seen for RecoverAfter.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) updateDegradedMode() {
+	now := g.now()
+	status := &g.metrics.Degraded
+	status.Breaches = g.latencyBreaches()
+
+	if len(status.Breaches) > 0 {
+		status.HealthyFrom = time.Time{}
+		if status.BreachingFrom.IsZero() {
+			status.BreachingFrom = now
+		}
+		if !status.Active && now.Sub(status.BreachingFrom) >= g.config.Degraded.sustainedFor() {
+			g.enterDegradedMode(now)
+		}
+	} else {
+		status.BreachingFrom = time.Time{}
+		if status.Active {
+			if status.HealthyFrom.IsZero() {
+				status.HealthyFrom = now
+			}
+			if now.Sub(status.HealthyFrom) >= g.config.Degraded.recoverAfter() {
+				g.exitDegradedMode(now)
+			}
+		}
+	}
+
+	status.Timeouts = g.timeouts()
+}
+
+// enterDegradedMode declares the channel degraded. Callers must hold g.mu.
+func (g *GeoEtcdRaft) enterDegradedMode(now time.Time) {
+	status := &g.metrics.Degraded
+	status.Active = true
+	status.Since = now
+	status.Reasons = append([]string(nil), status.Breaches...)
+	status.Entries++
+
+	previousID := g.leaderID()
+	leaderID := previousID
+	if candidates := g.rankCandidates(g.nodeIDs()); len(candidates) > 0 {
+		leaderID = candidates[0].NodeID
+		g.updateLeaderElection(leaderID, "degraded", candidates)
+	}
+	timeouts := g.timeouts()
+
+	logger.Warningf("Channel %s entered degraded mode: %v exceeded %s for %s; leader %d, election timeout %s",
+		g.channelID, status.Reasons, g.config.LatencyThreshold, now.Sub(status.BreachingFrom), leaderID, timeouts.ElectionTimeout)
+
+	g.events.publish(g.channelID, EventDegradedModeEntered, map[string]interface{}{
+		"reasons":             status.Reasons,
+		"threshold_ms":        g.config.LatencyThreshold.Milliseconds(),
+		"quorum_commit_ms":    g.metrics.QuorumCommitLatency[previousID].Milliseconds(),
+		"previous_leader_id":  previousID,
+		"leader_id":           leaderID,
+		"heartbeat_ms":        timeouts.HeartbeatInterval.Milliseconds(),
+		"election_timeout_ms": timeouts.ElectionTimeout.Milliseconds(),
+	})
+}
+
+// exitDegradedMode restores normal operation. Callers must hold g.mu.
+func (g *GeoEtcdRaft) exitDegradedMode(now time.Time) {
+	status := &g.metrics.Degraded
+	duration := now.Sub(status.Since)
+	reasons := status.Reasons
+
+	status.Active = false
+	status.Since = time.Time{}
+	status.Reasons = nil
+	status.HealthyFrom = time.Time{}
+
+	logger.Infof("Channel %s recovered from degraded mode after %s", g.channelID, duration)
+
+	g.events.publish(g.channelID, EventDegradedModeRecovered, map[string]interface{}{
+		"reasons":     reasons,
+		"duration_ms": duration.Milliseconds(),
+	})
+}
+
+// degradedChains returns the IDs of the chains in degraded mode
+func degradedChains(chains map[string]*GeoEtcdRaft) []string {
+	var degraded []string
+	for chainID, chain := range chains {
+		if chain.GetMetrics().Degraded.Active {
+			degraded = append(degraded, chainID)
+		}
+	}
+	sort.Strings(degraded)
+	return degraded
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+	"github.com/stretchr/testify/require"
+)
+
+// stepLatency reports the same latency between every pair of nodes, changed
+// by the test between rounds
+type stepLatency struct {
+	latency time.Duration
+}
+
+func (f *stepLatency) Latency(from, to uint64, at time.Time) (time.Duration, bool) {
+	return f.latency, true
+}
+
+func TestDegradedModeScalesRaftTimeouts(t *testing.T) {
+	chain := newTestChain(t)
+	chain.config.AdaptiveTimeout = true
+	chain.config.LatencyThreshold = 500 * time.Millisecond
+	chain.config.Degraded = DegradedModeConfig{SustainedFor: time.Minute, RecoverAfter: time.Minute, TimeoutFactor: 3}
+	chain.nodes[1].IsLeader = true
+	clock := NewVirtualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	chain.SetClock(clock)
+	latency := &stepLatency{latency: 100 * time.Millisecond}
+	chain.UseLatencySource(latency)
+
+	chain.UseRaftOptions(etcdraft.Options{RaftID: 2, TickInterval: 200 * time.Millisecond, HeartbeatTick: 2, ElectionTick: 20})
+	base := ConsensusTimeouts{HeartbeatInterval: 400 * time.Millisecond, ElectionTimeout: 4 * time.Second}
+	require.Equal(t, base, chain.Timeouts())
+	require.Equal(t, uint64(2), chain.localNodeID)
+
+	var changes []ConsensusTimeouts
+	chain.OnTimeoutsChanged(func(timeouts ConsensusTimeouts) {
+		// The hook may read the chain
+		require.Equal(t, timeouts, chain.Timeouts())
+		changes = append(changes, timeouts)
+	})
+	round := func() {
+		chain.updateNetworkMetrics()
+		clock.Advance(30 * time.Second)
+	}
+
+	round()
+	latency.latency = 800 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		round()
+	}
+	require.True(t, chain.GetMetrics().Degraded.Active)
+	degraded := ConsensusTimeouts{HeartbeatInterval: 1200 * time.Millisecond, ElectionTimeout: 12 * time.Second}
+	require.Equal(t, []ConsensusTimeouts{degraded}, changes)
+
+	latency.latency = 100 * time.Millisecond
+	for i := 0; i < 4; i++ {
+		round()
+	}
+	require.False(t, chain.GetMetrics().Degraded.Active)
+	require.Equal(t, []ConsensusTimeouts{degraded, base}, changes)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// eligible reports whether the node may be elected leader
+func (n *GeoNode) eligible() bool {
+	return !n.LeadershipBlocked && !n.Draining
+}
+
+// DrainNode marks a node as draining, which excludes it from leader
+// candidacy until UndrainNode, and if it leads hands leadership to the
+// nearest eligible node. It returns the leader after draining and the
+// successors that were considered, nearest first. A leader without an
+// eligible successor is left as it was. Like TransferLeadership this moves
+// the geo layer's leader at once; it does not ask etcdraft to transfer raft
+// leadership.
+func (g *GeoEtcdRaft) DrainNode(nodeID uint64) (uint64, []uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node := g.nodes[nodeID]
+	if node == nil {
+		return 0, nil, fmt.Errorf("node %d is not registered", nodeID)
+	}
+	var successors []uint64
+	if node.IsLeader {
+		if successors = g.drainSuccessors(nodeID); len(successors) == 0 {
+			return nodeID, nil, fmt.Errorf("no eligible successor for node %d", nodeID)
+		}
+	}
+	if !node.Draining {
+		node.Draining = true
+		g.events.publish(g.channelID, EventNodeDraining, map[string]interface{}{
+			"node_id":   nodeID,
+			"region":    node.Location.Region,
+			"is_leader": node.IsLeader,
+		})
+	}
+	if !node.IsLeader {
+		return g.leaderID(), nil, nil
+	}
+
+	g.updateLeaderElection(successors[0], "drain", g.rankCandidates(g.nodeIDs()))
+	return successors[0], successors, nil
+}
+
+// UndrainNode makes a drained node eligible for leadership again. It does
+// not move leadership back.
+func (g *GeoEtcdRaft) UndrainNode(nodeID uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node := g.nodes[nodeID]
+	if node == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
+	}
+	if node.Draining {
+		node.Draining = false
+		g.events.publish(g.channelID, EventNodeUndrained, map[string]interface{}{
+			"node_id": nodeID,
+			"region":  node.Location.Region,
+		})
+	}
+	return nil
+}
+
+// drainSuccessors returns the eligible nodes that can take over from a
+// draining node, ordered by proximity to it so that leadership moves as
+// short a distance as possible. Ties go to the better leadership score.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) drainSuccessors(nodeID uint64) []uint64 {
+	var candidates []uint64
+	for otherID := range g.nodes {
+		if otherID != nodeID {
+			candidates = append(candidates, otherID)
+		}
+	}
+
+	ranked := g.rankCandidates(candidates)
+	scores := make(map[uint64]float64, len(ranked))
+	successors := make([]uint64, 0, len(ranked))
+	for _, candidate := range ranked {
+		scores[candidate.NodeID] = candidate.Score
+		successors = append(successors, candidate.NodeID)
+	}
+
+	proximity := g.proximityMatrix[nodeID]
+	sort.SliceStable(successors, func(i, j int) bool {
+		if proximity[successors[i]] != proximity[successors[j]] {
+			return proximity[successors[i]] > proximity[successors[j]]
+		}
+		return scores[successors[i]] > scores[successors[j]]
+	})
+	return successors
+}
+
+// predictSuccessor returns the node that would lead if nodeID were drained
+func (g *GeoEtcdRaft) predictSuccessor(nodeID uint64) uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	successors := g.drainSuccessors(nodeID)
+	if len(successors) == 0 {
+		return 0
+	}
+	return successors[0]
+}
+
+// isDraining reports whether a node is registered and draining
+func (g *GeoEtcdRaft) isDraining(nodeID uint64) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	node := g.nodes[nodeID]
+	return node != nil && node.Draining
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainWithoutSuccessorDrainsNothing(t *testing.T) {
+	movable, stuck := newTestChain(t), newTestChain(t)
+	for _, chain := range []*GeoEtcdRaft{movable, stuck} {
+		chain.nodes[1].IsLeader = true
+	}
+	require.NoError(t, stuck.SetLeadershipBlocked(2, true))
+	require.NoError(t, stuck.SetLeadershipBlocked(3, true))
+	gc := &GeoConsenter{chains: map[string]*GeoEtcdRaft{"a-movable": movable, "b-stuck": stuck}}
+
+	for _, dryRun := range []bool{true, false} {
+		_, err := gc.adminDrainNode(&adminRequest{NodeID: 1}, dryRun)
+		require.Error(t, err)
+		require.Equal(t, http.StatusConflict, err.(*adminError).status)
+	}
+	for _, chain := range []*GeoEtcdRaft{movable, stuck} {
+		require.False(t, chain.isDraining(1))
+		require.Equal(t, uint64(1), chain.currentLeader())
+	}
+
+	// Draining the stuck chain directly leaves it untouched as well
+	leaderID, _, err := stuck.DrainNode(1)
+	require.Error(t, err)
+	require.Equal(t, uint64(1), leaderID)
+	require.False(t, stuck.isDraining(1))
+
+	// With a successor the drain goes ahead
+	require.NoError(t, stuck.SetLeadershipBlocked(2, false))
+	result, err := gc.adminDrainNode(&adminRequest{NodeID: 1}, false)
+	require.NoError(t, err)
+	require.Equal(t, true, result["draining"])
+	// The response reports the geo layer's new leader
+	changes := result["chains"].(map[string]interface{})
+	require.Equal(t, uint64(2), changes["b-stuck"].(map[string]interface{})["leader"])
+	for _, chain := range []*GeoEtcdRaft{movable, stuck} {
+		require.True(t, chain.isDraining(1))
+		require.NotEqual(t, uint64(1), chain.currentLeader())
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// electionHistorySize bounds the election records kept in memory
+	electionHistorySize = 1000
+
+	// defaultElectionQueryLimit is the number of records returned by
+	// /chains/elections when no limit is given
+	defaultElectionQueryLimit = 100
+)
+
+// ElectionRecord describes a single leader election decision
+type ElectionRecord struct {
+	Timestamp        time.Time         `json:"timestamp"`
+	Channel          string            `json:"channel"`
+	Trigger          string            `json:"trigger"`
+	ScoringMode      string            `json:"scoring_mode,omitempty"`
+	Candidates       []leaderCandidate `json:"candidates"`
+	WinnerID         uint64            `json:"winner_id"`
+	PreviousLeaderID uint64            `json:"previous_leader_id"`
+	TransferExecuted bool              `json:"transfer_executed"`
+}
+
+// electionLog keeps recent election records in memory and, if configured,
+// appends them as JSON lines to a file that is reloaded on startup
+type electionLog struct {
+	mu      sync.Mutex
+	records []ElectionRecord
+	file    *os.File
+}
+
+// newElectionLog creates an election log. If path is set, records already
+// in the file are loaded and new records are appended to it.
+func newElectionLog(path string) (*electionLog, error) {
+	log := &electionLog{}
+	if path == "" {
+		return log, nil
+	}
+
+	if err := log.load(path); err != nil {
+		return log, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return log, fmt.Errorf("failed to open election log: %v", err)
+	}
+	log.file = file
+	return log, nil
+}
+
+// load reads the most recent persisted records from path
+func (e *electionLog) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read election log: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	skipped := 0
+	for scanner.Scan() {
+		var record ElectionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			skipped++
+			continue
+		}
+		e.records = append(e.records, record)
+		if len(e.records) > electionHistorySize {
+			e.records = e.records[len(e.records)-electionHistorySize:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read election log: %v", err)
+	}
+	if skipped > 0 {
+		consenterLogger.Warnf("Skipped %d unreadable records in election log %s", skipped, path)
+	}
+	return nil
+}
+
+// record stores an election record
+func (e *electionLog) record(record ElectionRecord) {
+	if e == nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.records = append(e.records, record)
+	if len(e.records) > electionHistorySize {
+		e.records = e.records[len(e.records)-electionHistorySize:]
+	}
+
+	if e.file != nil {
+		line, err := json.Marshal(record)
+		if err == nil {
+			_, err = e.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			consenterLogger.Errorf("Failed to persist election record: %v", err)
+		}
+	}
+}
+
+// electionQuery selects election records
+type electionQuery struct {
+	channel  string
+	nodeID   uint64
+	trigger  string
+	since    time.Time
+	executed *bool
+	limit    int
+}
+
+// matches reports whether a record passes the query
+func (q electionQuery) matches(record ElectionRecord) bool {
+	if q.channel != "" && record.Channel != q.channel {
+		return false
+	}
+	if q.nodeID != 0 && record.WinnerID != q.nodeID && record.PreviousLeaderID != q.nodeID {
+		return false
+	}
+	if q.trigger != "" && record.Trigger != q.trigger {
+		return false
+	}
+	if !q.since.IsZero() && record.Timestamp.Before(q.since) {
+		return false
+	}
+	if q.executed != nil && record.TransferExecuted != *q.executed {
+		return false
+	}
+	return true
+}
+
+// query returns the most recent matching records, oldest first
+func (e *electionLog) query(q electionQuery) []ElectionRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result := []ElectionRecord{}
+	for i := len(e.records) - 1; i >= 0 && len(result) < q.limit; i-- {
+		if q.matches(e.records[i]) {
+			result = append(result, e.records[i])
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// close releases the election log file
+func (e *electionLog) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// attachElectionLog connects the chain to the consenter's election history
+func (g *GeoEtcdRaft) attachElectionLog(elections *electionLog) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.elections = elections
+}
+
+// recordElection adds an election decision to the election history.
+// Callers must hold g.mu.
+func (g *GeoEtcdRaft) recordElection(winnerID, previousID uint64, trigger string, candidates []leaderCandidate, executed bool) {
+	if candidates == nil {
+		candidates = []leaderCandidate{}
+	}
+
+	g.elections.record(ElectionRecord{
+		Timestamp:        g.now(),
+		Channel:          g.channelID,
+		Trigger:          trigger,
+		ScoringMode:      g.config.ScoringMode,
+		Candidates:       candidates,
+		WinnerID:         winnerID,
+		PreviousLeaderID: previousID,
+		TransferExecuted: executed,
+	})
+}
+
+// handleElections serves the election history. Records can be filtered
+// with ?id=<channel>, ?node=<id> (winner or previous leader),
+// ?trigger=<reason>, ?since=<RFC 3339 time>, ?executed=<bool> and capped
+// with ?limit=<n>.
+func (gc *GeoConsenter) handleElections(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := electionQuery{
+		channel: params.Get("id"),
+		trigger: params.Get("trigger"),
+		limit:   defaultElectionQueryLimit,
+	}
+
+	if value := params.Get("node"); value != "" {
+		nodeID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid node %q", value), http.StatusBadRequest)
+			return
+		}
+		q.nodeID = nodeID
+	}
+	if value := params.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since %q, expected RFC 3339", value), http.StatusBadRequest)
+			return
+		}
+		q.since = since
+	}
+	if value := params.Get("executed"); value != "" {
+		executed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid executed %q", value), http.StatusBadRequest)
+			return
+		}
+		q.executed = &executed
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit %q", value), http.StatusBadRequest)
+			return
+		}
+		if limit > electionHistorySize {
+			limit = electionHistorySize
+		}
+		q.limit = limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"timestamp": time.Now(),
+		"elections": gc.elections.query(q),
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"sort"
 	"sync"
 	"time"
 
+	"fabric-geo-consensus/geodesy"
 	"github.com/hyperledger/fabric/common/flogging"
 	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
 	"github.com/hyperledger/fabric/protos/orderer"
@@ -23,6 +25,7 @@ type GeoLocation struct {
 	Region      string  `json:"region"`
 	Zone        string  `json:"zone"`
 	DataCenter  string  `json:"datacenter"`
+	Labels      map[string]string `json:"labels,omitempty"`
 }
 
 // GeoNode represents a node with geographical information
@@ -33,6 +36,8 @@ type GeoNode struct {
 	Latency     map[uint64]time.Duration `json:"latency_map"`
 	IsLeader    bool        `json:"is_leader"`
 	RegionRank  int         `json:"region_rank"`
+	LeadershipBlocked bool  `json:"leadership_blocked"`
+	Draining    bool        `json:"draining"`
 }
 
 // GeoEtcdRaft extends the standard etcdraft with geo-awareness
@@ -44,6 +49,29 @@ type GeoEtcdRaft struct {
 	config          *GeoConfig
 	mu              sync.RWMutex
 	metrics         *GeoMetrics
+	latencies       *latencyTracker
+	tracer          *orderTracer
+	batcher         *AppendBatcher
+	localNodeID     uint64
+	channelID       string
+	events          *eventBroker
+	elections       *electionLog
+	breachedPairs   map[string]bool
+	progress        map[uint64]ReplicationProgress
+	heights         []committedHeight
+	baseTimeouts    ConsensusTimeouts
+	timeoutHook     func(ConsensusTimeouts)
+	clock           Clock
+	latencySource   LatencySource
+	carbonSource    CarbonIntensitySource
+	
+	// Lifecycle of the geo monitoring goroutines
+	parentCtx       context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	haltOnce        sync.Once
+	halted          bool
+	onHalt          func()
 }
 
 // GeoConfig holds configuration for geo-aware consensus
@@ -55,8 +83,34 @@ type GeoConfig struct {
 	CrossRegionRatio    float64       `json:"cross_region_ratio"`
 	AdaptiveTimeout     bool          `json:"adaptive_timeout"`
 	HierarchicalMode    bool          `json:"hierarchical_mode"`
+	LatencyWindow       time.Duration `json:"latency_window"`
+	ScoringMode         string        `json:"scoring_mode"`
+	Tracing             TracingConfig `json:"tracing"`
+	API                 APIConfig     `json:"api"`
+	ElectionLogFile     string        `json:"election_log_file"`
+	TopologyLabels      []TopologyLabel `json:"topology_labels,omitempty"`
+	CatchUpMaxLag       uint64        `json:"catchup_max_lag"`
+	Compression         CompressionConfig `json:"compression"`
+	Cost                CostConfig    `json:"cost"`
+	Carbon              CarbonConfig  `json:"carbon"`
+	CarbonSource        CarbonSourceConfig `json:"carbon_source"`
+	Degraded            DegradedModeConfig `json:"degraded"`
+	
+	// Channels holds partial GeoConfig overrides keyed by channel ID
+	Channels            map[string]json.RawMessage `json:"channels,omitempty"`
 }
 
+// Scoring modes supported by calculateLeaderScore
+const (
+	// ScoringModeProximity penalizes candidates by their average latency
+	ScoringModeProximity = "proximity"
+	// ScoringModeTailLatency penalizes candidates by their p99 latency
+	ScoringModeTailLatency = "tail-latency"
+	// ScoringModeQuorumLatency scores candidates by their expected quorum
+	// commit latency alone
+	ScoringModeQuorumLatency = "quorum-latency"
+)
+
 // GeoMetrics tracks performance metrics
 type GeoMetrics struct {
 	TotalTransactions      int64         `json:"total_transactions"`
@@ -65,6 +119,18 @@ type GeoMetrics struct {
 	LeaderElections       int64         `json:"leader_elections"`
 	CrossRegionMessages   int64         `json:"cross_region_messages"`
 	ThroughputPerSecond   float64       `json:"throughput_per_second"`
+	LeadershipChanges     int64         `json:"leadership_changes"`
+	NodePairLatencies     map[string]LatencyPercentiles `json:"node_pair_latencies"`
+	RegionPairLatencies   map[string]LatencyPercentiles `json:"region_pair_latencies"`
+	QuorumSize            int           `json:"quorum_size"`
+	QuorumCommitLatency   map[uint64]time.Duration `json:"quorum_commit_latency"`
+	CatchUpSelections     int64         `json:"catchup_selections"`
+	CatchUpFallbacks      int64         `json:"catchup_fallbacks"`
+	CatchUpSources        map[uint64]CatchUpSelection `json:"catchup_sources"`
+	Compression           map[string]CompressionStats `json:"compression"`
+	EgressCost            EgressCostEstimate `json:"egress_cost"`
+	Carbon                CarbonEstimate `json:"carbon"`
+	Degraded              DegradedStatus `json:"degraded_mode"`
 }
 
 // NewGeoEtcdRaft creates a new geo-aware etcdraft consensus
@@ -76,15 +142,92 @@ func NewGeoEtcdRaft(baseChain *etcdraft.Chain, config *GeoConfig) *GeoEtcdRaft {
 		proximityMatrix: make(map[uint64]map[uint64]float64),
 		config:          config,
 		metrics:         &GeoMetrics{
-			RegionLatencies: make(map[string]time.Duration),
+			RegionLatencies:     make(map[string]time.Duration),
+			NodePairLatencies:   make(map[string]LatencyPercentiles),
+			RegionPairLatencies: make(map[string]LatencyPercentiles),
+			QuorumCommitLatency: make(map[uint64]time.Duration),
+			CatchUpSources:      make(map[uint64]CatchUpSelection),
+			Compression:         make(map[string]CompressionStats),
 		},
+		latencies:       newLatencyTracker(config.LatencyWindow),
+		breachedPairs:   make(map[string]bool),
+		progress:        make(map[uint64]ReplicationProgress),
+		baseTimeouts:    ConsensusTimeouts{
+			HeartbeatInterval: defaultHeartbeatInterval,
+			ElectionTimeout:   defaultElectionTimeout,
+		},
+		parentCtx:       context.Background(),
+		clock:           realClock{},
+	}
+	geo.metrics.Degraded.Timeouts = geo.timeouts()
+	
+	return geo
+}
+
+// Start starts the underlying etcdraft chain and the geo monitoring loops.
+// Starting a chain that is running or has been halted has no effect.
+func (g *GeoEtcdRaft) Start() {
+	g.mu.Lock()
+	if g.cancel != nil || g.halted {
+		g.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(g.parentCtx)
+	g.cancel = cancel
+	tracer := g.tracer
+	g.mu.Unlock()
+	
+	if g.Chain != nil {
+		g.Chain.Start()
 	}
 	
 	// Initialize proximity calculations
-	go geo.monitorNetwork()
-	go geo.updateMetrics()
+	g.wg.Add(2)
+	go g.monitorNetwork(ctx)
+	go g.updateMetrics(ctx)
 	
-	return geo
+	if tracer != nil {
+		g.wg.Add(1)
+		go g.expireTraces(ctx, tracer)
+	}
+}
+
+// Halt stops the geo monitoring loops and the underlying etcdraft chain,
+// and waits until all goroutines started by the chain have exited. It is
+// safe to call more than once.
+func (g *GeoEtcdRaft) Halt() {
+	g.haltOnce.Do(func() {
+		g.mu.Lock()
+		g.halted = true
+		cancel := g.cancel
+		onHalt := g.onHalt
+		tracer := g.tracer
+		batcher := g.batcher
+		g.mu.Unlock()
+		
+		if cancel != nil {
+			cancel()
+			g.wg.Wait()
+			
+			if g.Chain != nil {
+				g.Chain.Halt()
+			}
+		}
+		
+		if batcher != nil {
+			batcher.Close()
+		}
+		
+		if tracer != nil {
+			tracer.abandon("chain halted")
+		}
+		
+		logger.Infof("Halted geo-aware chain %s", g.channelID)
+		
+		if onHalt != nil {
+			onHalt()
+		}
+	})
 }
 
 // RegisterNode adds a new node with geographical information
@@ -95,7 +238,7 @@ func (g *GeoEtcdRaft) RegisterNode(nodeID uint64, location GeoLocation) error {
 	node := &GeoNode{
 		NodeID:   nodeID,
 		Location: location,
-		LastSeen: time.Now(),
+		LastSeen: g.now(),
 		Latency:  make(map[uint64]time.Duration),
 	}
 	
@@ -105,25 +248,136 @@ func (g *GeoEtcdRaft) RegisterNode(nodeID uint64, location GeoLocation) error {
 	logger.Infof("Registered geo-node %d at %s, region: %s", 
 		nodeID, location.Zone, location.Region)
 	
+	g.events.publish(g.channelID, EventNodeRegistered, map[string]interface{}{
+		"node_id":  nodeID,
+		"location": location,
+	})
+	
 	return nil
 }
 
-// calculateDistance computes geographical distance between two locations
-func (g *GeoEtcdRaft) calculateDistance(loc1, loc2 GeoLocation) float64 {
-	// Haversine formula for great-circle distance
-	const earthRadius = 6371 // km
+// RemoveNode removes a node and all proximity and latency data about it
+func (g *GeoEtcdRaft) RemoveNode(nodeID uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	node := g.nodes[nodeID]
+	if node == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
+	}
+	
+	delete(g.nodes, nodeID)
+	delete(g.proximityMatrix, nodeID)
+	for _, row := range g.proximityMatrix {
+		delete(row, nodeID)
+	}
+	for _, other := range g.nodes {
+		delete(other.Latency, nodeID)
+	}
+	for region, leaderID := range g.regionLeaders {
+		if leaderID == nodeID {
+			delete(g.regionLeaders, region)
+		}
+	}
+	g.latencies.forgetNode(nodeID)
+	delete(g.progress, nodeID)
+	delete(g.metrics.CatchUpSources, nodeID)
 	
-	lat1Rad := loc1.Latitude * math.Pi / 180
-	lat2Rad := loc2.Latitude * math.Pi / 180
-	deltaLat := (loc2.Latitude - loc1.Latitude) * math.Pi / 180
-	deltaLon := (loc2.Longitude - loc1.Longitude) * math.Pi / 180
+	logger.Infof("Removed geo-node %d from region %s", nodeID, node.Location.Region)
 	
-	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-		math.Cos(lat1Rad)*math.Cos(lat2Rad)*
-		math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	g.events.publish(g.channelID, EventNodeRemoved, map[string]interface{}{
+		"node_id":    nodeID,
+		"region":     node.Location.Region,
+		"was_leader": node.IsLeader,
+	})
 	
-	return earthRadius * c
+	return nil
+}
+
+// UpdateNodeLocation moves a registered node, keeping its latency history
+// and leadership state
+func (g *GeoEtcdRaft) UpdateNodeLocation(nodeID uint64, location GeoLocation) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	node := g.nodes[nodeID]
+	if node == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
+	}
+	
+	previous := node.Location
+	node.Location = location
+	g.updateProximityMatrix(nodeID)
+	
+	if node.IsLeader && previous.Region != location.Region {
+		delete(g.regionLeaders, previous.Region)
+		g.regionLeaders[location.Region] = nodeID
+	}
+	
+	logger.Infof("Moved geo-node %d from region %s to %s", nodeID, previous.Region, location.Region)
+	
+	g.events.publish(g.channelID, EventNodeUpdated, map[string]interface{}{
+		"node_id":           nodeID,
+		"location":          location,
+		"previous_location": previous,
+	})
+	
+	return nil
+}
+
+// UpdateConfig replaces the geo configuration and recomputes proximity scores
+func (g *GeoEtcdRaft) UpdateConfig(config *GeoConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	previous := g.config
+	g.config = config
+	for nodeID := range g.nodes {
+		g.updateProximityMatrix(nodeID)
+	}
+	
+	// Event subscribers only need the reader role, so the API section
+	// stays out of the event
+	g.events.publish(g.channelID, EventConfigChanged, map[string]interface{}{
+		"previous": previous.Redacted(),
+		"current":  config.Redacted(),
+	})
+}
+
+// attachEvents connects the chain to the consenter's event stream
+func (g *GeoEtcdRaft) attachEvents(events *eventBroker, channelID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	g.events = events
+	g.channelID = channelID
+}
+
+// attachLifecycle ties the chain's goroutines to the consenter's context and
+// registers a callback run once the chain has halted
+func (g *GeoEtcdRaft) attachLifecycle(parent context.Context, onHalt func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	g.parentCtx = parent
+	g.onHalt = onHalt
+}
+
+// SetLocalNode records which registered node this orderer runs as
+func (g *GeoEtcdRaft) SetLocalNode(nodeID uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	g.localNodeID = nodeID
+}
+
+// calculateDistance computes the WGS-84 ellipsoidal distance in km between
+// two locations
+func (g *GeoEtcdRaft) calculateDistance(loc1, loc2 GeoLocation) float64 {
+	return geodesy.Distance(
+		geodesy.Point{Lat: loc1.Latitude, Lon: loc1.Longitude},
+		geodesy.Point{Lat: loc2.Latitude, Lon: loc2.Longitude},
+	)
 }
 
 // updateProximityMatrix calculates proximity scores between nodes
@@ -133,6 +387,7 @@ func (g *GeoEtcdRaft) updateProximityMatrix(nodeID uint64) {
 	}
 	
 	currentNode := g.nodes[nodeID]
+	labels := g.config.topologyLabels()
 	for otherID, otherNode := range g.nodes {
 		if otherID == nodeID {
 			continue
@@ -140,18 +395,9 @@ func (g *GeoEtcdRaft) updateProximityMatrix(nodeID uint64) {
 		
 		distance := g.calculateDistance(currentNode.Location, otherNode.Location)
 		
-		// Calculate proximity score (inverse of distance with region bonuses)
+		// Calculate proximity score (inverse of distance with topology bonuses)
 		proximityScore := 1.0 / (1.0 + distance)
-		
-		// Bonus for same region
-		if currentNode.Location.Region == otherNode.Location.Region {
-			proximityScore *= g.config.RegionWeight
-		}
-		
-		// Bonus for same zone
-		if currentNode.Location.Zone == otherNode.Location.Zone {
-			proximityScore *= 1.5
-		}
+		proximityScore *= labelAffinity(labels, currentNode.Location, otherNode.Location)
 		
 		g.proximityMatrix[nodeID][otherID] = proximityScore
 		
@@ -165,55 +411,179 @@ func (g *GeoEtcdRaft) updateProximityMatrix(nodeID uint64) {
 
 // selectOptimalLeader chooses the best leader based on geo-proximity and load
 func (g *GeoEtcdRaft) selectOptimalLeader(candidates []uint64) uint64 {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
+	return g.electLeader(candidates, "geo-score")
+}
+
+// electLeader scores the candidates and records the winner, tagging the
+// election with the reason that triggered it
+func (g *GeoEtcdRaft) electLeader(candidates []uint64, reason string) uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	
 	if len(candidates) == 0 {
 		return 0
 	}
 	
-	type candidateScore struct {
-		nodeID uint64
-		score  float64
+	scores := g.rankCandidates(candidates)
+	
+	if len(scores) > 0 {
+		selectedLeader := scores[0].NodeID
+		g.updateLeaderElection(selectedLeader, reason, scores)
+		return selectedLeader
+	}
+	
+	// Fallback
+	for _, candidateID := range candidates {
+		if node := g.nodes[candidateID]; node == nil || node.eligible() {
+			g.recordElection(candidateID, g.leaderID(), reason, nil, false)
+			return candidateID
+		}
 	}
 	
-	var scores []candidateScore
+	g.recordElection(0, g.leaderID(), reason, nil, false)
+	return 0
+}
+
+// leaderCandidate is a candidate node with its leadership score
+type leaderCandidate struct {
+	NodeID    uint64               `json:"node_id"`
+	Region    string               `json:"region"`
+	Score     float64              `json:"score"`
+	Breakdown LeaderScoreBreakdown `json:"breakdown"`
+}
+
+// LeaderScoreBreakdown holds the contribution of each factor to a
+// candidate's leadership score. Total is the sum of the bonuses minus the
+// penalties.
+type LeaderScoreBreakdown struct {
+	Proximity      float64 `json:"proximity"`
+	RegionBonus    float64 `json:"region_bonus"`
+	LatencyPenalty float64 `json:"latency_penalty"`
+	LoadPenalty    float64 `json:"load_penalty"`
+	CostPenalty    float64 `json:"cost_penalty"`
+	CarbonPenalty  float64 `json:"carbon_penalty"`
+	Total          float64 `json:"total"`
+}
+
+// rankCandidates scores the eligible candidates, best first, without
+// changing any state. Callers must hold g.mu.
+func (g *GeoEtcdRaft) rankCandidates(candidates []uint64) []leaderCandidate {
+	var scores []leaderCandidate
 	
 	for _, candidateID := range candidates {
 		candidate := g.nodes[candidateID]
-		if candidate == nil {
+		if candidate == nil || !candidate.eligible() {
 			continue
 		}
 		
-		score := g.calculateLeaderScore(candidateID)
-		scores = append(scores, candidateScore{
-			nodeID: candidateID,
-			score:  score,
+		breakdown := g.scoreBreakdown(candidateID)
+		scores = append(scores, leaderCandidate{
+			NodeID:    candidateID,
+			Region:    candidate.Location.Region,
+			Score:     breakdown.Total,
+			Breakdown: breakdown,
 		})
 	}
 	
 	// Sort by score descending
 	sort.Slice(scores, func(i, j int) bool {
-		return scores[i].score > scores[j].score
+		return scores[i].Score > scores[j].Score
 	})
 	
-	if len(scores) > 0 {
-		selectedLeader := scores[0].nodeID
-		g.updateLeaderElection(selectedLeader)
-		return selectedLeader
+	return scores
+}
+
+// TransferLeadership moves geo leadership to the given node
+func (g *GeoEtcdRaft) TransferLeadership(nodeID uint64, reason string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	node := g.nodes[nodeID]
+	if node == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
+	}
+	if node.LeadershipBlocked {
+		return fmt.Errorf("node %d is blocked from leadership", nodeID)
+	}
+	if node.Draining {
+		return fmt.Errorf("node %d is draining", nodeID)
+	}
+	
+	g.updateLeaderElection(nodeID, reason, g.rankCandidates(g.nodeIDs()))
+	return nil
+}
+
+// SetLeadershipBlocked excludes a node from, or readmits it to, leader
+// candidacy. Blocking the current leader does not move leadership; use
+// DrainNode for that.
+func (g *GeoEtcdRaft) SetLeadershipBlocked(nodeID uint64, blocked bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	
+	node := g.nodes[nodeID]
+	if node == nil {
+		return fmt.Errorf("node %d is not registered", nodeID)
 	}
 	
-	return candidates[0] // Fallback
+	node.LeadershipBlocked = blocked
+	return nil
+}
+
+// currentLeader returns the node currently marked as geo leader, or 0
+func (g *GeoEtcdRaft) currentLeader() uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	
+	return g.leaderID()
+}
+
+// leaderID returns the current geo leader, or 0. Callers must hold g.mu.
+func (g *GeoEtcdRaft) leaderID() uint64 {
+	for nodeID, node := range g.nodes {
+		if node.IsLeader {
+			return nodeID
+		}
+	}
+	return 0
+}
+
+// nodeIDs returns the IDs of all registered nodes. Callers must hold g.mu.
+func (g *GeoEtcdRaft) nodeIDs() []uint64 {
+	ids := make([]uint64, 0, len(g.nodes))
+	for nodeID := range g.nodes {
+		ids = append(ids, nodeID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
 }
 
 // calculateLeaderScore computes leadership score based on various factors
 func (g *GeoEtcdRaft) calculateLeaderScore(nodeID uint64) float64 {
+	return g.scoreBreakdown(nodeID).Total
+}
+
+// scoreBreakdown computes each factor of a node's leadership score
+func (g *GeoEtcdRaft) scoreBreakdown(nodeID uint64) LeaderScoreBreakdown {
+	var breakdown LeaderScoreBreakdown
+	
 	node := g.nodes[nodeID]
 	if node == nil {
-		return 0
+		return breakdown
 	}
 	
-	score := 0.0
+	// Raft commits once the k-th closest follower has acked, so in quorum
+	// mode that latency replaces the averaged proximity and latency factors
+	if g.config.ScoringMode == ScoringModeQuorumLatency {
+		breakdown.LatencyPenalty = float64(g.quorumCommitLatency(nodeID)/time.Millisecond) / 1000.0
+		if g.config.LoadBalanceEnabled {
+			breakdown.LoadPenalty = g.calculateLoadFactor(nodeID)
+		}
+		breakdown.CostPenalty = g.costPenalty(nodeID)
+		breakdown.CarbonPenalty = g.carbonPenalty(nodeID)
+		breakdown.Total = -breakdown.LatencyPenalty - breakdown.LoadPenalty -
+			breakdown.CostPenalty - breakdown.CarbonPenalty
+		return breakdown
+	}
 	
 	// Base proximity score (average to all other nodes)
 	proximitySum := 0.0
@@ -229,29 +599,40 @@ func (g *GeoEtcdRaft) calculateLeaderScore(nodeID uint64) float64 {
 	}
 	
 	if proximityCount > 0 {
-		score += (proximitySum / float64(proximityCount)) * g.config.ProximityWeight
+		breakdown.Proximity = (proximitySum / float64(proximityCount)) * g.config.ProximityWeight
 	}
 	
 	// Regional leadership bonus
 	regionNodeCount := g.countNodesInRegion(node.Location.Region)
 	if regionNodeCount > 1 {
-		score += float64(regionNodeCount) * 0.1
+		breakdown.RegionBonus = float64(regionNodeCount) * 0.1
 	}
 	
 	// Latency penalty (higher latency = lower score)
 	avgLatency := g.calculateAverageLatency(nodeID)
+	if g.config.ScoringMode == ScoringModeTailLatency {
+		avgLatency = g.calculateTailLatency(nodeID)
+	}
 	if avgLatency > 0 {
-		latencyPenalty := float64(avgLatency/time.Millisecond) / 1000.0
-		score -= latencyPenalty
+		breakdown.LatencyPenalty = float64(avgLatency/time.Millisecond) / 1000.0
 	}
 	
 	// Load balancing factor
 	if g.config.LoadBalanceEnabled {
-		loadFactor := g.calculateLoadFactor(nodeID)
-		score -= loadFactor
+		breakdown.LoadPenalty = g.calculateLoadFactor(nodeID)
 	}
 	
-	return score
+	// Egress cost factor
+	breakdown.CostPenalty = g.costPenalty(nodeID)
+	
+	// Grid carbon intensity factor
+	breakdown.CarbonPenalty = g.carbonPenalty(nodeID)
+	
+	breakdown.Total = breakdown.Proximity + breakdown.RegionBonus -
+		breakdown.LatencyPenalty - breakdown.LoadPenalty -
+		breakdown.CostPenalty - breakdown.CarbonPenalty
+	
+	return breakdown
 }
 
 // countNodesInRegion counts nodes in the same region
@@ -287,6 +668,34 @@ func (g *GeoEtcdRaft) calculateAverageLatency(nodeID uint64) time.Duration {
 	return 0
 }
 
+// calculateTailLatency computes the average p99 latency to other nodes
+// over the rolling window, falling back to the last measured latencies
+func (g *GeoEtcdRaft) calculateTailLatency(nodeID uint64) time.Duration {
+	now := g.now()
+
+	var total time.Duration
+	count := 0
+
+	for otherID := range g.nodes {
+		if otherID == nodeID {
+			continue
+		}
+
+		histogram := g.latencies.nodePairHistogram(now, nodeID, otherID)
+		if histogram.Count() == 0 {
+			continue
+		}
+		total += histogram.Percentile(99)
+		count++
+	}
+
+	if count == 0 {
+		return g.calculateAverageLatency(nodeID)
+	}
+
+	return total / time.Duration(count)
+}
+
 // calculateLoadFactor computes current load factor for a node
 func (g *GeoEtcdRaft) calculateLoadFactor(nodeID uint64) float64 {
 	// Simplified load calculation - can be enhanced with actual metrics
@@ -296,7 +705,7 @@ func (g *GeoEtcdRaft) calculateLoadFactor(nodeID uint64) float64 {
 	}
 	
 	// Factor in recent activity, connection count, etc.
-	timeSinceLastSeen := time.Since(node.LastSeen)
+	timeSinceLastSeen := g.now().Sub(node.LastSeen)
 	if timeSinceLastSeen > time.Minute {
 		return 1.0 // High penalty for inactive nodes
 	}
@@ -304,8 +713,9 @@ func (g *GeoEtcdRaft) calculateLoadFactor(nodeID uint64) float64 {
 	return 0.1 // Base load factor
 }
 
-// updateLeaderElection updates leadership tracking
-func (g *GeoEtcdRaft) updateLeaderElection(leaderID uint64) {
+// updateLeaderElection updates leadership tracking and records the
+// election with the scored candidates it was decided from
+func (g *GeoEtcdRaft) updateLeaderElection(leaderID uint64, reason string, candidates []leaderCandidate) {
 	leader := g.nodes[leaderID]
 	if leader == nil {
 		return
@@ -315,19 +725,37 @@ func (g *GeoEtcdRaft) updateLeaderElection(leaderID uint64) {
 	g.regionLeaders[leader.Location.Region] = leaderID
 	
 	// Mark as leader
+	var previousID uint64
 	for _, node := range g.nodes {
+		if node.IsLeader {
+			previousID = node.NodeID
+		}
 		node.IsLeader = false
 	}
 	leader.IsLeader = true
 	
+	g.recordElection(leaderID, previousID, reason, candidates, previousID != leaderID)
+	
+	if previousID != leaderID {
+		g.metrics.LeadershipChanges++
+		g.events.publish(g.channelID, EventLeaderChanged, map[string]interface{}{
+			"leader_id":          leaderID,
+			"region":             leader.Location.Region,
+			"previous_leader_id": previousID,
+			"reason":             reason,
+		})
+	}
+	
 	g.metrics.LeaderElections++
 	
 	logger.Infof("New geo-aware leader elected: node %d in region %s", 
 		leaderID, leader.Location.Region)
 }
 
-// monitorNetwork continuously monitors network conditions
-func (g *GeoEtcdRaft) monitorNetwork() {
+// monitorNetwork continuously monitors network conditions until ctx is done
+func (g *GeoEtcdRaft) monitorNetwork(ctx context.Context) {
+	defer g.wg.Done()
+	
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 	
@@ -335,29 +763,80 @@ func (g *GeoEtcdRaft) monitorNetwork() {
 		select {
 		case <-ticker.C:
 			g.updateNetworkMetrics()
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
-// updateNetworkMetrics refreshes network performance metrics
+// updateNetworkMetrics refreshes network performance metrics and reports
+// changed consensus timeouts to the hook set with OnTimeoutsChanged
 func (g *GeoEtcdRaft) updateNetworkMetrics() {
 	g.mu.Lock()
-	defer g.mu.Unlock()
+	previous := g.metrics.Degraded.Timeouts
+	g.refreshNetworkMetrics()
+	timeouts, hook := g.metrics.Degraded.Timeouts, g.timeoutHook
+	g.mu.Unlock()
 	
+	if hook != nil && timeouts != previous {
+		hook(timeouts)
+	}
+}
+
+// refreshNetworkMetrics measures latencies and updates the metrics derived
+// from them. Callers must hold g.mu.
+func (g *GeoEtcdRaft) refreshNetworkMetrics() {
 	// Update latency measurements between nodes
+	now := g.now()
 	for nodeID, node := range g.nodes {
-		for otherID := range g.nodes {
+		for otherID, otherNode := range g.nodes {
 			if nodeID != otherID {
 				// Simulate latency measurement (in real implementation, use actual network metrics)
 				latency := g.measureLatency(nodeID, otherID)
 				node.Latency[otherID] = latency
+				g.latencies.record(now, node, otherNode, latency)
+				g.checkLatencyThreshold(node, otherNode, latency)
 			}
 		}
-		node.LastSeen = time.Now()
+		node.LastSeen = now
 	}
 	
 	// Update regional statistics
 	g.updateRegionalMetrics()
+	
+	g.metrics.QuorumSize = quorumSize(len(g.nodes))
+	g.metrics.QuorumCommitLatency = g.quorumCommitLatencies()
+	g.updateDegradedMode()
+	g.updateEgressCost()
+	g.updateCarbonEstimate()
+}
+
+// checkLatencyThreshold publishes an event when a node pair's latency
+// crosses LatencyThreshold, once per breach rather than on every sample
+func (g *GeoEtcdRaft) checkLatencyThreshold(from, to *GeoNode, latency time.Duration) {
+	if g.config.LatencyThreshold <= 0 {
+		return
+	}
+	
+	key := nodePairKey(from.NodeID, to.NodeID)
+	breached := latency > g.config.LatencyThreshold
+	if breached == g.breachedPairs[key] {
+		return
+	}
+	
+	if !breached {
+		delete(g.breachedPairs, key)
+		return
+	}
+	
+	g.breachedPairs[key] = true
+	g.events.publish(g.channelID, EventLatencyThresholdBreached, map[string]interface{}{
+		"from_node":    from.NodeID,
+		"to_node":      to.NodeID,
+		"region_pair":  regionPairKey(from.Location.Region, to.Location.Region),
+		"latency_ms":   latency.Milliseconds(),
+		"threshold_ms": g.config.LatencyThreshold.Milliseconds(),
+	})
 }
 
 // measureLatency simulates latency measurement (replace with actual implementation)
@@ -369,20 +848,34 @@ func (g *GeoEtcdRaft) measureLatency(from, to uint64) time.Duration {
 		return time.Millisecond * 100 // Default
 	}
 	
-	distance := g.calculateDistance(fromNode.Location, toNode.Location)
-	
-	// Simulate latency based on distance (simplified model)
-	baseLatency := time.Duration(distance * 0.1) * time.Millisecond
+	// Prefer recorded latencies when a trace is loaded
+	if g.latencySource != nil {
+		if latency, ok := g.latencySource.Latency(from, to, g.now()); ok {
+			return latency
+		}
+		return g.estimateLatency(fromNode.Location, toNode.Location)
+	}
 	
 	// Add random jitter
 	jitter := time.Duration(rand.Intn(20)) * time.Millisecond
 	
+	return g.estimateLatency(fromNode.Location, toNode.Location) + jitter
+}
+
+// estimateLatency predicts the latency between two locations from their
+// distance, without jitter
+func (g *GeoEtcdRaft) estimateLatency(from, to GeoLocation) time.Duration {
+	distance := g.calculateDistance(from, to)
+	
+	// Simulate latency based on distance (simplified model)
+	baseLatency := time.Duration(distance * 0.1) * time.Millisecond
+	
 	// Same region bonus
-	if fromNode.Location.Region == toNode.Location.Region {
+	if from.Region == to.Region {
 		baseLatency = baseLatency / 2
 	}
 	
-	return baseLatency + jitter
+	return baseLatency
 }
 
 // updateRegionalMetrics computes regional performance statistics
@@ -410,10 +903,17 @@ func (g *GeoEtcdRaft) updateRegionalMetrics() {
 			g.metrics.RegionLatencies[regionPair] = total / time.Duration(len(latencies))
 		}
 	}
+	
+	// Refresh windowed percentiles per node pair and region pair
+	now := g.now()
+	g.metrics.NodePairLatencies = g.latencies.nodePairPercentiles(now)
+	g.metrics.RegionPairLatencies = g.latencies.regionPairPercentiles(now)
 }
 
-// updateMetrics continuously updates performance metrics
-func (g *GeoEtcdRaft) updateMetrics() {
+// updateMetrics continuously updates performance metrics until ctx is done
+func (g *GeoEtcdRaft) updateMetrics(ctx context.Context) {
+	defer g.wg.Done()
+	
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 	
@@ -426,15 +926,19 @@ func (g *GeoEtcdRaft) updateMetrics() {
 			now := time.Now()
 			elapsed := now.Sub(lastUpdate)
 			
+			g.mu.Lock()
 			currentTransactions := g.metrics.TotalTransactions
 			newTransactions := currentTransactions - lastTransactionCount
 			
 			if elapsed.Seconds() > 0 {
 				g.metrics.ThroughputPerSecond = float64(newTransactions) / elapsed.Seconds()
 			}
+			g.mu.Unlock()
 			
 			lastTransactionCount = currentTransactions
 			lastUpdate = now
+		case <-ctx.Done():
+			return
 		}
 	}
 }
@@ -450,10 +954,48 @@ func (g *GeoEtcdRaft) GetMetrics() *GeoMetrics {
 	for k, v := range g.metrics.RegionLatencies {
 		metrics.RegionLatencies[k] = v
 	}
+	metrics.NodePairLatencies = make(map[string]LatencyPercentiles)
+	for k, v := range g.metrics.NodePairLatencies {
+		metrics.NodePairLatencies[k] = v
+	}
+	metrics.RegionPairLatencies = make(map[string]LatencyPercentiles)
+	for k, v := range g.metrics.RegionPairLatencies {
+		metrics.RegionPairLatencies[k] = v
+	}
+	metrics.QuorumCommitLatency = make(map[uint64]time.Duration)
+	for k, v := range g.metrics.QuorumCommitLatency {
+		metrics.QuorumCommitLatency[k] = v
+	}
+	metrics.CatchUpSources = make(map[uint64]CatchUpSelection)
+	for k, v := range g.metrics.CatchUpSources {
+		metrics.CatchUpSources[k] = v
+	}
+	metrics.Compression = make(map[string]CompressionStats)
+	for k, v := range g.metrics.Compression {
+		metrics.Compression[k] = v
+	}
+	metrics.EgressCost.MonthlyCost = make(map[uint64]float64)
+	for k, v := range g.metrics.EgressCost.MonthlyCost {
+		metrics.EgressCost.MonthlyCost[k] = v
+	}
+	metrics.Carbon.RegionIntensity = make(map[string]float64)
+	for k, v := range g.metrics.Carbon.RegionIntensity {
+		metrics.Carbon.RegionIntensity[k] = v
+	}
+	metrics.Degraded.Reasons = append([]string(nil), g.metrics.Degraded.Reasons...)
+	metrics.Degraded.Breaches = append([]string(nil), g.metrics.Degraded.Breaches...)
 	
 	return &metrics
 }
 
+// Config returns the chain's effective configuration
+func (g *GeoEtcdRaft) Config() *GeoConfig {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	
+	return g.config
+}
+
 // GetTopology returns current network topology information
 func (g *GeoEtcdRaft) GetTopology() map[string]interface{} {
 	g.mu.RLock()
@@ -464,7 +1006,7 @@ func (g *GeoEtcdRaft) GetTopology() map[string]interface{} {
 		"region_leaders": g.regionLeaders,
 		"total_nodes":    len(g.nodes),
 		"regions":        g.getUniqueRegions(),
-		"config":         g.config,
+		"config":         g.config.Redacted(),
 	}
 	
 	return topology
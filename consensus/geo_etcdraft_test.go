@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/goleak"
+)
+
+func TestChainHaltStopsAllGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	chain := newTestChain(t)
+	chain.EnableTracing(sdktrace.NewTracerProvider(), "testchannel")
+	chain.Start()
+	chain.Start()
+	chain.Halt()
+	chain.Halt()
+}
+
+func TestChainStartAfterHaltIsNoop(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	halted := false
+	chain := newTestChain(t)
+	chain.attachLifecycle(chain.parentCtx, func() { halted = true })
+	chain.Halt()
+	require.True(t, halted)
+
+	chain.Start()
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+	require.Nil(t, chain.cancel)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Topology event types published on the event stream
+const (
+	EventNodeRegistered           = "node_registered"
+	EventNodeUpdated              = "node_updated"
+	EventNodeRemoved              = "node_removed"
+	EventNodeDraining             = "node_draining"
+	EventNodeUndrained            = "node_undrained"
+	EventLeaderChanged            = "leader_changed"
+	EventLatencyThresholdBreached = "latency_threshold_breached"
+	EventDegradedModeEntered      = "degraded_mode_entered"
+	EventDegradedModeRecovered    = "degraded_mode_recovered"
+	EventConfigChanged            = "config_changed"
+	EventChainCreated             = "chain_created"
+	EventChainHalted              = "chain_halted"
+
+	// EventStreamGap tells a resuming client that events it asked for
+	// are no longer retained, or were published by an earlier run of the
+	// consenter, and it should refetch /topology
+	EventStreamGap = "stream_gap"
+)
+
+// Reasons for a stream gap
+const (
+	streamGapExpired      = "expired"
+	streamGapEpochChanged = "epoch_changed"
+)
+
+const (
+	eventHistorySize       = 1024
+	eventSubscriberBuffer  = 64
+	eventHeartbeatInterval = 15 * time.Second
+)
+
+// TopologyEvent is a single typed change published on the event stream.
+// Sequence numbers restart with every run of the consenter, which is told
+// apart by Epoch.
+type TopologyEvent struct {
+	Epoch     string                 `json:"epoch"`
+	Sequence  uint64                 `json:"sequence"`
+	Type      string                 `json:"type"`
+	Channel   string                 `json:"channel,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// eventBroker sequences topology events, keeps a bounded history for
+// resuming clients and fans events out to live subscribers
+type eventBroker struct {
+	mu          sync.Mutex
+	epoch       string
+	sequence    uint64
+	history     []TopologyEvent
+	subscribers map[chan TopologyEvent]struct{}
+}
+
+// newEventBroker creates an empty event broker with a new epoch
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		epoch:       newEventEpoch(),
+		subscribers: make(map[chan TopologyEvent]struct{}),
+	}
+}
+
+// newEventEpoch returns a random identifier for a run of the event stream
+func newEventEpoch() string {
+	epoch := make([]byte, 8)
+	if _, err := rand.Read(epoch); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(epoch)
+}
+
+// eventID is the SSE id of an event: its epoch and sequence number
+func eventID(epoch string, sequence uint64) string {
+	return fmt.Sprintf("%s-%d", epoch, sequence)
+}
+
+// parseEventID splits an SSE id into its epoch and sequence number. A bare
+// sequence number has no epoch.
+func parseEventID(id string) (string, uint64, error) {
+	epoch := ""
+	if i := strings.LastIndex(id, "-"); i >= 0 {
+		epoch, id = id[:i], id[i+1:]
+		if epoch == "" {
+			return "", 0, fmt.Errorf("missing epoch")
+		}
+	}
+	sequence, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	return epoch, sequence, nil
+}
+
+// publish assigns the next sequence number to an event and delivers it.
+// Subscribers that cannot keep up are disconnected so that they resume
+// from their last sequence number instead of silently missing events.
+func (b *eventBroker) publish(channel, eventType string, data map[string]interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sequence++
+	event := TopologyEvent{
+		Epoch:     b.epoch,
+		Sequence:  b.sequence,
+		Type:      eventType,
+		Channel:   channel,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// subscribe registers a subscriber and returns the retained events after
+// since. gap reports whether events after since were already discarded.
+func (b *eventBroker) subscribe(since uint64) (backlog []TopologyEvent, sub chan TopologyEvent, gap bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) > 0 && since+1 < b.history[0].Sequence {
+		gap = true
+	}
+
+	for _, event := range b.history {
+		if event.Sequence > since {
+			backlog = append(backlog, event)
+		}
+	}
+
+	sub = make(chan TopologyEvent, eventSubscriberBuffer)
+	b.subscribers[sub] = struct{}{}
+
+	return backlog, sub, gap
+}
+
+// unsubscribe removes a subscriber if it is still registered
+func (b *eventBroker) unsubscribe(sub chan TopologyEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.subscribers[sub]; exists {
+		delete(b.subscribers, sub)
+		close(sub)
+	}
+}
+
+// close disconnects all subscribers
+func (b *eventBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub)
+	}
+}
+
+// currentSequence returns the epoch and the sequence number of the latest
+// event
+func (b *eventBroker) currentSequence() (string, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.epoch, b.sequence
+}
+
+// eventFilter selects which events a stream client receives
+type eventFilter struct {
+	channel string
+	types   map[string]bool
+}
+
+// matches reports whether the event passes the filter
+func (f eventFilter) matches(event TopologyEvent) bool {
+	if f.channel != "" && event.Channel != "" && event.Channel != f.channel {
+		return false
+	}
+	if len(f.types) > 0 && !f.types[event.Type] {
+		return false
+	}
+	return true
+}
+
+// writeServerSentEvent writes a single event in text/event-stream format
+func writeServerSentEvent(w http.ResponseWriter, event TopologyEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", eventID(event.Epoch, event.Sequence), event.Type, payload)
+	return err
+}
+
+// handleEvents streams topology events as server-sent events. Clients
+// resume after a reconnect with the Last-Event-ID header or ?since=<id>,
+// and may filter with ?channel=<id> and ?types=<type>,<type>. An id from an
+// earlier epoch replays every retained event after a stream gap.
+func (gc *GeoConsenter) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	epoch, since := gc.events.currentSequence()
+	resume := r.Header.Get("Last-Event-ID")
+	if value := r.URL.Query().Get("since"); value != "" {
+		resume = value
+	}
+	requestedEpoch := epoch
+	if resume != "" {
+		parsedEpoch, parsed, err := parseEventID(resume)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid event id %q", resume), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+		if parsedEpoch != "" {
+			requestedEpoch = parsedEpoch
+		}
+	}
+
+	// Sequence numbers of an earlier run mean nothing now
+	epochChanged := requestedEpoch != epoch
+	if epochChanged {
+		since = 0
+	}
+
+	filter := eventFilter{channel: r.URL.Query().Get("channel")}
+	if types := r.URL.Query().Get("types"); types != "" {
+		filter.types = make(map[string]bool)
+		for _, eventType := range strings.Split(types, ",") {
+			filter.types[strings.TrimSpace(eventType)] = true
+		}
+	}
+
+	backlog, sub, gap := gc.events.subscribe(since)
+	defer gc.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if gap || epochChanged {
+		oldest := since + 1
+		if len(backlog) > 0 {
+			oldest = backlog[0].Sequence
+		}
+		data := map[string]interface{}{
+			"reason":          streamGapExpired,
+			"requested_since": since,
+			"oldest_retained": oldest,
+		}
+		if epochChanged {
+			data["reason"] = streamGapEpochChanged
+			data["requested_epoch"] = requestedEpoch
+			data["requested_since"] = resume
+		}
+		writeServerSentEvent(w, TopologyEvent{
+			Epoch:     epoch,
+			Sequence:  since,
+			Type:      EventStreamGap,
+			Timestamp: time.Now(),
+			Data:      data,
+		})
+	}
+
+	lastSent := since
+	for _, event := range backlog {
+		lastSent = event.Sequence
+		if filter.matches(event) {
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-sub:
+			if !open {
+				return
+			}
+			// Skip anything already replayed from the backlog
+			if event.Sequence <= lastSent {
+				continue
+			}
+			lastSent = event.Sequence
+			if !filter.matches(event) {
+				continue
+			}
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
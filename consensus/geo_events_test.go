@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readEvents reads count events from a server-sent event stream
+func readEvents(t *testing.T, resp *http.Response, count int) []TopologyEvent {
+	var events []TopologyEvent
+	scanner := bufio.NewScanner(resp.Body)
+	for len(events) < count && scanner.Scan() {
+		if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+			var event TopologyEvent
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			events = append(events, event)
+		}
+	}
+	require.Len(t, events, count)
+	return events
+}
+
+func TestParseEventID(t *testing.T) {
+	epoch, sequence, err := parseEventID("0a1b2c-42")
+	require.NoError(t, err)
+	require.Equal(t, "0a1b2c", epoch)
+	require.Equal(t, uint64(42), sequence)
+
+	epoch, sequence, err = parseEventID("7")
+	require.NoError(t, err)
+	require.Empty(t, epoch)
+	require.Equal(t, uint64(7), sequence)
+
+	for _, id := range []string{"", "-3", "abc-", "abc-x"} {
+		_, _, err = parseEventID(id)
+		require.Error(t, err, id)
+	}
+}
+
+func TestEventsResumeAcrossEpochs(t *testing.T) {
+	gc := &GeoConsenter{events: newEventBroker()}
+	gc.events.publish("a", EventChainCreated, nil)
+	gc.events.publish("a", EventNodeRegistered, nil)
+	gc.events.publish("a", EventNodeRegistered, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(gc.handleEvents))
+	defer server.Close()
+	defer gc.events.close()
+
+	epoch, _ := gc.events.currentSequence()
+
+	// Resuming within the epoch skips what the client has seen
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", eventID(epoch, 2))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	events := readEvents(t, resp, 1)
+	resp.Body.Close()
+	require.Equal(t, uint64(3), events[0].Sequence)
+	require.Equal(t, epoch, events[0].Epoch)
+
+	// An id from an earlier run replays everything after a gap
+	req.Header.Set("Last-Event-ID", eventID("0123456789abcdef", 40))
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	events = readEvents(t, resp, 4)
+	resp.Body.Close()
+	require.Equal(t, EventStreamGap, events[0].Type)
+	require.Equal(t, streamGapEpochChanged, events[0].Data["reason"])
+	for i, event := range events[1:] {
+		require.Equal(t, uint64(i+1), event.Sequence)
+	}
+}
+
+func TestConfigChangedEventRedactsAPIConfig(t *testing.T) {
+	events := newEventBroker()
+	defer events.close()
+	chain := newTestChain(t)
+	chain.attachEvents(events, "testchannel")
+
+	config := NewGeoConfig()
+	config.API.AdminCommonNames = []string{"ops-admin"}
+	config.API.Tokens = []APIToken{{Name: "operator", SHA256: strings.Repeat("c", 64), Role: "admin"}}
+	chain.UpdateConfig(config)
+	chain.UpdateConfig(config.Clone())
+
+	backlog, sub, _ := events.subscribe(0)
+	events.unsubscribe(sub)
+	require.Len(t, backlog, 2)
+	encoded, err := json.Marshal(backlog)
+	require.NoError(t, err)
+	require.Contains(t, string(encoded), `"latency_threshold"`)
+	require.NotContains(t, string(encoded), "ops-admin")
+	require.NotContains(t, string(encoded), strings.Repeat("c", 64))
+	require.Equal(t, "ops-admin", chain.Config().API.AdminCommonNames[0])
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Policies that exclude a node from leader candidacy
+const (
+	PolicyLeadershipBlocked = "leadership_blocked"
+	PolicyDraining          = "draining"
+)
+
+// CandidateExplanation is a node's current leadership score and how it
+// compares to the winner
+type CandidateExplanation struct {
+	NodeID    uint64               `json:"node_id"`
+	Region    string               `json:"region"`
+	Zone      string               `json:"zone"`
+	IsLeader  bool                 `json:"is_leader"`
+	Eligible  bool                 `json:"eligible"`
+	Policies  []string             `json:"policies,omitempty"`
+	Rank      int                  `json:"rank,omitempty"`
+	Breakdown LeaderScoreBreakdown `json:"breakdown"`
+	Margin    float64              `json:"margin"`
+
+	// QuorumCommitLatency is the expected commit latency with the node as
+	// leader, whatever the scoring mode
+	QuorumCommitLatency time.Duration `json:"quorum_commit_latency"`
+
+	// MonthlyEgressCost is the projected consensus egress cost with the node
+	// as leader, whatever the cost weight
+	MonthlyEgressCost float64 `json:"monthly_egress_cost"`
+
+	// CarbonIntensity is the current grid carbon intensity of the node's
+	// region in gCO2eq/kWh, or 0 if unknown
+	CarbonIntensity float64 `json:"carbon_intensity"`
+}
+
+// LeadershipExplanation explains which node the scoring currently favours
+// and why
+type LeadershipExplanation struct {
+	ScoringMode     string                 `json:"scoring_mode"`
+	CurrentLeaderID uint64                 `json:"current_leader_id"`
+	WinnerID        uint64                 `json:"winner_id"`
+	WinningMargin   float64                `json:"winning_margin"`
+	LeaderIsWinner  bool                   `json:"leader_is_winner"`
+	Candidates      []CandidateExplanation `json:"candidates"`
+}
+
+// ExplainLeadership scores every registered node as an election would right
+// now, without changing any state. Margin is how far a node's total score
+// is behind the winner's; WinningMargin is the winner's lead over the
+// runner-up.
+func (g *GeoEtcdRaft) ExplainLeadership() LeadershipExplanation {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	explanation := LeadershipExplanation{
+		ScoringMode:     g.config.ScoringMode,
+		CurrentLeaderID: g.leaderID(),
+		Candidates:      []CandidateExplanation{},
+	}
+	if explanation.ScoringMode == "" {
+		explanation.ScoringMode = ScoringModeProximity
+	}
+
+	ranks := make(map[uint64]int)
+	ranked := g.rankCandidates(g.nodeIDs())
+	for i, candidate := range ranked {
+		ranks[candidate.NodeID] = i + 1
+	}
+
+	var winnerScore float64
+	if len(ranked) > 0 {
+		explanation.WinnerID = ranked[0].NodeID
+		winnerScore = ranked[0].Score
+		if len(ranked) > 1 {
+			explanation.WinningMargin = ranked[0].Score - ranked[1].Score
+		}
+	}
+	explanation.LeaderIsWinner = explanation.WinnerID != 0 &&
+		explanation.WinnerID == explanation.CurrentLeaderID
+
+	for _, nodeID := range g.nodeIDs() {
+		node := g.nodes[nodeID]
+		candidate := CandidateExplanation{
+			NodeID:    nodeID,
+			Region:    node.Location.Region,
+			Zone:      node.Location.Zone,
+			IsLeader:  node.IsLeader,
+			Eligible:  node.eligible(),
+			Rank:      ranks[nodeID],
+			Breakdown: g.scoreBreakdown(nodeID),
+
+			QuorumCommitLatency: g.quorumCommitLatency(nodeID),
+			MonthlyEgressCost:   g.monthlyEgressCost(nodeID),
+		}
+		candidate.CarbonIntensity, _ = g.carbonIntensity(node.Location.Region)
+		if node.LeadershipBlocked {
+			candidate.Policies = append(candidate.Policies, PolicyLeadershipBlocked)
+		}
+		if node.Draining {
+			candidate.Policies = append(candidate.Policies, PolicyDraining)
+		}
+		if explanation.WinnerID != 0 {
+			candidate.Margin = winnerScore - candidate.Breakdown.Total
+		}
+		explanation.Candidates = append(explanation.Candidates, candidate)
+	}
+
+	// Best first, ineligible nodes last
+	sort.SliceStable(explanation.Candidates, func(i, j int) bool {
+		a, b := explanation.Candidates[i], explanation.Candidates[j]
+		if a.Eligible != b.Eligible {
+			return a.Eligible
+		}
+		return a.Breakdown.Total > b.Breakdown.Total
+	})
+
+	return explanation
+}
+
+// handleExplain serves the current leadership scores of a chain
+func (gc *GeoConsenter) handleExplain(w http.ResponseWriter, r *http.Request) {
+	chainID := r.URL.Query().Get("id")
+	if chainID == "" {
+		http.Error(w, "Query parameter id is required", http.StatusBadRequest)
+		return
+	}
+
+	gc.mu.RLock()
+	chain, exists := gc.chains[chainID]
+	gc.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, fmt.Sprintf("Chain %s not found", chainID), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"chain_id":    chainID,
+		"timestamp":   time.Now(),
+		"explanation": chain.ExplainLeadership(),
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Histogram layout: values are recorded in microseconds and bucketed
+// HDR-style, i.e. each power-of-two range is split into a fixed number of
+// linear sub-buckets, giving a bounded relative error (~3%) across the
+// whole range from 1µs up to several days.
+const (
+	histogramSubBucketBits  = 6
+	histogramSubBucketCount = 1 << histogramSubBucketBits
+	histogramSubBucketHalf  = histogramSubBucketCount / 2
+	histogramMaxExponent    = 40
+	histogramBucketCount    = (histogramMaxExponent + 2) * histogramSubBucketHalf
+)
+
+// Default rolling window used when GeoConfig.LatencyWindow is not set
+const (
+	defaultLatencyWindow   = 5 * time.Minute
+	latencyWindowSlotCount = 10
+)
+
+// LatencyPercentiles summarizes a latency distribution over a rolling window
+type LatencyPercentiles struct {
+	Count int64         `json:"count"`
+	Min   time.Duration `json:"min"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+	Mean  time.Duration `json:"mean"`
+}
+
+// LatencyHistogram is a fixed-size log-linear histogram of latency samples
+type LatencyHistogram struct {
+	counts [histogramBucketCount]int64
+	// bounded counts samples per latencyBucketBounds interval exactly, since
+	// the exposition bounds do not line up with the log-linear buckets
+	bounded [len(latencyBucketBounds)]int64
+	total   int64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+// NewLatencyHistogram creates an empty latency histogram
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{}
+}
+
+// histogramBucketIndex maps a value in microseconds to its bucket
+func histogramBucketIndex(us uint64) int {
+	if us < histogramSubBucketCount {
+		return int(us)
+	}
+
+	exponent := bits.Len64(us) - histogramSubBucketBits
+	if exponent > histogramMaxExponent {
+		return histogramBucketCount - 1
+	}
+
+	return exponent*histogramSubBucketHalf + int(us>>uint(exponent))
+}
+
+// histogramBucketUpperBound returns the highest value (in microseconds)
+// that falls into the given bucket
+func histogramBucketUpperBound(index int) uint64 {
+	if index < histogramSubBucketCount {
+		return uint64(index)
+	}
+
+	exponent := (index - histogramSubBucketHalf) / histogramSubBucketHalf
+	subBucket := index - exponent*histogramSubBucketHalf
+	return (uint64(subBucket+1) << uint(exponent)) - 1
+}
+
+// Record adds a single latency sample to the histogram
+func (h *LatencyHistogram) Record(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+
+	h.counts[histogramBucketIndex(uint64(latency/time.Microsecond))]++
+	for i, bound := range latencyBucketBounds {
+		if latency.Seconds() <= bound {
+			h.bounded[i]++
+			break
+		}
+	}
+
+	if h.total == 0 || latency < h.min {
+		h.min = latency
+	}
+	if latency > h.max {
+		h.max = latency
+	}
+	h.total++
+	h.sum += latency
+}
+
+// Merge adds all samples from other into the histogram
+func (h *LatencyHistogram) Merge(other *LatencyHistogram) {
+	if other == nil || other.total == 0 {
+		return
+	}
+
+	for i, count := range other.counts {
+		h.counts[i] += count
+	}
+	for i, count := range other.bounded {
+		h.bounded[i] += count
+	}
+
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	h.sum += other.sum
+}
+
+// Reset discards all recorded samples
+func (h *LatencyHistogram) Reset() {
+	*h = LatencyHistogram{}
+}
+
+// Count returns the number of recorded samples
+func (h *LatencyHistogram) Count() int64 {
+	return h.total
+}
+
+// Percentile returns the latency at or below which the given percentage
+// (0-100) of samples fall
+func (h *LatencyHistogram) Percentile(percentile float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+
+	if percentile <= 0 {
+		return h.min
+	}
+	if percentile >= 100 {
+		return h.max
+	}
+
+	target := int64(float64(h.total)*percentile/100.0 + 0.5)
+	if target < 1 {
+		target = 1
+	}
+
+	var cumulative int64
+	for i, count := range h.counts {
+		cumulative += count
+		if cumulative >= target {
+			value := time.Duration(histogramBucketUpperBound(i)) * time.Microsecond
+			if value > h.max {
+				value = h.max
+			}
+			if value < h.min {
+				value = h.min
+			}
+			return value
+		}
+	}
+
+	return h.max
+}
+
+// Percentiles returns the standard percentile summary of the histogram
+func (h *LatencyHistogram) Percentiles() LatencyPercentiles {
+	if h.total == 0 {
+		return LatencyPercentiles{}
+	}
+
+	return LatencyPercentiles{
+		Count: h.total,
+		Min:   h.min,
+		P50:   h.Percentile(50),
+		P90:   h.Percentile(90),
+		P99:   h.Percentile(99),
+		Max:   h.max,
+		Mean:  h.sum / time.Duration(h.total),
+	}
+}
+
+// CumulativeCounts returns, for each of latencyBucketBounds, the number of
+// samples at or below that bound
+func (h *LatencyHistogram) CumulativeCounts() map[float64]uint64 {
+	result := make(map[float64]uint64, len(latencyBucketBounds))
+
+	var cumulative uint64
+	for i, bound := range latencyBucketBounds {
+		cumulative += uint64(h.bounded[i])
+		result[bound] = cumulative
+	}
+
+	return result
+}
+
+// Sum returns the total of all recorded samples
+func (h *LatencyHistogram) Sum() time.Duration {
+	return h.sum
+}
+
+// RollingLatencyHistogram keeps latency samples for a sliding time window
+// by rotating through a fixed number of histogram slots
+type RollingLatencyHistogram struct {
+	slots     []*LatencyHistogram
+	slotSize  time.Duration
+	current   int
+	slotStart time.Time
+}
+
+// NewRollingLatencyHistogram creates a rolling histogram covering window
+func NewRollingLatencyHistogram(window time.Duration) *RollingLatencyHistogram {
+	if window <= 0 {
+		window = defaultLatencyWindow
+	}
+
+	slots := make([]*LatencyHistogram, latencyWindowSlotCount)
+	for i := range slots {
+		slots[i] = NewLatencyHistogram()
+	}
+
+	return &RollingLatencyHistogram{
+		slots:    slots,
+		slotSize: window / latencyWindowSlotCount,
+	}
+}
+
+// advance rotates out slots that have fallen outside the window
+func (r *RollingLatencyHistogram) advance(now time.Time) {
+	if r.slotStart.IsZero() {
+		r.slotStart = now
+		return
+	}
+
+	elapsed := now.Sub(r.slotStart)
+	if elapsed < r.slotSize {
+		return
+	}
+
+	steps := int(elapsed / r.slotSize)
+	if steps > len(r.slots) {
+		steps = len(r.slots)
+	}
+
+	for i := 0; i < steps; i++ {
+		r.current = (r.current + 1) % len(r.slots)
+		r.slots[r.current].Reset()
+	}
+	r.slotStart = r.slotStart.Add(elapsed.Truncate(r.slotSize))
+}
+
+// Record adds a latency sample observed at the given time
+func (r *RollingLatencyHistogram) Record(now time.Time, latency time.Duration) {
+	r.advance(now)
+	r.slots[r.current].Record(latency)
+}
+
+// Snapshot merges all slots within the window into a single histogram
+func (r *RollingLatencyHistogram) Snapshot(now time.Time) *LatencyHistogram {
+	r.advance(now)
+
+	merged := NewLatencyHistogram()
+	for _, slot := range r.slots {
+		merged.Merge(slot)
+	}
+
+	return merged
+}
+
+// latencyTracker maintains rolling histograms per node pair and region pair.
+// It carries its own lock so that readers holding only the chain's read lock
+// can still rotate expired window slots.
+type latencyTracker struct {
+	mu          sync.Mutex
+	window      time.Duration
+	nodePairs   map[string]*RollingLatencyHistogram
+	regionPairs map[string]*RollingLatencyHistogram
+}
+
+// newLatencyTracker creates a tracker using the given rolling window
+func newLatencyTracker(window time.Duration) *latencyTracker {
+	return &latencyTracker{
+		window:      window,
+		nodePairs:   make(map[string]*RollingLatencyHistogram),
+		regionPairs: make(map[string]*RollingLatencyHistogram),
+	}
+}
+
+// nodePairKey formats the key used for node pair latency series
+func nodePairKey(from, to uint64) string {
+	return fmt.Sprintf("%d-%d", from, to)
+}
+
+// regionPairKey formats the key used for region pair latency series
+func regionPairKey(from, to string) string {
+	return fmt.Sprintf("%s-%s", from, to)
+}
+
+// record adds a latency sample between two nodes
+func (t *latencyTracker) record(now time.Time, from, to *GeoNode, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nodeKey := nodePairKey(from.NodeID, to.NodeID)
+	if t.nodePairs[nodeKey] == nil {
+		t.nodePairs[nodeKey] = NewRollingLatencyHistogram(t.window)
+	}
+	t.nodePairs[nodeKey].Record(now, latency)
+
+	regionKey := regionPairKey(from.Location.Region, to.Location.Region)
+	if t.regionPairs[regionKey] == nil {
+		t.regionPairs[regionKey] = NewRollingLatencyHistogram(t.window)
+	}
+	t.regionPairs[regionKey].Record(now, latency)
+}
+
+// forgetNode drops all node pair series involving nodeID
+func (t *latencyTracker) forgetNode(nodeID uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.nodePairs {
+		var from, to uint64
+		if _, err := fmt.Sscanf(key, "%d-%d", &from, &to); err == nil && (from == nodeID || to == nodeID) {
+			delete(t.nodePairs, key)
+		}
+	}
+}
+
+// nodePairHistogram returns the windowed histogram between two nodes
+func (t *latencyTracker) nodePairHistogram(now time.Time, from, to uint64) *LatencyHistogram {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	series := t.nodePairs[nodePairKey(from, to)]
+	if series == nil {
+		return NewLatencyHistogram()
+	}
+	return series.Snapshot(now)
+}
+
+// nodePairHistograms returns windowed histograms for every node pair
+func (t *latencyTracker) nodePairHistograms(now time.Time) map[string]*LatencyHistogram {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]*LatencyHistogram, len(t.nodePairs))
+	for key, series := range t.nodePairs {
+		result[key] = series.Snapshot(now)
+	}
+	return result
+}
+
+// regionPairHistograms returns windowed histograms for every region pair
+func (t *latencyTracker) regionPairHistograms(now time.Time) map[string]*LatencyHistogram {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]*LatencyHistogram, len(t.regionPairs))
+	for key, series := range t.regionPairs {
+		result[key] = series.Snapshot(now)
+	}
+	return result
+}
+
+// nodePairPercentiles returns percentiles for every node pair
+func (t *latencyTracker) nodePairPercentiles(now time.Time) map[string]LatencyPercentiles {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]LatencyPercentiles, len(t.nodePairs))
+	for key, series := range t.nodePairs {
+		result[key] = series.Snapshot(now).Percentiles()
+	}
+	return result
+}
+
+// regionPairPercentiles returns percentiles for every region pair
+func (t *latencyTracker) regionPairPercentiles(now time.Time) map[string]LatencyPercentiles {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]LatencyPercentiles, len(t.regionPairs))
+	for key, series := range t.regionPairs {
+		result[key] = series.Snapshot(now).Percentiles()
+	}
+	return result
+}
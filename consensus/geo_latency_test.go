@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBucketIndex(t *testing.T) {
+	for _, tc := range []struct {
+		us    uint64
+		index int
+		upper uint64
+	}{
+		{us: 0, index: 0, upper: 0},
+		{us: 63, index: 63, upper: 63},
+		{us: 64, index: 64, upper: 65},
+		{us: 65, index: 64, upper: 65},
+		{us: 66, index: 65, upper: 67},
+		{us: 127, index: 95, upper: 127},
+		{us: 128, index: 96, upper: 131},
+		{us: 5000, index: 263, upper: 5119},
+		{us: 1 << 50, index: histogramBucketCount - 1, upper: (64 << 40) - 1},
+	} {
+		index := histogramBucketIndex(tc.us)
+		require.Equal(t, tc.index, index, "index of %dµs", tc.us)
+		require.Equal(t, tc.upper, histogramBucketUpperBound(index), "upper bound of %dµs", tc.us)
+	}
+
+	// Buckets are contiguous: every value lies above the previous bucket's
+	// upper bound and at or below its own
+	for us := uint64(1); us < 1<<24; us += 13 {
+		index := histogramBucketIndex(us)
+		require.LessOrEqual(t, us, histogramBucketUpperBound(index))
+		require.Greater(t, us, histogramBucketUpperBound(index-1))
+	}
+}
+
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	h := NewLatencyHistogram()
+	require.Equal(t, LatencyPercentiles{}, h.Percentiles())
+
+	for i := 1; i <= 1000; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, LatencyPercentiles{
+		Count: 1000,
+		Min:   time.Millisecond,
+		P50:   507903 * time.Microsecond,
+		P90:   901119 * time.Microsecond,
+		P99:   999423 * time.Microsecond,
+		Max:   time.Second,
+		Mean:  500500 * time.Microsecond,
+	}, h.Percentiles())
+	require.Equal(t, time.Millisecond, h.Percentile(0))
+	require.Equal(t, time.Second, h.Percentile(100))
+
+	// A bucket's upper bound is clamped to the observed range
+	single := NewLatencyHistogram()
+	single.Record(5 * time.Millisecond)
+	require.Equal(t, 5*time.Millisecond, single.Percentile(50))
+}
+
+func TestLatencyHistogramCumulativeCounts(t *testing.T) {
+	h := NewLatencyHistogram()
+	for _, latency := range []time.Duration{
+		time.Millisecond,
+		4999 * time.Microsecond,
+		5 * time.Millisecond,
+		5001 * time.Microsecond,
+		6 * time.Second,
+	} {
+		h.Record(latency)
+	}
+
+	counts := h.CumulativeCounts()
+	require.Len(t, counts, len(latencyBucketBounds))
+	require.Equal(t, uint64(1), counts[0.001])
+	require.Equal(t, uint64(1), counts[0.0025])
+	// 4.999ms, 5ms and 5.001ms share a log-linear bucket; only the first two
+	// are at or below the 5ms bound
+	require.Equal(t, uint64(3), counts[0.005])
+	require.Equal(t, uint64(4), counts[0.01])
+	require.Equal(t, uint64(4), counts[5])
+	require.Equal(t, int64(5), h.Count())
+
+	merged := NewLatencyHistogram()
+	merged.Merge(h)
+	merged.Merge(h)
+	require.Equal(t, uint64(6), merged.CumulativeCounts()[0.005])
+}
+
+func TestRollingLatencyHistogramWindow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRollingLatencyHistogram(10 * time.Second)
+
+	r.Record(start, time.Second)
+	r.Record(start.Add(5*time.Second), 2*time.Second)
+	require.Equal(t, int64(2), r.Snapshot(start.Add(5*time.Second)).Count())
+
+	// The first sample stays in the window until a full window has passed
+	require.Equal(t, int64(2), r.Snapshot(start.Add(9500*time.Millisecond)).Count())
+	snapshot := r.Snapshot(start.Add(10 * time.Second))
+	require.Equal(t, int64(1), snapshot.Count())
+	require.Equal(t, 2*time.Second, snapshot.Percentile(50))
+
+	// Jumping past the whole window clears every slot
+	require.Equal(t, int64(0), r.Snapshot(start.Add(time.Minute)).Count())
+	r.Record(start.Add(time.Minute), 3*time.Second)
+	require.Equal(t, int64(1), r.Snapshot(start.Add(time.Minute)).Count())
+}
+
+func TestRollingLatencyHistogramDefaultWindow(t *testing.T) {
+	r := NewRollingLatencyHistogram(0)
+	require.Equal(t, defaultLatencyWindow/latencyWindowSlotCount, r.slotSize)
+}
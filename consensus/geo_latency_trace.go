@@ -0,0 +1,436 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReplayInterval matches the interval of monitorNetwork
+const defaultReplayInterval = 30 * time.Second
+
+// Clock tells a chain what time it is. Replays drive the chain with a
+// VirtualClock instead of the wall clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// VirtualClock is a clock that only moves when told to
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewVirtualClock creates a virtual clock set to start
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+// Now returns the virtual time
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Set moves the virtual time to t
+func (c *VirtualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+}
+
+// Advance moves the virtual time forward by d
+func (c *VirtualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// LatencySource provides measured latencies between nodes. ok is false if
+// the source has no measurement for the pair at that time.
+type LatencySource interface {
+	Latency(from, to uint64, at time.Time) (latency time.Duration, ok bool)
+}
+
+// LatencySample is one recorded round-trip time between two nodes, at an
+// offset from the start of the trace
+type LatencySample struct {
+	Offset time.Duration
+	From   uint64
+	To     uint64
+	RTT    time.Duration
+}
+
+// LatencyTrace is a recorded, possibly time-varying, latency matrix. Each
+// pair keeps its latest sample until the next one; a pair recorded in only
+// one direction is used for both.
+type LatencyTrace struct {
+	// Start is the wall time of the first sample, or zero if the trace
+	// was recorded with relative offsets
+	Start    time.Time
+	Duration time.Duration
+	Nodes    []uint64
+	pairs    map[string][]LatencySample
+}
+
+// newLatencyTrace indexes samples by node pair and offset
+func newLatencyTrace(start time.Time, samples []LatencySample) (*LatencyTrace, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("latency trace has no samples")
+	}
+
+	trace := &LatencyTrace{
+		Start: start,
+		pairs: make(map[string][]LatencySample),
+	}
+
+	nodes := make(map[uint64]bool)
+	for _, sample := range samples {
+		if sample.From == sample.To {
+			return nil, fmt.Errorf("latency sample from node %d to itself", sample.From)
+		}
+		if sample.RTT < 0 || sample.Offset < 0 {
+			return nil, fmt.Errorf("latency sample %d-%d has a negative value", sample.From, sample.To)
+		}
+		key := nodePairKey(sample.From, sample.To)
+		trace.pairs[key] = append(trace.pairs[key], sample)
+		nodes[sample.From] = true
+		nodes[sample.To] = true
+		if sample.Offset > trace.Duration {
+			trace.Duration = sample.Offset
+		}
+	}
+
+	for _, pairSamples := range trace.pairs {
+		sort.SliceStable(pairSamples, func(i, j int) bool {
+			return pairSamples[i].Offset < pairSamples[j].Offset
+		})
+	}
+	for nodeID := range nodes {
+		trace.Nodes = append(trace.Nodes, nodeID)
+	}
+	sort.Slice(trace.Nodes, func(i, j int) bool { return trace.Nodes[i] < trace.Nodes[j] })
+
+	return trace, nil
+}
+
+// At returns the latency between two nodes at an offset into the trace
+func (t *LatencyTrace) At(from, to uint64, offset time.Duration) (time.Duration, bool) {
+	if latency, ok := t.lookup(nodePairKey(from, to), offset); ok {
+		return latency, true
+	}
+	return t.lookup(nodePairKey(to, from), offset)
+}
+
+// lookup returns the latest sample of a pair at or before offset
+func (t *LatencyTrace) lookup(key string, offset time.Duration) (time.Duration, bool) {
+	samples := t.pairs[key]
+	i := sort.Search(len(samples), func(i int) bool {
+		return samples[i].Offset > offset
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return samples[i-1].RTT, true
+}
+
+// Source returns the trace as a latency source whose offset zero is start
+func (t *LatencyTrace) Source(start time.Time) LatencySource {
+	return traceLatencySource{trace: t, start: start}
+}
+
+// traceLatencySource plays a latency trace against a clock
+type traceLatencySource struct {
+	trace *LatencyTrace
+	start time.Time
+}
+
+func (s traceLatencySource) Latency(from, to uint64, at time.Time) (time.Duration, bool) {
+	return s.trace.At(from, to, at.Sub(s.start))
+}
+
+// LoadLatencyTrace reads a latency trace from a .csv or .json file.
+//
+// CSV files have a header row with the columns time, from, to and either
+// rtt_ms (milliseconds) or rtt (a duration such as 85ms). JSON files hold
+// either {"samples": [{"time", "from", "to", "rtt_ms"}, ...]} or
+// {"matrices": [{"time", "rtt_ms": {"<from>": {"<to>": ms}}}, ...]}. A time
+// is either an offset in seconds from the start of the trace or an RFC 3339
+// timestamp; a file must use one or the other.
+func LoadLatencyTrace(path string) (*LatencyTrace, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []traceSample
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		samples, err = readLatencyCSV(file)
+	case ".json":
+		samples, err = readLatencyJSON(file)
+	default:
+		return nil, fmt.Errorf("unsupported latency trace format %q, use .csv or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read latency trace %s: %v", path, err)
+	}
+
+	return buildLatencyTrace(samples)
+}
+
+// traceSample is a sample whose time has not yet been resolved to an
+// offset
+type traceSample struct {
+	time string
+	from uint64
+	to   uint64
+	rtt  time.Duration
+}
+
+// buildLatencyTrace resolves sample times to offsets from the earliest one
+func buildLatencyTrace(raw []traceSample) (*LatencyTrace, error) {
+	var absolute, relative bool
+	times := make([]time.Time, len(raw))
+	offsets := make([]time.Duration, len(raw))
+
+	for i, sample := range raw {
+		if seconds, err := strconv.ParseFloat(sample.time, 64); err == nil {
+			relative = true
+			offsets[i] = time.Duration(seconds * float64(time.Second))
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, sample.time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q, expected seconds or RFC 3339", sample.time)
+		}
+		absolute = true
+		times[i] = t
+	}
+	if absolute && relative {
+		return nil, fmt.Errorf("trace mixes RFC 3339 timestamps and relative offsets")
+	}
+
+	var start time.Time
+	if absolute {
+		start = times[0]
+		for _, t := range times {
+			if t.Before(start) {
+				start = t
+			}
+		}
+		for i, t := range times {
+			offsets[i] = t.Sub(start)
+		}
+	}
+
+	samples := make([]LatencySample, len(raw))
+	for i, sample := range raw {
+		samples[i] = LatencySample{Offset: offsets[i], From: sample.from, To: sample.to, RTT: sample.rtt}
+	}
+
+	return newLatencyTrace(start, samples)
+}
+
+// readLatencyCSV parses CSV latency samples
+func readLatencyCSV(r io.Reader) ([]traceSample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header: %v", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"time", "from", "to"} {
+		if _, exists := columns[required]; !exists {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+	rttColumn, millis := columns["rtt_ms"], true
+	if _, exists := columns["rtt_ms"]; !exists {
+		if rttColumn, exists = columns["rtt"]; !exists {
+			return nil, fmt.Errorf("missing column \"rtt_ms\" or \"rtt\"")
+		}
+		millis = false
+	}
+
+	var samples []traceSample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sample := traceSample{time: strings.TrimSpace(record[columns["time"]])}
+		if sample.from, err = strconv.ParseUint(strings.TrimSpace(record[columns["from"]]), 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid from node %q", line, record[columns["from"]])
+		}
+		if sample.to, err = strconv.ParseUint(strings.TrimSpace(record[columns["to"]]), 10, 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid to node %q", line, record[columns["to"]])
+		}
+
+		value := strings.TrimSpace(record[rttColumn])
+		if millis {
+			ms, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid rtt_ms %q", line, value)
+			}
+			sample.rtt = time.Duration(ms * float64(time.Millisecond))
+		} else if sample.rtt, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("line %d: invalid rtt %q", line, value)
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// latencyTraceJSON is the JSON latency trace format
+type latencyTraceJSON struct {
+	Samples []struct {
+		Time  json.RawMessage `json:"time"`
+		From  uint64          `json:"from"`
+		To    uint64          `json:"to"`
+		RTTMs float64         `json:"rtt_ms"`
+	} `json:"samples"`
+	Matrices []struct {
+		Time  json.RawMessage               `json:"time"`
+		RTTMs map[string]map[string]float64 `json:"rtt_ms"`
+	} `json:"matrices"`
+}
+
+// readLatencyJSON parses JSON latency samples or matrices
+func readLatencyJSON(r io.Reader) ([]traceSample, error) {
+	var doc latencyTraceJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var samples []traceSample
+	for _, sample := range doc.Samples {
+		samples = append(samples, traceSample{
+			time: traceTime(sample.Time),
+			from: sample.From,
+			to:   sample.To,
+			rtt:  time.Duration(sample.RTTMs * float64(time.Millisecond)),
+		})
+	}
+
+	for _, matrix := range doc.Matrices {
+		for fromKey, row := range matrix.RTTMs {
+			from, err := strconv.ParseUint(fromKey, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid node %q in matrix", fromKey)
+			}
+			for toKey, ms := range row {
+				to, err := strconv.ParseUint(toKey, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid node %q in matrix", toKey)
+				}
+				samples = append(samples, traceSample{
+					time: traceTime(matrix.Time),
+					from: from,
+					to:   to,
+					rtt:  time.Duration(ms * float64(time.Millisecond)),
+				})
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// traceTime returns a JSON time, given as a number or a string, as text
+func traceTime(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	if len(raw) == 0 {
+		return "0"
+	}
+	return string(raw)
+}
+
+// now returns the chain's current time. The clock is set before the chain
+// is used and not changed afterwards.
+func (g *GeoEtcdRaft) now() time.Time {
+	if g.clock == nil {
+		return time.Now()
+	}
+	return g.clock.Now()
+}
+
+// SetClock replaces the clock the chain uses for measurements, windows and
+// records. It must be called before the chain is started.
+func (g *GeoEtcdRaft) SetClock(clock Clock) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.clock = clock
+}
+
+// UseLatencySource makes measureLatency return recorded latencies instead
+// of simulating them. Pairs the source has no sample for fall back to the
+// distance estimate. A nil source restores the simulation.
+func (g *GeoEtcdRaft) UseLatencySource(source LatencySource) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.latencySource = source
+}
+
+// ReplayLatencyTrace drives the chain through a latency trace on a virtual
+// clock. Starting at the trace's start (or start, for relative traces), it
+// runs a measurement round every interval until the end of the trace and
+// calls round after each one. The chain keeps the virtual clock and trace
+// afterwards.
+func (g *GeoEtcdRaft) ReplayLatencyTrace(trace *LatencyTrace, start time.Time, interval time.Duration, round func(at time.Time)) {
+	if interval <= 0 {
+		interval = defaultReplayInterval
+	}
+	if !trace.Start.IsZero() {
+		start = trace.Start
+	}
+
+	clock := NewVirtualClock(start)
+	g.SetClock(clock)
+	g.UseLatencySource(trace.Source(start))
+
+	for offset := time.Duration(0); offset <= trace.Duration; offset += interval {
+		clock.Set(start.Add(offset))
+		g.updateNetworkMetrics()
+		if round != nil {
+			round(clock.Now())
+		}
+	}
+}
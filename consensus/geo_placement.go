@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// placementExhaustiveLimit is the largest number of site combinations
+	// the advisor evaluates exhaustively before switching to local search
+	placementExhaustiveLimit = 100000
+
+	// placementDefaultAlternatives is the number of runner-up placements
+	// returned when the request does not ask for a number
+	placementDefaultAlternatives = 3
+
+	// Request bounds, which keep a single request from occupying the
+	// advisor for long
+	placementMaxSites        = 500
+	placementMaxCount        = 15
+	placementMaxAlternatives = 20
+
+	// placementTimeout bounds the search of a /placement request
+	placementTimeout = 10 * time.Second
+
+	// placementMaxConcurrent is the number of /placement searches that may
+	// run at once; further requests are answered with 429
+	placementMaxConcurrent = 2
+)
+
+// PlacementSite is a candidate datacenter for an orderer
+type PlacementSite struct {
+	Name     string      `json:"name"`
+	Location GeoLocation `json:"location"`
+}
+
+// TrafficSource is a client region and its share of the transaction load.
+// Without a location the centroid of the candidate sites in the region is
+// used.
+type TrafficSource struct {
+	Region   string       `json:"region"`
+	Weight   float64      `json:"weight"`
+	Location *GeoLocation `json:"location,omitempty"`
+}
+
+// PlacementRequest asks for the best Count sites out of Sites for the given
+// traffic mix. Without traffic every region of the candidate sites weighs
+// the same. FaultDomains lists the topology labels whose loss of any single
+// value the placement must survive; the default is region.
+type PlacementRequest struct {
+	Sites        []PlacementSite `json:"sites"`
+	Count        int             `json:"count"`
+	Traffic      []TrafficSource `json:"traffic,omitempty"`
+	Alternatives int             `json:"alternatives,omitempty"`
+	FaultDomains []string        `json:"fault_domains,omitempty"`
+}
+
+// PlacementOption is an evaluated set of sites
+type PlacementOption struct {
+	Sites                 []string                 `json:"sites"`
+	LeaderSite            string                   `json:"leader_site"`
+	ExpectedCommitLatency time.Duration            `json:"expected_commit_latency"`
+	CommitLatency         map[string]time.Duration `json:"commit_latency"`
+	LeaderQuorumLatency   time.Duration            `json:"leader_quorum_latency"`
+	FaultTolerance        FaultTolerance           `json:"fault_tolerance"`
+}
+
+// PlacementResult is the advisor's recommendation
+type PlacementResult struct {
+	Recommended  PlacementOption   `json:"recommended"`
+	Alternatives []PlacementOption `json:"alternatives"`
+	Evaluated    int               `json:"evaluated"`
+	Exhaustive   bool              `json:"exhaustive"`
+}
+
+// placementEvaluation is an option with the values the solver compares.
+// deficit is how many nodes short of a quorum the set is after losing its
+// worst fault domain; feasible sets have none.
+type placementEvaluation struct {
+	option   PlacementOption
+	indices  []int
+	feasible bool
+	deficit  int
+}
+
+// better reports whether e should be preferred over other: smaller quorum
+// deficit first, then lower expected commit latency. Ranking infeasible sets
+// by feasibility alone would leave the local search at the greedy start
+// whenever no single swap makes that set feasible, since every swap towards
+// another fault domain costs latency.
+func (e placementEvaluation) better(other placementEvaluation) bool {
+	if e.deficit != other.deficit {
+		return e.deficit < other.deficit
+	}
+	return e.option.ExpectedCommitLatency < other.option.ExpectedCommitLatency
+}
+
+// placementSolver evaluates site sets with the chain's distance model and
+// leader scoring until its context is done
+type placementSolver struct {
+	ctx          context.Context
+	config       *GeoConfig
+	sites        []PlacementSite
+	traffic      []TrafficSource
+	faultDomains []string
+	count        int
+	keep         int
+
+	evaluated int
+	best      []placementEvaluation
+	seen      map[string]bool
+}
+
+// RecommendPlacement chooses the sites that minimize the traffic-weighted
+// commit latency while keeping a raft quorum after the loss of any one
+// fault domain. The search stops with an error once ctx is done.
+func RecommendPlacement(ctx context.Context, config *GeoConfig, req PlacementRequest) (*PlacementResult, error) {
+	if req.Count < 1 {
+		return nil, fmt.Errorf("count must be at least 1")
+	}
+	if req.Count > placementMaxCount {
+		return nil, fmt.Errorf("count %d exceeds the limit of %d orderers", req.Count, placementMaxCount)
+	}
+	if len(req.Sites) > placementMaxSites {
+		return nil, fmt.Errorf("%d candidate sites exceed the limit of %d", len(req.Sites), placementMaxSites)
+	}
+	if req.Count > len(req.Sites) {
+		return nil, fmt.Errorf("count %d exceeds the %d candidate sites", req.Count, len(req.Sites))
+	}
+	if req.Alternatives > placementMaxAlternatives {
+		return nil, fmt.Errorf("%d alternatives exceed the limit of %d", req.Alternatives, placementMaxAlternatives)
+	}
+
+	names := make(map[string]bool)
+	for _, site := range req.Sites {
+		if site.Name == "" {
+			return nil, fmt.Errorf("every site needs a name")
+		}
+		if names[site.Name] {
+			return nil, fmt.Errorf("duplicate site %s", site.Name)
+		}
+		names[site.Name] = true
+	}
+
+	traffic, err := placementTraffic(req.Sites, req.Traffic)
+	if err != nil {
+		return nil, err
+	}
+
+	faultDomains := req.FaultDomains
+	if len(faultDomains) == 0 {
+		faultDomains = []string{LabelRegion}
+	}
+	for _, label := range faultDomains {
+		if label == "" {
+			return nil, fmt.Errorf("fault domain labels must not be empty")
+		}
+	}
+
+	alternatives := req.Alternatives
+	if alternatives <= 0 {
+		alternatives = placementDefaultAlternatives
+	}
+
+	solver := &placementSolver{
+		ctx:          ctx,
+		config:       config,
+		sites:        req.Sites,
+		traffic:      traffic,
+		faultDomains: faultDomains,
+		count:        req.Count,
+		keep:         alternatives + 1,
+		seen:         make(map[string]bool),
+	}
+
+	result := &PlacementResult{}
+	if combinations(len(req.Sites), req.Count) <= placementExhaustiveLimit {
+		solver.searchExhaustive()
+		result.Exhaustive = true
+	} else {
+		solver.searchLocal()
+	}
+	result.Evaluated = solver.evaluated
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("placement search stopped after %d evaluations: %v", solver.evaluated, err)
+	}
+
+	if len(solver.best) == 0 || !solver.best[0].feasible {
+		return nil, fmt.Errorf("no set of %d sites keeps a quorum after the loss of any one %s", req.Count, strings.Join(faultDomains, " or "))
+	}
+
+	result.Recommended = solver.best[0].option
+	result.Alternatives = []PlacementOption{}
+	for _, evaluation := range solver.best[1:] {
+		if evaluation.feasible {
+			result.Alternatives = append(result.Alternatives, evaluation.option)
+		}
+	}
+
+	return result, nil
+}
+
+// placementTraffic fills in default weights and locations of the traffic
+// sources and normalizes the weights
+func placementTraffic(sites []PlacementSite, traffic []TrafficSource) ([]TrafficSource, error) {
+	centroids := make(map[string]*GeoLocation)
+	counts := make(map[string]int)
+	var regions []string
+	for _, site := range sites {
+		region := site.Location.Region
+		if centroids[region] == nil {
+			centroids[region] = &GeoLocation{Region: region}
+			regions = append(regions, region)
+		}
+		centroids[region].Latitude += site.Location.Latitude
+		centroids[region].Longitude += site.Location.Longitude
+		counts[region]++
+	}
+	for region, centroid := range centroids {
+		centroid.Latitude /= float64(counts[region])
+		centroid.Longitude /= float64(counts[region])
+	}
+
+	if len(traffic) == 0 {
+		sort.Strings(regions)
+		for _, region := range regions {
+			traffic = append(traffic, TrafficSource{Region: region, Weight: 1})
+		}
+	}
+
+	total := 0.0
+	result := make([]TrafficSource, len(traffic))
+	for i, source := range traffic {
+		if source.Weight < 0 {
+			return nil, fmt.Errorf("traffic weight of region %s is negative", source.Region)
+		}
+		if source.Location == nil {
+			centroid := centroids[source.Region]
+			if centroid == nil {
+				return nil, fmt.Errorf("traffic region %s has no location and no candidate sites", source.Region)
+			}
+			source.Location = centroid
+		}
+		total += source.Weight
+		result[i] = source
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("traffic weights sum to zero")
+	}
+	for i := range result {
+		result[i].Weight /= total
+	}
+
+	return result, nil
+}
+
+// combinations returns n choose k, saturating at math.MaxInt64
+func combinations(n, k int) int64 {
+	if k > n-k {
+		k = n - k
+	}
+	result := int64(1)
+	for i := 1; i <= k; i++ {
+		if result > math.MaxInt64/int64(n-k+i) {
+			return math.MaxInt64
+		}
+		result = result * int64(n-k+i) / int64(i)
+	}
+	return result
+}
+
+// evaluate predicts the leader and commit latencies of a set of sites
+func (s *placementSolver) evaluate(indices []int) placementEvaluation {
+	s.evaluated++
+
+	nodes := make(map[uint64]*GeoNode, len(indices))
+	now := time.Now()
+	for _, index := range indices {
+		nodeID := uint64(index + 1)
+		nodes[nodeID] = &GeoNode{
+			NodeID:   nodeID,
+			Location: s.sites[index].Location,
+			LastSeen: now,
+			Latency:  make(map[uint64]time.Duration),
+		}
+	}
+
+	planning := newPlanningChain(nodes, s.config)
+	planning.mu.Lock()
+	defer planning.mu.Unlock()
+
+	for nodeID, node := range planning.nodes {
+		for otherID, other := range planning.nodes {
+			if nodeID != otherID {
+				node.Latency[otherID] = planning.estimateLatency(node.Location, other.Location)
+			}
+		}
+	}
+
+	prediction := planning.predict()
+	evaluation := placementEvaluation{
+		indices: append([]int(nil), indices...),
+		option: PlacementOption{
+			LeaderQuorumLatency: prediction.LeaderQuorumLatency,
+			FaultTolerance:      prediction.FaultTolerance,
+			CommitLatency:       make(map[string]time.Duration),
+		},
+	}
+	locations := make([]GeoLocation, 0, len(indices))
+	for _, index := range indices {
+		evaluation.option.Sites = append(evaluation.option.Sites, s.sites[index].Name)
+		locations = append(locations, s.sites[index].Location)
+	}
+	for _, label := range s.faultDomains {
+		if deficit := domainDeficit(locations, label, prediction.QuorumSize); deficit > evaluation.deficit {
+			evaluation.deficit = deficit
+		}
+	}
+	evaluation.feasible = evaluation.deficit == 0
+	sort.Strings(evaluation.option.Sites)
+	if prediction.LeaderID != 0 {
+		evaluation.option.LeaderSite = s.sites[prediction.LeaderID-1].Name
+	}
+
+	// Clients submit to the closest orderer, which forwards to the leader
+	var expected float64
+	for _, source := range s.traffic {
+		var entry uint64
+		var entryLatency time.Duration
+		for nodeID, node := range planning.nodes {
+			latency := planning.estimateLatency(*source.Location, node.Location)
+			if entry == 0 || latency < entryLatency {
+				entry, entryLatency = nodeID, latency
+			}
+		}
+		latency := entryLatency + planning.pairLatency(entry, prediction.LeaderID) + prediction.LeaderQuorumLatency
+		evaluation.option.CommitLatency[source.Region] = latency
+		expected += source.Weight * float64(latency)
+	}
+	evaluation.option.ExpectedCommitLatency = time.Duration(expected)
+
+	s.remember(evaluation)
+	return evaluation
+}
+
+// remember keeps the best distinct complete sets seen so far
+func (s *placementSolver) remember(evaluation placementEvaluation) {
+	if len(evaluation.indices) != s.count {
+		return
+	}
+	key := fmt.Sprint(evaluation.indices)
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+
+	position := sort.Search(len(s.best), func(i int) bool {
+		return evaluation.better(s.best[i])
+	})
+	if position >= s.keep {
+		return
+	}
+	s.best = append(s.best, placementEvaluation{})
+	copy(s.best[position+1:], s.best[position:])
+	s.best[position] = evaluation
+	if len(s.best) > s.keep {
+		s.best = s.best[:s.keep]
+	}
+}
+
+// searchExhaustive evaluates every set of s.count sites
+func (s *placementSolver) searchExhaustive() {
+	count := s.count
+	indices := make([]int, count)
+	for i := range indices {
+		indices[i] = i
+	}
+
+	for s.ctx.Err() == nil {
+		s.evaluate(indices)
+
+		// Advance to the next combination in lexicographic order
+		i := count - 1
+		for i >= 0 && indices[i] == len(s.sites)-count+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		indices[i]++
+		for j := i + 1; j < count; j++ {
+			indices[j] = indices[j-1] + 1
+		}
+	}
+}
+
+// searchLocal builds a set greedily and then swaps sites in and out while
+// that improves it
+func (s *placementSolver) searchLocal() {
+	count := s.count
+	var current []int
+	chosen := make(map[int]bool)
+
+	for len(current) < count {
+		if s.ctx.Err() != nil {
+			return
+		}
+		var bestIndex int
+		var best placementEvaluation
+		found := false
+		for index := range s.sites {
+			if chosen[index] {
+				continue
+			}
+			evaluation := s.evaluate(append(append([]int(nil), current...), index))
+			if !found || evaluation.better(best) {
+				bestIndex, best, found = index, evaluation, true
+			}
+		}
+		current = append(current, bestIndex)
+		chosen[bestIndex] = true
+	}
+
+	currentEvaluation := s.evaluate(current)
+	for improved := true; improved && s.ctx.Err() == nil; {
+		improved = false
+		for position := range current {
+			for index := range s.sites {
+				if chosen[index] {
+					continue
+				}
+				candidate := append([]int(nil), current...)
+				candidate[position] = index
+				sort.Ints(candidate)
+				evaluation := s.evaluate(candidate)
+				if evaluation.better(currentEvaluation) {
+					chosen[current[position]] = false
+					chosen[index] = true
+					current, currentEvaluation, improved = candidate, evaluation, true
+					break
+				}
+			}
+			if improved {
+				break
+			}
+		}
+	}
+}
+
+// handlePlacement recommends orderer sites for a placement request. It
+// uses the consenter's scoring configuration and changes no state. Requests
+// are bounded in size, searched for at most placementTimeout and at most
+// placementMaxConcurrent run at once.
+func (gc *GeoConsenter) handlePlacement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !gc.acquirePlacement() {
+		http.Error(w, "Too many placement searches in progress", http.StatusTooManyRequests)
+		return
+	}
+	defer gc.releasePlacement()
+
+	var req PlacementRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), placementTimeout)
+	defer cancel()
+
+	result, err := RecommendPlacement(ctx, gc.currentConfig(), req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if ctx.Err() == context.DeadlineExceeded {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"timestamp": time.Now(),
+		"placement": result,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// acquirePlacement reserves one of the placementMaxConcurrent search slots
+func (gc *GeoConsenter) acquirePlacement() bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.placements >= placementMaxConcurrent {
+		return false
+	}
+	gc.placements++
+	return true
+}
+
+// releasePlacement frees a slot reserved by acquirePlacement
+func (gc *GeoConsenter) releasePlacement() {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.placements--
+}
+
+// runPlacement implements the placement command
+func runPlacement(args []string) error {
+	flags := flag.NewFlagSet("placement", flag.ContinueOnError)
+	requestFile := flags.String("request", "", `JSON file with {"sites": [...], "count": n, "traffic": [...]} (required)`)
+	count := flags.Int("count", 0, "number of orderers, overrides the request")
+	alternatives := flags.Int("alternatives", 0, "number of runner-up placements to list, overrides the request")
+	faultDomains := flags.String("fault-domains", "", "comma-separated topology labels the placement must survive losing, overrides the request")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *requestFile == "" {
+		flags.Usage()
+		return fmt.Errorf("-request is required")
+	}
+
+	data, err := os.ReadFile(*requestFile)
+	if err != nil {
+		return err
+	}
+	var req PlacementRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", *requestFile, err)
+	}
+	if *count > 0 {
+		req.Count = *count
+	}
+	if *alternatives > 0 {
+		req.Alternatives = *alternatives
+	}
+	if *faultDomains != "" {
+		req.FaultDomains = strings.Split(*faultDomains, ",")
+		for i := range req.FaultDomains {
+			req.FaultDomains[i] = strings.TrimSpace(req.FaultDomains[i])
+		}
+	}
+
+	result, err := RecommendPlacement(context.Background(), NewGeoConfig(), req)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(map[string]interface{}{
+		"placement": result,
+	})
+}
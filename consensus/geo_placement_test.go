@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// placementSites returns count candidate sites spread over four regions
+func placementSites(count int) []PlacementSite {
+	regions := []string{"us-west", "us-east", "eu-west", "ap-south"}
+	sites := make([]PlacementSite, count)
+	for i := range sites {
+		sites[i] = PlacementSite{
+			Name: fmt.Sprintf("site-%d", i),
+			Location: GeoLocation{
+				Latitude:  float64(i%60) - 30,
+				Longitude: float64(i*7%360) - 180,
+				Region:    regions[i%len(regions)],
+			},
+		}
+	}
+	return sites
+}
+
+func TestRecommendPlacementRejectsOversizedRequests(t *testing.T) {
+	config := NewGeoConfig()
+	for _, req := range []PlacementRequest{
+		{Sites: placementSites(placementMaxSites + 1), Count: 3},
+		{Sites: placementSites(40), Count: placementMaxCount + 1},
+		{Sites: placementSites(40), Count: 3, Alternatives: placementMaxAlternatives + 1},
+	} {
+		_, err := RecommendPlacement(context.Background(), config, req)
+		require.Error(t, err)
+	}
+}
+
+func TestRecommendPlacementStopsAtDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := RecommendPlacement(ctx, NewGeoConfig(), PlacementRequest{Sites: placementSites(200), Count: 9})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "placement search stopped")
+}
+
+func TestHandlePlacementTimesOut(t *testing.T) {
+	gc := &GeoConsenter{config: NewGeoConfig()}
+	body := `{"sites":[{"name":"a","location":{"latitude":1,"longitude":1,"region":"r1"}},` +
+		`{"name":"b","location":{"latitude":2,"longitude":2,"region":"r2"}},` +
+		`{"name":"c","location":{"latitude":3,"longitude":3,"region":"r3"}}],"count":3}`
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/placement", strings.NewReader(body)).WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	gc.handlePlacement(recorder, req)
+	require.Equal(t, http.StatusGatewayTimeout, recorder.Code, recorder.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/placement", strings.NewReader(body))
+	recorder = httptest.NewRecorder()
+	gc.handlePlacement(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+}
+
+func TestRecommendPlacementLocalSearchReachesFeasibleSets(t *testing.T) {
+	// Thirty-six sites around New York and two each in London and San
+	// Francisco: the greedy start takes five New York sites, and no single
+	// swap makes that set survive the loss of us-east
+	var sites []PlacementSite
+	for i := 0; i < 36; i++ {
+		sites = append(sites, PlacementSite{
+			Name:     fmt.Sprintf("ny-%d", i),
+			Location: GeoLocation{Latitude: 40.7 + float64(i)/100, Longitude: -74.0, Region: "us-east"},
+		})
+	}
+	for i := 0; i < 2; i++ {
+		sites = append(sites,
+			PlacementSite{Name: fmt.Sprintf("ldn-%d", i), Location: GeoLocation{Latitude: 51.5 + float64(i)/100, Longitude: -0.1, Region: "eu-west"}},
+			PlacementSite{Name: fmt.Sprintf("sf-%d", i), Location: GeoLocation{Latitude: 37.8 + float64(i)/100, Longitude: -122.4, Region: "us-west"}},
+		)
+	}
+
+	result, err := RecommendPlacement(context.Background(), NewGeoConfig(), PlacementRequest{
+		Sites:   sites,
+		Count:   5,
+		Traffic: []TrafficSource{{Region: "us-east", Weight: 1}},
+	})
+	require.NoError(t, err)
+	require.False(t, result.Exhaustive)
+
+	regions := make(map[string]int)
+	for _, name := range result.Recommended.Sites {
+		regions[strings.SplitN(name, "-", 2)[0]]++
+	}
+	require.LessOrEqual(t, regions["ny"], 2, result.Recommended.Sites)
+}
+
+func TestHandlePlacementLimitsConcurrentSearches(t *testing.T) {
+	gc := &GeoConsenter{config: NewGeoConfig()}
+	body := `{"sites":[{"name":"a","location":{"latitude":1,"longitude":1,"region":"r1"}},` +
+		`{"name":"b","location":{"latitude":2,"longitude":2,"region":"r2"}},` +
+		`{"name":"c","location":{"latitude":3,"longitude":3,"region":"r3"}}],"count":3}`
+
+	for i := 0; i < placementMaxConcurrent; i++ {
+		require.True(t, gc.acquirePlacement())
+	}
+	recorder := httptest.NewRecorder()
+	gc.handlePlacement(recorder, httptest.NewRequest(http.MethodPost, "/placement", strings.NewReader(body)))
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code, recorder.Body.String())
+
+	gc.releasePlacement()
+	recorder = httptest.NewRecorder()
+	gc.handlePlacement(recorder, httptest.NewRequest(http.MethodPost, "/placement", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	require.Equal(t, placementMaxConcurrent-1, gc.placements)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const prometheusNamespace = "geo_consensus"
+
+// latencyBucketBounds are the Prometheus histogram bucket bounds in seconds,
+// spanning same-zone round trips up to severe cross-continent stalls
+var latencyBucketBounds = [...]float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.075, 0.1,
+	0.15, 0.2, 0.3, 0.5, 0.75, 1, 2.5, 5,
+}
+
+// geoCollector exposes per-chain geo metrics in Prometheus format. Values
+// are read from the chains at scrape time so the exposition never drifts
+// from the JSON view.
+type geoCollector struct {
+	consenter *GeoConsenter
+
+	leaderElections     *prometheus.Desc
+	leadershipChanges   *prometheus.Desc
+	crossRegionMessages *prometheus.Desc
+	transactions        *prometheus.Desc
+	throughput          *prometheus.Desc
+	nodes               *prometheus.Desc
+	isLeader            *prometheus.Desc
+	regionPairLatency   *prometheus.Desc
+	nodePairLatency     *prometheus.Desc
+	quorumCommit        *prometheus.Desc
+	catchUpSelections   *prometheus.Desc
+	catchUpSource       *prometheus.Desc
+	appendBytes         *prometheus.Desc
+	compressionRatio    *prometheus.Desc
+	blockBytes          *prometheus.Desc
+	egressCost          *prometheus.Desc
+	carbonIntensity     *prometheus.Desc
+	emissions           *prometheus.Desc
+	degraded            *prometheus.Desc
+	degradedEntries     *prometheus.Desc
+}
+
+// newGeoCollector creates a collector reading from the given consenter
+func newGeoCollector(consenter *GeoConsenter) *geoCollector {
+	return &geoCollector{
+		consenter: consenter,
+		leaderElections: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "leader_elections_total"),
+			"Number of geo-aware leader elections.",
+			[]string{"channel"}, nil,
+		),
+		leadershipChanges: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "leadership_changes_total"),
+			"Number of elections that moved leadership to a different node.",
+			[]string{"channel"}, nil,
+		),
+		crossRegionMessages: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "cross_region_messages_total"),
+			"Number of consensus messages sent between regions.",
+			[]string{"channel"}, nil,
+		),
+		transactions: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "transactions_total"),
+			"Number of transactions ordered.",
+			[]string{"channel"}, nil,
+		),
+		throughput: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "throughput_tx_per_second"),
+			"Transactions ordered per second over the last metrics interval.",
+			[]string{"channel"}, nil,
+		),
+		nodes: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "nodes"),
+			"Number of registered geo-nodes per region.",
+			[]string{"channel", "region"}, nil,
+		),
+		isLeader: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "node_is_leader"),
+			"Whether the node is the current geo-aware leader (1) or not (0).",
+			[]string{"channel", "node", "region"}, nil,
+		),
+		regionPairLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "region_pair_latency_seconds"),
+			"Measured latency between regions over the rolling latency window.",
+			[]string{"channel", "region_pair"}, nil,
+		),
+		nodePairLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "node_pair_latency_seconds"),
+			"Measured latency between nodes over the rolling latency window.",
+			[]string{"channel", "node", "peer", "region_pair"}, nil,
+		),
+		quorumCommit: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "quorum_commit_latency_seconds"),
+			"Expected commit latency with the node as leader: median latency to its k-th closest follower.",
+			[]string{"channel", "node", "region"}, nil,
+		),
+		catchUpSelections: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "catchup_selections_total"),
+			"Number of catch-up source selections, by whether they fell back to the leader.",
+			[]string{"channel", "fallback"}, nil,
+		),
+		catchUpSource: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "catchup_source"),
+			"Latest catch-up source chosen for a lagging node (always 1).",
+			[]string{"channel", "node", "source", "source_region", "kind", "fallback"}, nil,
+		),
+		appendBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "cross_region_append_bytes_total"),
+			"Bytes of cross-region append messages before (raw) and after (sent) compression.",
+			[]string{"channel", "region_pair", "algorithm", "stage"}, nil,
+		),
+		compressionRatio: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "cross_region_compression_ratio"),
+			"Raw over sent bytes of cross-region append messages.",
+			[]string{"channel", "region_pair", "algorithm"}, nil,
+		),
+		blockBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "block_bytes_total"),
+			"Bytes of the blocks observed on the channel.",
+			[]string{"channel"}, nil,
+		),
+		egressCost: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "projected_monthly_egress_cost"),
+			"Projected monthly consensus egress cost with the node as leader, at the observed block rate.",
+			[]string{"channel", "node", "region"}, nil,
+		),
+		carbonIntensity: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "region_carbon_intensity"),
+			"Current grid carbon intensity of a region, in gCO2eq/kWh.",
+			[]string{"channel", "region"}, nil,
+		),
+		emissions: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "carbon_emissions_grams_total"),
+			"Estimated grams of CO2 equivalent emitted replicating the channel's blocks.",
+			[]string{"channel"}, nil,
+		),
+		degraded: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "degraded_mode"),
+			"Whether the channel is in degraded mode (1) or not (0).",
+			[]string{"channel"}, nil,
+		),
+		degradedEntries: prometheus.NewDesc(
+			prometheus.BuildFQName(prometheusNamespace, "", "degraded_mode_entries_total"),
+			"Number of times the channel entered degraded mode.",
+			[]string{"channel"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *geoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.leaderElections
+	ch <- c.leadershipChanges
+	ch <- c.crossRegionMessages
+	ch <- c.transactions
+	ch <- c.throughput
+	ch <- c.nodes
+	ch <- c.isLeader
+	ch <- c.regionPairLatency
+	ch <- c.nodePairLatency
+	ch <- c.quorumCommit
+	ch <- c.catchUpSelections
+	ch <- c.catchUpSource
+	ch <- c.appendBytes
+	ch <- c.compressionRatio
+	ch <- c.blockBytes
+	ch <- c.egressCost
+	ch <- c.carbonIntensity
+	ch <- c.emissions
+	ch <- c.degraded
+	ch <- c.degradedEntries
+}
+
+// Collect implements prometheus.Collector
+func (c *geoCollector) Collect(ch chan<- prometheus.Metric) {
+	c.consenter.mu.RLock()
+	chains := make(map[string]*GeoEtcdRaft, len(c.consenter.chains))
+	for chainID, chain := range c.consenter.chains {
+		chains[chainID] = chain
+	}
+	c.consenter.mu.RUnlock()
+
+	for chainID, chain := range chains {
+		c.collectChain(ch, chainID, chain)
+	}
+}
+
+// collectChain emits all metrics for a single chain
+func (c *geoCollector) collectChain(ch chan<- prometheus.Metric, chainID string, chain *GeoEtcdRaft) {
+	metrics := chain.GetMetrics()
+
+	ch <- prometheus.MustNewConstMetric(c.leaderElections, prometheus.CounterValue,
+		float64(metrics.LeaderElections), chainID)
+	ch <- prometheus.MustNewConstMetric(c.leadershipChanges, prometheus.CounterValue,
+		float64(metrics.LeadershipChanges), chainID)
+	ch <- prometheus.MustNewConstMetric(c.crossRegionMessages, prometheus.CounterValue,
+		float64(metrics.CrossRegionMessages), chainID)
+	ch <- prometheus.MustNewConstMetric(c.transactions, prometheus.CounterValue,
+		float64(metrics.TotalTransactions), chainID)
+	ch <- prometheus.MustNewConstMetric(c.throughput, prometheus.GaugeValue,
+		metrics.ThroughputPerSecond, chainID)
+
+	chain.mu.RLock()
+	regionCounts := make(map[string]int)
+	nodeRegions := make(map[uint64]string, len(chain.nodes))
+	for nodeID, node := range chain.nodes {
+		regionCounts[node.Location.Region]++
+		nodeRegions[nodeID] = node.Location.Region
+
+		leader := 0.0
+		if node.IsLeader {
+			leader = 1.0
+		}
+		ch <- prometheus.MustNewConstMetric(c.isLeader, prometheus.GaugeValue,
+			leader, chainID, strconv.FormatUint(nodeID, 10), node.Location.Region)
+	}
+	chain.mu.RUnlock()
+
+	for nodeID, latency := range metrics.QuorumCommitLatency {
+		ch <- prometheus.MustNewConstMetric(c.quorumCommit, prometheus.GaugeValue,
+			latency.Seconds(), chainID, strconv.FormatUint(nodeID, 10), nodeRegions[nodeID])
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.catchUpSelections, prometheus.CounterValue,
+		float64(metrics.CatchUpSelections-metrics.CatchUpFallbacks), chainID, "false")
+	ch <- prometheus.MustNewConstMetric(c.catchUpSelections, prometheus.CounterValue,
+		float64(metrics.CatchUpFallbacks), chainID, "true")
+	for nodeID, selection := range metrics.CatchUpSources {
+		ch <- prometheus.MustNewConstMetric(c.catchUpSource, prometheus.GaugeValue, 1,
+			chainID, strconv.FormatUint(nodeID, 10), strconv.FormatUint(selection.Source, 10),
+			selection.SourceRegion, selection.Kind, strconv.FormatBool(selection.Fallback))
+	}
+
+	for regionPair, stats := range metrics.Compression {
+		ch <- prometheus.MustNewConstMetric(c.appendBytes, prometheus.CounterValue,
+			float64(stats.RawBytes), chainID, regionPair, stats.Algorithm, "raw")
+		ch <- prometheus.MustNewConstMetric(c.appendBytes, prometheus.CounterValue,
+			float64(stats.SentBytes), chainID, regionPair, stats.Algorithm, "sent")
+		ch <- prometheus.MustNewConstMetric(c.compressionRatio, prometheus.GaugeValue,
+			stats.Ratio, chainID, regionPair, stats.Algorithm)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.blockBytes, prometheus.CounterValue,
+		float64(metrics.EgressCost.BlockBytes), chainID)
+	for nodeID, cost := range metrics.EgressCost.MonthlyCost {
+		ch <- prometheus.MustNewConstMetric(c.egressCost, prometheus.GaugeValue,
+			cost, chainID, strconv.FormatUint(nodeID, 10), nodeRegions[nodeID])
+	}
+
+	degraded := 0.0
+	if metrics.Degraded.Active {
+		degraded = 1.0
+	}
+	ch <- prometheus.MustNewConstMetric(c.degraded, prometheus.GaugeValue, degraded, chainID)
+	ch <- prometheus.MustNewConstMetric(c.degradedEntries, prometheus.CounterValue,
+		float64(metrics.Degraded.Entries), chainID)
+
+	ch <- prometheus.MustNewConstMetric(c.emissions, prometheus.CounterValue,
+		metrics.Carbon.EmissionsGrams, chainID)
+	for region, intensity := range metrics.Carbon.RegionIntensity {
+		ch <- prometheus.MustNewConstMetric(c.carbonIntensity, prometheus.GaugeValue,
+			intensity, chainID, region)
+	}
+
+	for region, count := range regionCounts {
+		ch <- prometheus.MustNewConstMetric(c.nodes, prometheus.GaugeValue,
+			float64(count), chainID, region)
+	}
+
+	now := chain.now()
+	for regionPair, histogram := range chain.latencies.regionPairHistograms(now) {
+		ch <- constLatencyHistogram(c.regionPairLatency, histogram, chainID, regionPair)
+	}
+
+	for key, histogram := range chain.latencies.nodePairHistograms(now) {
+		var from, to uint64
+		if _, err := fmt.Sscanf(key, "%d-%d", &from, &to); err != nil {
+			continue
+		}
+		ch <- constLatencyHistogram(c.nodePairLatency, histogram, chainID,
+			strconv.FormatUint(from, 10), strconv.FormatUint(to, 10),
+			regionPairKey(nodeRegions[from], nodeRegions[to]))
+	}
+}
+
+// constLatencyHistogram converts a latency histogram into a Prometheus histogram
+func constLatencyHistogram(desc *prometheus.Desc, histogram *LatencyHistogram, labelValues ...string) prometheus.Metric {
+	return prometheus.MustNewConstHistogram(desc,
+		uint64(histogram.Count()),
+		histogram.Sum().Seconds(),
+		histogram.CumulativeCounts(),
+		labelValues...,
+	)
+}
+
+// newPrometheusRegistry builds the registry served on /metrics
+func newPrometheusRegistry(consenter *GeoConsenter) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		newGeoCollector(consenter),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
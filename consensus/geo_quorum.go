@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// quorumSize returns the number of nodes a raft quorum needs
+func quorumSize(nodes int) int {
+	return nodes/2 + 1
+}
+
+// leaderQuorumLatency returns the latency until a leader has acks from
+// enough followers to commit, i.e. the latency to its k-th closest
+// follower where k is the quorum size minus the leader itself, using the
+// latest measured latencies. Callers must hold g.mu.
+func (g *GeoEtcdRaft) leaderQuorumLatency(leaderID uint64) time.Duration {
+	return g.quorumLatency(leaderID, g.pairLatency)
+}
+
+// quorumCommitLatency returns the expected commit latency with the given
+// leader: the latency to its k-th closest follower, using the median
+// latency of each pair over the latency window. Callers must hold g.mu.
+func (g *GeoEtcdRaft) quorumCommitLatency(leaderID uint64) time.Duration {
+	return g.quorumLatency(leaderID, g.expectedLatency)
+}
+
+// quorumLatency returns the k-th smallest latency from the leader to its
+// followers, where k is the quorum size minus the leader. Blocked nodes
+// still vote and count as followers. Callers must hold g.mu.
+func (g *GeoEtcdRaft) quorumLatency(leaderID uint64, latency func(from, to uint64) time.Duration) time.Duration {
+	var latencies []time.Duration
+	for otherID := range g.nodes {
+		if otherID != leaderID {
+			latencies = append(latencies, latency(leaderID, otherID))
+		}
+	}
+
+	k := quorumSize(len(g.nodes)) - 1
+	if k <= 0 || len(latencies) < k {
+		return 0
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[k-1]
+}
+
+// expectedLatency returns the median latency between two nodes over the
+// latency window, in either direction, falling back to the latest
+// measurement or the distance estimate. Callers must hold g.mu.
+func (g *GeoEtcdRaft) expectedLatency(from, to uint64) time.Duration {
+	now := g.now()
+	if histogram := g.latencies.nodePairHistogram(now, from, to); histogram.Count() > 0 {
+		return histogram.Percentile(50)
+	}
+	if histogram := g.latencies.nodePairHistogram(now, to, from); histogram.Count() > 0 {
+		return histogram.Percentile(50)
+	}
+	return g.pairLatency(from, to)
+}
+
+// quorumCommitLatencies returns the expected commit latency of every node
+// as leader. Callers must hold g.mu.
+func (g *GeoEtcdRaft) quorumCommitLatencies() map[uint64]time.Duration {
+	latencies := make(map[uint64]time.Duration, len(g.nodes))
+	for nodeID := range g.nodes {
+		latencies[nodeID] = g.quorumCommitLatency(nodeID)
+	}
+	return latencies
+}
+
+// QuorumCommitLatencies returns the expected commit latency of every node
+// as leader
+func (g *GeoEtcdRaft) QuorumCommitLatencies() map[uint64]time.Duration {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.quorumCommitLatencies()
+}
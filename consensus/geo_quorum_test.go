@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// quorumChain returns a chain with the given number of nodes around New York
+func quorumChain(t *testing.T, nodes int) *GeoEtcdRaft {
+	chain := NewGeoEtcdRaft(nil, NewGeoConfig())
+	for i := 1; i <= nodes; i++ {
+		require.NoError(t, chain.RegisterNode(uint64(i), GeoLocation{
+			Latitude:  40.7 + float64(i)/10,
+			Longitude: -74.0,
+			Region:    fmt.Sprintf("region-%d", i),
+		}))
+	}
+	return chain
+}
+
+func TestQuorumLatencyUsesKthClosestFollower(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		followers map[uint64]time.Duration
+		blocked   []uint64
+		expected  time.Duration
+	}{
+		{
+			name:      "three nodes wait for the closest follower",
+			followers: map[uint64]time.Duration{2: 80 * time.Millisecond, 3: 30 * time.Millisecond},
+			expected:  30 * time.Millisecond,
+		},
+		{
+			name:      "five nodes wait for the second closest follower",
+			followers: map[uint64]time.Duration{2: 90 * time.Millisecond, 3: 10 * time.Millisecond, 4: 70 * time.Millisecond, 5: 20 * time.Millisecond},
+			expected:  20 * time.Millisecond,
+		},
+		{
+			name:      "blocked followers still acknowledge in three nodes",
+			followers: map[uint64]time.Duration{2: 80 * time.Millisecond, 3: 30 * time.Millisecond},
+			blocked:   []uint64{3},
+			expected:  30 * time.Millisecond,
+		},
+		{
+			name:      "blocked followers still acknowledge in five nodes",
+			followers: map[uint64]time.Duration{2: 90 * time.Millisecond, 3: 10 * time.Millisecond, 4: 70 * time.Millisecond, 5: 20 * time.Millisecond},
+			blocked:   []uint64{3, 5},
+			expected:  20 * time.Millisecond,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chain := quorumChain(t, len(tc.followers)+1)
+			for _, nodeID := range tc.blocked {
+				require.NoError(t, chain.SetLeadershipBlocked(nodeID, true))
+			}
+
+			latency := func(from, to uint64) time.Duration {
+				require.Equal(t, uint64(1), from)
+				return tc.followers[to]
+			}
+			chain.mu.RLock()
+			defer chain.mu.RUnlock()
+			require.Equal(t, tc.expected, chain.quorumLatency(1, latency))
+		})
+	}
+}
+
+func TestQuorumLatencyWithoutFollowers(t *testing.T) {
+	chain := quorumChain(t, 1)
+	require.Equal(t, time.Duration(0), chain.QuorumCommitLatencies()[1])
+}
+
+func TestExpectedLatencyUsesWindowMedian(t *testing.T) {
+	chain := quorumChain(t, 3)
+	clock := NewVirtualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	chain.SetClock(clock)
+
+	chain.mu.Lock()
+	chain.nodes[1].Latency = map[uint64]time.Duration{2: 500 * time.Millisecond}
+	chain.mu.Unlock()
+
+	// Without samples the latest measurement is used, and the distance
+	// estimate without a measurement
+	chain.mu.RLock()
+	require.Equal(t, 500*time.Millisecond, chain.expectedLatency(1, 2))
+	require.Equal(t, chain.estimateLatency(chain.nodes[1].Location, chain.nodes[3].Location), chain.expectedLatency(1, 3))
+	chain.mu.RUnlock()
+
+	chain.mu.Lock()
+	chain.nodes[1].Latency[3] = 700 * time.Millisecond
+	chain.mu.Unlock()
+
+	// The median of the window outweighs a single spike, whichever
+	// direction the samples were taken in
+	median := NewLatencyHistogram()
+	for _, sample := range []time.Duration{40 * time.Millisecond, 50 * time.Millisecond, 900 * time.Millisecond} {
+		chain.latencies.record(clock.Now(), chain.nodes[2], chain.nodes[1], sample)
+		median.Record(sample)
+	}
+	chain.mu.RLock()
+	require.Equal(t, median.Percentile(50), chain.expectedLatency(1, 2))
+	require.InDelta(t, float64(50*time.Millisecond), float64(chain.expectedLatency(1, 2)), float64(time.Millisecond))
+	require.Equal(t, chain.expectedLatency(1, 2), chain.quorumCommitLatency(1))
+	chain.mu.RUnlock()
+
+	// Once the samples leave the window the latest measurement is used again
+	clock.Advance(defaultLatencyWindow)
+	chain.mu.RLock()
+	require.Equal(t, 500*time.Millisecond, chain.expectedLatency(1, 2))
+	chain.mu.RUnlock()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/orderer/consensus"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+)
+
+// RaftChainBuilder builds the etcdraft chain of a channel for HandleChain.
+// The orderer provides it, since only the orderer holds the cluster
+// communication, crypto provider and block puller an etcdraft chain needs.
+type RaftChainBuilder interface {
+	// RaftOptions returns the options the channel's chain is built with
+	RaftOptions(support consensus.ConsenterSupport) (etcdraft.Options, error)
+
+	// RPC returns the cluster transport of the channel
+	RPC(channelID string) etcdraft.RPC
+
+	// NewChain builds the chain. support and rpc are the geo layer's
+	// wrappers, which the chain must write blocks and send raft messages
+	// through.
+	NewChain(support consensus.ConsenterSupport, opts etcdraft.Options, rpc etcdraft.RPC) (*etcdraft.Chain, error)
+
+	// ApplyTimeouts makes a running chain use the heartbeat and election
+	// ticks of opts. It is called when degraded mode changes the channel's
+	// consensus timeouts.
+	ApplyTimeouts(chain *etcdraft.Chain, opts etcdraft.Options) error
+}
+
+// UseRaftChainBuilder sets the builder HandleChain creates etcdraft chains
+// with. HandleChain fails until a builder is set.
+func (gc *GeoConsenter) UseRaftChainBuilder(builder RaftChainBuilder) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	gc.chainBuilder = builder
+}
+
+// newRaftChain builds the etcdraft chain underneath geoChain, wiring the
+// geo layer into its block writes and raft transport
+func newRaftChain(builder RaftChainBuilder, geoChain *GeoEtcdRaft, support consensus.ConsenterSupport) (*etcdraft.Chain, error) {
+	opts, err := builder.RaftOptions(support)
+	if err != nil {
+		return nil, err
+	}
+
+	// The local node and base timeouts must be known before the transport
+	// frames its first message
+	geoChain.UseRaftOptions(opts)
+	rpc := geoChain.WrapRPC(builder.RPC(support.ChannelID()))
+	chain, err := builder.NewChain(geoChain.WrapSupport(support), opts, rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	channelID := support.ChannelID()
+	geoChain.OnTimeoutsChanged(func(timeouts ConsensusTimeouts) {
+		if err := builder.ApplyTimeouts(chain, raftTimeoutOptions(opts, timeouts)); err != nil {
+			consenterLogger.Errorf("Failed to apply consensus timeouts %v to channel %s: %v", timeouts, channelID, err)
+		}
+	})
+	return chain, nil
+}
+
+// raftTimeoutOptions returns opts with the heartbeat and election ticks that
+// cover timeouts, rounded up to whole ticks. The election timeout stays
+// longer than the heartbeat, as etcd raft requires.
+func raftTimeoutOptions(opts etcdraft.Options, timeouts ConsensusTimeouts) etcdraft.Options {
+	if opts.TickInterval <= 0 {
+		return opts
+	}
+
+	ticks := func(d time.Duration) int {
+		return int((d + opts.TickInterval - 1) / opts.TickInterval)
+	}
+	opts.HeartbeatTick = ticks(timeouts.HeartbeatInterval)
+	if opts.HeartbeatTick < 1 {
+		opts.HeartbeatTick = 1
+	}
+	opts.ElectionTick = ticks(timeouts.ElectionTimeout)
+	if opts.ElectionTick <= opts.HeartbeatTick {
+		opts.ElectionTick = opts.HeartbeatTick + 1
+	}
+	return opts
+}
@@ -0,0 +1,685 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Leader election policies of a replay strategy
+const (
+	// ReplayElectionGeo re-runs the geo leader election every round
+	ReplayElectionGeo = "geo"
+	// ReplayElectionStatic keeps the leader of the topology, as plain
+	// etcdraft does while the leader is healthy
+	ReplayElectionStatic = "static"
+)
+
+// allRegions selects every region of the topology in a workload
+const allRegions = "*"
+
+// ReplayStrategy is a configuration to evaluate in a replay. Config holds
+// GeoConfig fields that override the topology's configuration.
+type ReplayStrategy struct {
+	Name     string          `json:"name"`
+	Election string          `json:"election"`
+	Config   json.RawMessage `json:"config,omitempty"`
+}
+
+// defaultReplayStrategies compares plain etcdraft with the geo scoring
+// modes
+var defaultReplayStrategies = []ReplayStrategy{
+	{Name: "standard", Election: ReplayElectionStatic},
+	{Name: "geoAware", Election: ReplayElectionGeo, Config: json.RawMessage(`{"scoring_mode":"proximity"}`)},
+	{Name: "geoAwareTailLatency", Election: ReplayElectionGeo, Config: json.RawMessage(`{"scoring_mode":"tail-latency"}`)},
+	{Name: "geoAwareQuorum", Election: ReplayElectionGeo, Config: json.RawMessage(`{"scoring_mode":"quorum-latency"}`)},
+}
+
+// ReplayWorkload describes the transactions driven through a replay
+type ReplayWorkload struct {
+	Peers         int                 `json:"peers"`
+	Organizations int                 `json:"organizations"`
+	Transactions  []ReplayTransaction `json:"transactions"`
+}
+
+// ReplayTransaction is a class of transactions. Clients in each of
+// ClientRegions (every region if empty) keep Concurrency transactions in
+// flight, each endorsed in EndorserRegions (the client's own region if
+// empty, "*" for every region) and then ordered. A transaction slower than
+// TimeoutMs, if set, fails.
+type ReplayTransaction struct {
+	Name            string   `json:"name"`
+	ClientRegions   []string `json:"client_regions"`
+	EndorserRegions []string `json:"endorser_regions"`
+	Concurrency     int      `json:"concurrency"`
+	TimeoutMs       float64  `json:"timeout_ms"`
+}
+
+// ReplayReport is the result of a replay, in the format of
+// geo-performance-analysis.json
+type ReplayReport struct {
+	Timestamp            time.Time                  `json:"timestamp"`
+	Title                string                     `json:"title"`
+	Version              string                     `json:"version"`
+	NetworkConfiguration ReplayNetworkConfiguration `json:"networkConfiguration"`
+	Results              ReplayResults              `json:"results"`
+	KeyFindings          []string                   `json:"keyFindings"`
+}
+
+// ReplayNetworkConfiguration describes the replayed network
+type ReplayNetworkConfiguration struct {
+	Orderers           int      `json:"orderers"`
+	Peers              int      `json:"peers"`
+	Organizations      int      `json:"organizations"`
+	Regions            []string `json:"regions"`
+	ConsensusAlgorithm string   `json:"consensusAlgorithm"`
+}
+
+// ReplayResults holds the per-strategy metrics of a replay.
+// PerformanceMetrics is keyed by strategy and transaction class,
+// GeoOptimizations compares the compared strategy with the baseline and
+// ComparativeAnalysis compares every strategy with the baseline.
+type ReplayResults struct {
+	NetworkTopology     ReplayNetworkTopology                   `json:"networkTopology"`
+	PerformanceMetrics  map[string]map[string]ReplayMetrics     `json:"performanceMetrics"`
+	GeoOptimizations    map[string]ReplayImprovement            `json:"geoOptimizations"`
+	ComparativeAnalysis map[string]map[string]ReplayImprovement `json:"comparativeAnalysis"`
+	Strategies          map[string]*StrategyReport              `json:"strategies"`
+}
+
+// ReplayNetworkTopology holds region centroids and the distance (km) and
+// mean replayed latency (ms) between each pair of regions
+type ReplayNetworkTopology struct {
+	Regions   map[string]ReplayRegion `json:"regions"`
+	Distances map[string]string       `json:"distances"`
+	Latencies map[string]string       `json:"latencies"`
+}
+
+// ReplayRegion is the centroid of a region's nodes
+type ReplayRegion struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	Name string  `json:"name"`
+}
+
+// ReplayMetrics are the metrics of a transaction class under a strategy.
+// AverageLatency is in milliseconds, Throughput in committed transactions
+// per second and SuccessRate in percent.
+type ReplayMetrics struct {
+	AverageLatency float64 `json:"averageLatency"`
+	Throughput     float64 `json:"throughput"`
+	SuccessRate    float64 `json:"successRate"`
+}
+
+// ReplayImprovement is the relative improvement of a strategy over the
+// baseline, in percent
+type ReplayImprovement struct {
+	LatencyImprovement     string `json:"latencyImprovement"`
+	ThroughputImprovement  string `json:"throughputImprovement"`
+	ReliabilityImprovement string `json:"reliabilityImprovement"`
+}
+
+// StrategyReport summarizes the consensus behaviour of a strategy. Config
+// repeats the strategy's overrides rather than the whole GeoConfig, which
+// may hold API credentials. CommitLatencyByRegion is the mean ordering
+// latency in milliseconds seen by clients in each region, excluding
+// endorsement.
+type StrategyReport struct {
+	Election              string             `json:"election"`
+	ScoringMode           string             `json:"scoringMode"`
+	Config                json.RawMessage    `json:"config,omitempty"`
+	Rounds                int                `json:"rounds"`
+	CommitLatencyByRegion map[string]float64 `json:"commitLatencyByRegion"`
+	LeaderChanges         int                `json:"leaderChanges"`
+	LeaderElections       int64              `json:"leaderElections"`
+	LeaderRounds          map[uint64]int     `json:"leaderRounds"`
+	CrossRegionMessages   int64              `json:"crossRegionMessages"`
+}
+
+// replayRun is a replay of a trace against one topology
+type replayRun struct {
+	base     *GeoEtcdRaft
+	trace    *LatencyTrace
+	workload ReplayWorkload
+	start    time.Time
+	interval time.Duration
+	regions  []string
+}
+
+// classTotals accumulates the transactions of a class
+type classTotals struct {
+	latencySum float64
+	count      float64
+	succeeded  float64
+}
+
+// replayRound holds what a strategy saw in one round
+type replayRound struct {
+	leaderID      uint64
+	commit        map[string]time.Duration
+	regionLatency map[string]time.Duration
+	meanLatency   map[string]time.Duration
+}
+
+// ReplayStrategies replays a latency trace against a topology once per
+// strategy and reports the commit latency, leader changes and cross-region
+// messages of each. The first strategy is the baseline and compare names
+// the strategy reported in geoOptimizations (the second if empty).
+func ReplayStrategies(base *GeoEtcdRaft, trace *LatencyTrace, workload ReplayWorkload, strategies []ReplayStrategy, start time.Time, interval time.Duration, compare string) (*ReplayReport, error) {
+	if len(strategies) == 0 {
+		return nil, fmt.Errorf("no strategies to replay")
+	}
+	if interval <= 0 {
+		interval = defaultReplayInterval
+	}
+
+	base.mu.RLock()
+	run := &replayRun{
+		base:     base,
+		trace:    trace,
+		workload: workload,
+		start:    start,
+		interval: interval,
+		regions:  base.getUniqueRegions(),
+	}
+	base.mu.RUnlock()
+	sort.Strings(run.regions)
+
+	if err := run.validate(strategies); err != nil {
+		return nil, err
+	}
+	if compare == "" && len(strategies) > 1 {
+		compare = strategies[1].Name
+	}
+	if compare != "" {
+		found := false
+		for _, strategy := range strategies[1:] {
+			found = found || strategy.Name == compare
+		}
+		if !found {
+			return nil, fmt.Errorf("compared strategy %s is not one of the replayed strategies other than the baseline", compare)
+		}
+	}
+
+	report := &ReplayReport{
+		Timestamp: time.Now(),
+		Title:     "Geo-Aware Hyperledger Fabric Strategy Replay",
+		Version:   "1.0.0",
+		NetworkConfiguration: ReplayNetworkConfiguration{
+			Orderers:           len(base.nodes),
+			Peers:              workload.Peers,
+			Organizations:      workload.Organizations,
+			Regions:            run.regions,
+			ConsensusAlgorithm: "Geo-Aware etcdraft (replay)",
+		},
+		Results: ReplayResults{
+			PerformanceMetrics:  make(map[string]map[string]ReplayMetrics),
+			GeoOptimizations:    make(map[string]ReplayImprovement),
+			ComparativeAnalysis: make(map[string]map[string]ReplayImprovement),
+			Strategies:          make(map[string]*StrategyReport),
+		},
+		KeyFindings: []string{},
+	}
+
+	var meanLatency map[string][]time.Duration
+	for i, strategy := range strategies {
+		metrics, summary, latencies, err := run.replay(strategy)
+		if err != nil {
+			return nil, fmt.Errorf("strategy %s: %v", strategy.Name, err)
+		}
+		report.Results.PerformanceMetrics[strategy.Name] = metrics
+		report.Results.Strategies[strategy.Name] = summary
+		if i == 0 {
+			meanLatency = latencies
+		}
+	}
+
+	report.Results.NetworkTopology = run.networkTopology(meanLatency)
+
+	baseline := strategies[0].Name
+	for _, strategy := range strategies[1:] {
+		comparison := make(map[string]ReplayImprovement)
+		for class, metrics := range report.Results.PerformanceMetrics[strategy.Name] {
+			comparison[class] = improvement(report.Results.PerformanceMetrics[baseline][class], metrics)
+		}
+		report.Results.ComparativeAnalysis[strategy.Name] = comparison
+		if strategy.Name == compare {
+			report.Results.GeoOptimizations = comparison
+		}
+	}
+
+	report.KeyFindings = run.keyFindings(report, strategies, compare)
+	return report, nil
+}
+
+// validate checks the strategies and workload against the topology
+func (r *replayRun) validate(strategies []ReplayStrategy) error {
+	if len(r.base.nodes) == 0 {
+		return fmt.Errorf("topology has no nodes")
+	}
+	if len(r.workload.Transactions) == 0 {
+		return fmt.Errorf("workload has no transactions")
+	}
+
+	known := make(map[string]bool)
+	for _, region := range r.regions {
+		known[region] = true
+	}
+	for _, tx := range r.workload.Transactions {
+		if tx.Name == "" {
+			return fmt.Errorf("workload transaction without a name")
+		}
+		for _, region := range append(append([]string{}, tx.ClientRegions...), tx.EndorserRegions...) {
+			if region != allRegions && !known[region] {
+				return fmt.Errorf("transaction %q: region %s has no nodes in the topology", tx.Name, region)
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, strategy := range strategies {
+		if strategy.Name == "" {
+			return fmt.Errorf("strategy without a name")
+		}
+		if names[strategy.Name] {
+			return fmt.Errorf("duplicate strategy %s", strategy.Name)
+		}
+		names[strategy.Name] = true
+		if strategy.Election != "" && strategy.Election != ReplayElectionGeo && strategy.Election != ReplayElectionStatic {
+			return fmt.Errorf("strategy %s: unknown election %q, use %s or %s", strategy.Name, strategy.Election, ReplayElectionGeo, ReplayElectionStatic)
+		}
+	}
+	return nil
+}
+
+// replay runs the trace under one strategy on a copy of the topology
+func (r *replayRun) replay(strategy ReplayStrategy) (map[string]ReplayMetrics, *StrategyReport, map[string][]time.Duration, error) {
+	chain := r.base.clone()
+
+	config := chain.config.Clone()
+	if len(strategy.Config) > 0 {
+		if err := json.Unmarshal(strategy.Config, config); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid config: %v", err)
+		}
+	}
+	chain.UpdateConfig(config)
+
+	election := strategy.Election
+	if election == "" {
+		election = ReplayElectionGeo
+	}
+
+	chain.mu.RLock()
+	leaderID := chain.leaderID()
+	candidates := chain.nodeIDs()
+	chain.mu.RUnlock()
+	if leaderID == 0 {
+		// Without a recorded leader plain etcdraft would elect whichever
+		// node times out first; take the lowest ID
+		leaderID = candidates[0]
+	}
+
+	summary := &StrategyReport{
+		Election:              election,
+		ScoringMode:           config.ScoringMode,
+		Config:                strategy.Config,
+		CommitLatencyByRegion: make(map[string]float64),
+		LeaderRounds:          make(map[uint64]int),
+	}
+	totals := make(map[string]*classTotals)
+	commitSums := make(map[string]time.Duration)
+	meanLatency := make(map[string][]time.Duration)
+	var crossRegion float64
+
+	chain.ReplayLatencyTrace(r.trace, r.start, r.interval, func(at time.Time) {
+		if election == ReplayElectionGeo {
+			if elected := chain.electLeader(candidates, "replay"); elected != 0 && elected != leaderID {
+				leaderID = elected
+				summary.LeaderChanges++
+			}
+		}
+
+		round := r.observe(chain, leaderID)
+		summary.Rounds++
+		summary.LeaderRounds[leaderID]++
+		for region, latency := range round.commit {
+			commitSums[region] += latency
+		}
+		for pair, latency := range round.meanLatency {
+			meanLatency[pair] = append(meanLatency[pair], latency)
+		}
+		crossRegion += r.driveWorkload(chain, round, totals)
+	})
+
+	chain.mu.RLock()
+	summary.LeaderElections = chain.metrics.LeaderElections
+	chain.mu.RUnlock()
+	summary.CrossRegionMessages = int64(math.Round(crossRegion))
+
+	if summary.Rounds == 0 {
+		return nil, nil, nil, fmt.Errorf("trace has no rounds")
+	}
+	for region, sum := range commitSums {
+		summary.CommitLatencyByRegion[region] = roundTo(durationMs(sum)/float64(summary.Rounds), 2)
+	}
+
+	elapsed := (time.Duration(summary.Rounds) * r.interval).Seconds()
+	metrics := make(map[string]ReplayMetrics)
+	for _, tx := range r.workload.Transactions {
+		total := totals[tx.Name]
+		if total == nil || total.count == 0 {
+			metrics[tx.Name] = ReplayMetrics{}
+			continue
+		}
+		metrics[tx.Name] = ReplayMetrics{
+			AverageLatency: roundTo(total.latencySum/total.count, 2),
+			Throughput:     roundTo(total.succeeded/elapsed, 2),
+			SuccessRate:    roundTo(100*total.succeeded/total.count, 2),
+		}
+	}
+
+	return metrics, summary, meanLatency, nil
+}
+
+// observe records the commit latency per region and the latencies between
+// regions at the current round
+func (r *replayRun) observe(chain *GeoEtcdRaft, leaderID uint64) replayRound {
+	chain.mu.RLock()
+	defer chain.mu.RUnlock()
+
+	round := replayRound{
+		leaderID:      leaderID,
+		commit:        chain.regionCommitLatency(leaderID),
+		regionLatency: make(map[string]time.Duration),
+		meanLatency:   make(map[string]time.Duration),
+	}
+
+	sums := make(map[string]time.Duration)
+	counts := make(map[string]int)
+	for nodeID, node := range chain.nodes {
+		for otherID, other := range chain.nodes {
+			if nodeID >= otherID {
+				continue
+			}
+			latency := chain.pairLatency(nodeID, otherID)
+			key := regionPairKey(node.Location.Region, other.Location.Region)
+			if current, exists := round.regionLatency[key]; !exists || latency < current {
+				round.regionLatency[key] = latency
+			}
+			if node.Location.Region != other.Location.Region {
+				key = replayPairName(node.Location.Region, other.Location.Region)
+				sums[key] += latency
+				counts[key]++
+			}
+		}
+	}
+	for key, sum := range sums {
+		round.meanLatency[key] = sum / time.Duration(counts[key])
+	}
+
+	return round
+}
+
+// driveWorkload runs one round of every transaction class and returns the
+// cross-region messages it caused. Each transaction costs a proposal and a
+// response per remote endorsing region, a forward to the leader if the
+// client's orderer is in another region, and an append and an ack per
+// follower outside the leader's region.
+func (r *replayRun) driveWorkload(chain *GeoEtcdRaft, round replayRound, totals map[string]*classTotals) float64 {
+	chain.mu.RLock()
+	leaderRegion := chain.nodes[round.leaderID].Location.Region
+	var replication float64
+	for _, node := range chain.nodes {
+		if node.Location.Region != leaderRegion {
+			replication += 2
+		}
+	}
+	chain.mu.RUnlock()
+
+	var messages float64
+	for _, tx := range r.workload.Transactions {
+		total := totals[tx.Name]
+		if total == nil {
+			total = &classTotals{}
+			totals[tx.Name] = total
+		}
+
+		concurrency := tx.Concurrency
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+
+		for _, client := range r.expand(tx.ClientRegions, nil) {
+			var endorsement time.Duration
+			var remoteEndorsers float64
+			for _, endorser := range r.expand(tx.EndorserRegions, []string{client}) {
+				if endorser == client {
+					continue
+				}
+				remoteEndorsers++
+				if latency := round.regionLatency[regionPairKey(client, endorser)]; latency > endorsement {
+					endorsement = latency
+				}
+			}
+
+			latency := endorsement + round.commit[client]
+			ms := durationMs(latency)
+
+			// Clients wait for each transaction before sending the next
+			count := float64(concurrency) * r.interval.Seconds()
+			if latency > 0 {
+				count = float64(concurrency) * r.interval.Seconds() / latency.Seconds()
+			}
+
+			total.count += count
+			total.latencySum += ms * count
+			if tx.TimeoutMs <= 0 || ms <= tx.TimeoutMs {
+				total.succeeded += count
+			}
+
+			perTx := 2*remoteEndorsers + replication
+			if client != leaderRegion {
+				perTx++
+			}
+			messages += perTx * count
+		}
+	}
+
+	return messages
+}
+
+// expand resolves a region list of a workload
+func (r *replayRun) expand(regions []string, fallback []string) []string {
+	if len(regions) == 0 {
+		if fallback != nil {
+			return fallback
+		}
+		return r.regions
+	}
+	for _, region := range regions {
+		if region == allRegions {
+			return r.regions
+		}
+	}
+	return regions
+}
+
+// networkTopology describes the regions of the topology and the mean
+// latency between them over the baseline replay
+func (r *replayRun) networkTopology(meanLatency map[string][]time.Duration) ReplayNetworkTopology {
+	r.base.mu.RLock()
+	defer r.base.mu.RUnlock()
+
+	topology := ReplayNetworkTopology{
+		Regions:   make(map[string]ReplayRegion),
+		Distances: make(map[string]string),
+		Latencies: make(map[string]string),
+	}
+
+	counts := make(map[string]int)
+	centroids := make(map[string]*GeoLocation)
+	for _, node := range r.base.nodes {
+		region := node.Location.Region
+		if centroids[region] == nil {
+			centroids[region] = &GeoLocation{Region: region}
+		}
+		centroids[region].Latitude += node.Location.Latitude
+		centroids[region].Longitude += node.Location.Longitude
+		counts[region]++
+	}
+	for region, centroid := range centroids {
+		centroid.Latitude /= float64(counts[region])
+		centroid.Longitude /= float64(counts[region])
+		topology.Regions[region] = ReplayRegion{Lat: centroid.Latitude, Lon: centroid.Longitude, Name: region}
+	}
+
+	for i, from := range r.regions {
+		for _, to := range r.regions[i+1:] {
+			key := replayPairName(from, to)
+			topology.Distances[key] = fmt.Sprintf("%.0f", r.base.calculateDistance(*centroids[from], *centroids[to]))
+
+			samples := meanLatency[key]
+			if len(samples) == 0 {
+				continue
+			}
+			var sum time.Duration
+			for _, latency := range samples {
+				sum += latency
+			}
+			topology.Latencies[key] = fmt.Sprintf("%.1f", durationMs(sum)/float64(len(samples)))
+		}
+	}
+
+	return topology
+}
+
+// keyFindings summarizes how each strategy compares with the baseline
+func (r *replayRun) keyFindings(report *ReplayReport, strategies []ReplayStrategy, compare string) []string {
+	findings := []string{}
+	baseline := strategies[0].Name
+
+	if compare != "" {
+		for _, tx := range r.workload.Transactions {
+			before := report.Results.PerformanceMetrics[baseline][tx.Name]
+			after := report.Results.PerformanceMetrics[compare][tx.Name]
+			if before.AverageLatency == 0 {
+				continue
+			}
+			change := percentChange(before.AverageLatency, after.AverageLatency)
+			direction := "reduces"
+			if change > 0 {
+				direction = "increases"
+			}
+			findings = append(findings, fmt.Sprintf("%s %s %s latency by %.1f%% compared to %s (%.1fms vs %.1fms)",
+				compare, direction, tx.Name, math.Abs(change), baseline, after.AverageLatency, before.AverageLatency))
+		}
+	}
+
+	for _, strategy := range strategies {
+		summary := report.Results.Strategies[strategy.Name]
+		findings = append(findings, fmt.Sprintf("%s: %d leader changes and %d cross-region messages over %d rounds",
+			strategy.Name, summary.LeaderChanges, summary.CrossRegionMessages, summary.Rounds))
+	}
+
+	return findings
+}
+
+// improvement compares a strategy's metrics with the baseline's
+func improvement(baseline, metrics ReplayMetrics) ReplayImprovement {
+	return ReplayImprovement{
+		LatencyImprovement:     fmt.Sprintf("%.1f", -percentChange(baseline.AverageLatency, metrics.AverageLatency)),
+		ThroughputImprovement:  fmt.Sprintf("%.1f", percentChange(baseline.Throughput, metrics.Throughput)),
+		ReliabilityImprovement: fmt.Sprintf("%.2f", percentChange(baseline.SuccessRate, metrics.SuccessRate)),
+	}
+}
+
+// percentChange returns the change from before to after in percent
+func percentChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before * 100
+}
+
+// replayPairName names a pair of regions as in geo-performance-analysis.json
+func replayPairName(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + " ↔ " + b
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// roundTo rounds a value to the given number of decimals
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// runReplay implements the replay command
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	topologyFile := flags.String("topology", "", "saved response of the /topology endpoint (required)")
+	channel := flags.String("channel", "", "channel to replay, if the topology holds several")
+	traceFile := flags.String("trace", "", "latency trace, .csv or .json (required)")
+	workloadFile := flags.String("workload", "", "JSON workload description (required)")
+	strategiesFile := flags.String("strategies", "", `JSON file with {"strategies": [{"name": ..., "election": "geo"|"static", "config": {...}}]}; the first is the baseline`)
+	compare := flags.String("compare", "", "strategy reported in geoOptimizations (default: the second strategy)")
+	interval := flags.Duration("interval", defaultReplayInterval, "measurement interval")
+	output := flags.String("o", "", "write the report to a file instead of stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *topologyFile == "" || *traceFile == "" || *workloadFile == "" {
+		flags.Usage()
+		return fmt.Errorf("-topology, -trace and -workload are required")
+	}
+
+	chain, _, err := loadTopologyChain(*topologyFile, *channel)
+	if err != nil {
+		return err
+	}
+	trace, err := LoadLatencyTrace(*traceFile)
+	if err != nil {
+		return err
+	}
+
+	var workload ReplayWorkload
+	if err := readJSONFile(*workloadFile, &workload); err != nil {
+		return err
+	}
+
+	strategies := defaultReplayStrategies
+	if *strategiesFile != "" {
+		var doc struct {
+			Strategies []ReplayStrategy `json:"strategies"`
+		}
+		if err := readJSONFile(*strategiesFile, &doc); err != nil {
+			return err
+		}
+		strategies = doc.Strategies
+	}
+
+	report, err := ReplayStrategies(chain, trace, workload, strategies, time.Now().Truncate(time.Second), *interval, *compare)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		return writeJSON(report)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*output, append(data, '\n'), 0644)
+}
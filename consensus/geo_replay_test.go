@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayStrategyConfigLeavesBaseUntouched(t *testing.T) {
+	base := newTestChain(t)
+	base.config.TopologyLabels = []TopologyLabel{{Name: "zone", Affinity: 1}}
+
+	trace, err := newLatencyTrace(time.Time{}, []LatencySample{{From: 1, To: 2, RTT: 70 * time.Millisecond}})
+	require.NoError(t, err)
+	run := &replayRun{base: base, trace: trace, start: time.Now(), interval: time.Second}
+	run.replay(ReplayStrategy{
+		Name:   "racks",
+		Config: json.RawMessage(`{"topology_labels":[{"name":"rack","affinity":2}]}`),
+	})
+	require.Equal(t, []TopologyLabel{{Name: "zone", Affinity: 1}}, base.config.TopologyLabels)
+
+	planning := base.clone()
+	planning.config.TopologyLabels[0].Name = "rack"
+	require.Equal(t, "zone", base.config.TopologyLabels[0].Name)
+}
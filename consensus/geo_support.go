@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	cb "github.com/hyperledger/fabric/protos/common"
+	raftprotos "github.com/hyperledger/fabric/protos/orderer/etcdraft"
+)
+
+// geoSupport wraps the ConsenterSupport of a channel so that the geo layer
+// sees every block the etcdraft chain writes
+type geoSupport struct {
+	consensus.ConsenterSupport
+	chain *GeoEtcdRaft
+}
+
+// WrapSupport returns the support the base etcdraft chain is to be built
+// with
+func (g *GeoEtcdRaft) WrapSupport(support consensus.ConsenterSupport) consensus.ConsenterSupport {
+	return &geoSupport{ConsenterSupport: support, chain: g}
+}
+
+// WriteBlock writes a block and records it with the geo layer
+func (s *geoSupport) WriteBlock(block *cb.Block, encodedMetadataValue []byte) {
+	s.ConsenterSupport.WriteBlock(block, encodedMetadataValue)
+	s.chain.blockWritten(block, encodedMetadataValue)
+}
+
+// WriteConfigBlock writes a config block and records it with the geo layer
+func (s *geoSupport) WriteConfigBlock(block *cb.Block, encodedMetadataValue []byte) {
+	s.ConsenterSupport.WriteConfigBlock(block, encodedMetadataValue)
+	s.chain.blockWritten(block, encodedMetadataValue)
+}
+
+// blockWritten records a block the chain wrote. etcdraft stores the raft
+// index the block was committed at in the block's consenter metadata.
+func (g *GeoEtcdRaft) blockWritten(block *cb.Block, encodedMetadataValue []byte) {
+	g.ObserveBlock(len(block.GetData().GetData()), proto.Size(block))
+
+	metadata := &raftprotos.BlockMetadata{}
+	if err := proto.Unmarshal(encodedMetadataValue, metadata); err != nil {
+		logger.Warningf("Block %d on channel %s has undecodable raft metadata: %v",
+			block.GetHeader().GetNumber(), g.channelID, err)
+		return
+	}
+
+	g.TraceCommit(metadata.RaftIndex)
+	g.recordCommittedHeight(metadata.RaftIndex, block.GetHeader().GetNumber()+1)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Topology export formats accepted by /topology?format=
+const (
+	TopologyFormatJSON    = "json"
+	TopologyFormatGeoJSON = "geojson"
+	TopologyFormatDOT     = "dot"
+)
+
+// Node roles reported in topology exports
+const (
+	NodeRoleLeader       = "leader"
+	NodeRoleRegionLeader = "region-leader"
+	NodeRoleFollower     = "follower"
+)
+
+// topologyNode is a point-in-time copy of a node for export
+type topologyNode struct {
+	NodeID   uint64
+	Location GeoLocation
+	Role     string
+	IsLeader bool
+	Blocked  bool
+	Draining bool
+}
+
+// topologyEdge is the measured latency between two nodes in both
+// directions over the latency window
+type topologyEdge struct {
+	From    uint64
+	To      uint64
+	Latency LatencyPercentiles
+}
+
+// topologySnapshot is a consistent copy of a chain's nodes and measured
+// links
+type topologySnapshot struct {
+	Channel string
+	Nodes   []topologyNode
+	Edges   []topologyEdge
+}
+
+// exportTopology copies the chain's nodes and the links with latency
+// samples, sorted by node ID
+func (g *GeoEtcdRaft) exportTopology(channel string) topologySnapshot {
+	g.mu.RLock()
+	snapshot := topologySnapshot{Channel: channel}
+	for _, node := range g.nodes {
+		role := NodeRoleFollower
+		if node.IsLeader {
+			role = NodeRoleLeader
+		} else if g.regionLeaders[node.Location.Region] == node.NodeID {
+			role = NodeRoleRegionLeader
+		}
+		snapshot.Nodes = append(snapshot.Nodes, topologyNode{
+			NodeID:   node.NodeID,
+			Location: node.Location,
+			Role:     role,
+			IsLeader: node.IsLeader,
+			Blocked:  node.LeadershipBlocked,
+			Draining: node.Draining,
+		})
+	}
+	g.mu.RUnlock()
+
+	sort.Slice(snapshot.Nodes, func(i, j int) bool {
+		return snapshot.Nodes[i].NodeID < snapshot.Nodes[j].NodeID
+	})
+
+	// Links are undirected in the export, so both directions are merged
+	histograms := g.latencies.nodePairHistograms(g.now())
+	for i, from := range snapshot.Nodes {
+		for _, to := range snapshot.Nodes[i+1:] {
+			merged := NewLatencyHistogram()
+			if h := histograms[nodePairKey(from.NodeID, to.NodeID)]; h != nil {
+				merged.Merge(h)
+			}
+			if h := histograms[nodePairKey(to.NodeID, from.NodeID)]; h != nil {
+				merged.Merge(h)
+			}
+			if merged.Count() == 0 {
+				continue
+			}
+			snapshot.Edges = append(snapshot.Edges, topologyEdge{
+				From:    from.NodeID,
+				To:      to.NodeID,
+				Latency: merged.Percentiles(),
+			})
+		}
+	}
+
+	return snapshot
+}
+
+// GeoJSON types, see RFC 7946
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoJSONPosition returns a location as a GeoJSON [longitude, latitude]
+// position
+func geoJSONPosition(location GeoLocation) []float64 {
+	return []float64{location.Longitude, location.Latitude}
+}
+
+// geoJSONLink returns the geometry of a link between two locations. A link
+// whose shorter way round crosses the antimeridian is cut there into a
+// MultiLineString, as RFC 7946 section 3.1.9 requires, so that maps do not
+// draw it across the whole world.
+func geoJSONLink(from, to GeoLocation) geoJSONGeometry {
+	start, end := geoJSONPosition(from), geoJSONPosition(to)
+	delta := end[0] - start[0]
+	if math.Abs(delta) <= 180 {
+		return geoJSONGeometry{
+			Type:        "LineString",
+			Coordinates: [][]float64{start, end},
+		}
+	}
+
+	// Unwrap the end longitude so the link runs continuously through the
+	// antimeridian, east across +180° or west across -180°
+	meridian, unwrapped := 180.0, end[0]+360
+	if delta > 0 {
+		meridian, unwrapped = -180.0, end[0]-360
+	}
+	fraction := (meridian - start[0]) / (unwrapped - start[0])
+	latitude := start[1] + fraction*(end[1]-start[1])
+
+	return geoJSONGeometry{
+		Type: "MultiLineString",
+		Coordinates: [][][]float64{
+			{start, {meridian, latitude}},
+			{{-meridian, latitude}, end},
+		},
+	}
+}
+
+// durationMillis converts a duration to fractional milliseconds
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// topologyGeoJSON builds a FeatureCollection with a Point per node and a
+// LineString, or MultiLineString across the antimeridian, per measured link
+func topologyGeoJSON(snapshots []topologySnapshot) geoJSONFeatureCollection {
+	collection := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+
+	for _, snapshot := range snapshots {
+		locations := make(map[uint64]GeoLocation, len(snapshot.Nodes))
+
+		for _, node := range snapshot.Nodes {
+			locations[node.NodeID] = node.Location
+			properties := map[string]interface{}{
+				"kind":               "node",
+				"channel":            snapshot.Channel,
+				"node_id":            node.NodeID,
+				"role":               node.Role,
+				"is_leader":          node.IsLeader,
+				"leadership_blocked": node.Blocked,
+				"draining":           node.Draining,
+				"region":             node.Location.Region,
+				"zone":               node.Location.Zone,
+				"datacenter":         node.Location.DataCenter,
+			}
+			if len(node.Location.Labels) > 0 {
+				properties["labels"] = node.Location.Labels
+			}
+			collection.Features = append(collection.Features, geoJSONFeature{
+				Type: "Feature",
+				ID:   fmt.Sprintf("%s/node/%d", snapshot.Channel, node.NodeID),
+				Geometry: geoJSONGeometry{
+					Type:        "Point",
+					Coordinates: geoJSONPosition(node.Location),
+				},
+				Properties: properties,
+			})
+		}
+
+		for _, edge := range snapshot.Edges {
+			from, to := locations[edge.From], locations[edge.To]
+			collection.Features = append(collection.Features, geoJSONFeature{
+				Type:     "Feature",
+				ID:       fmt.Sprintf("%s/link/%d-%d", snapshot.Channel, edge.From, edge.To),
+				Geometry: geoJSONLink(from, to),
+				Properties: map[string]interface{}{
+					"kind":         "link",
+					"channel":      snapshot.Channel,
+					"from":         edge.From,
+					"to":           edge.To,
+					"region_pair":  regionPairKey(from.Region, to.Region),
+					"cross_region": from.Region != to.Region,
+					"weight":       durationMillis(edge.Latency.P50),
+					"latency_ms": map[string]float64{
+						"p50":  durationMillis(edge.Latency.P50),
+						"p90":  durationMillis(edge.Latency.P90),
+						"p99":  durationMillis(edge.Latency.P99),
+						"mean": durationMillis(edge.Latency.Mean),
+					},
+					"samples": edge.Latency.Count,
+				},
+			})
+		}
+	}
+
+	return collection
+}
+
+// dotQuote quotes a string as a Graphviz ID. Newlines become centered
+// line breaks.
+func dotQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+// writeTopologyDOT writes an undirected Graphviz graph with a cluster per
+// channel and region. Links are labelled with their median latency.
+func writeTopologyDOT(w io.Writer, snapshots []topologySnapshot) {
+	fmt.Fprintln(w, "graph geo_topology {")
+	fmt.Fprintln(w, "  graph [fontname=\"Helvetica\"];")
+	fmt.Fprintln(w, "  node [fontname=\"Helvetica\", shape=ellipse];")
+	fmt.Fprintln(w, "  edge [fontname=\"Helvetica\"];")
+
+	for i, snapshot := range snapshots {
+		nodeName := func(nodeID uint64) string {
+			return dotQuote(fmt.Sprintf("%s/%d", snapshot.Channel, nodeID))
+		}
+
+		fmt.Fprintf(w, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "    label=%s;\n", dotQuote("channel "+snapshot.Channel))
+
+		regions := make(map[string][]topologyNode)
+		var regionNames []string
+		for _, node := range snapshot.Nodes {
+			if _, exists := regions[node.Location.Region]; !exists {
+				regionNames = append(regionNames, node.Location.Region)
+			}
+			regions[node.Location.Region] = append(regions[node.Location.Region], node)
+		}
+		sort.Strings(regionNames)
+
+		for j, region := range regionNames {
+			fmt.Fprintf(w, "    subgraph cluster_%d_%d {\n", i, j)
+			fmt.Fprintf(w, "      label=%s;\n", dotQuote(region))
+			for _, node := range regions[region] {
+				attrs := []string{
+					"label=" + dotQuote(fmt.Sprintf("node %d\n%s\n%s", node.NodeID, node.Location.Zone, node.Role)),
+				}
+				// Graphviz keeps only the last style attribute, so
+				// styles are combined into one
+				var styles []string
+				switch node.Role {
+				case NodeRoleLeader:
+					attrs = append(attrs, "shape=doublecircle")
+					styles = append(styles, "bold")
+				case NodeRoleRegionLeader:
+					styles = append(styles, "bold")
+				}
+				if node.Blocked {
+					attrs = append(attrs, "color=gray", "fontcolor=gray")
+				}
+				if node.Draining {
+					styles = append(styles, "dashed")
+				}
+				if len(styles) > 0 {
+					attrs = append(attrs, "style="+dotQuote(strings.Join(styles, ",")))
+				}
+				fmt.Fprintf(w, "      %s [%s];\n", nodeName(node.NodeID), strings.Join(attrs, ", "))
+			}
+			fmt.Fprintln(w, "    }")
+		}
+
+		for _, edge := range snapshot.Edges {
+			p50 := durationMillis(edge.Latency.P50)
+			fmt.Fprintf(w, "    %s -- %s [label=%s, weight=%d];\n",
+				nodeName(edge.From), nodeName(edge.To),
+				dotQuote(fmt.Sprintf("%.1f ms", p50)),
+				dotEdgeWeight(p50))
+		}
+
+		fmt.Fprintln(w, "  }")
+	}
+
+	fmt.Fprintln(w, "}")
+}
+
+// dotEdgeWeight maps a latency to a Graphviz weight so that low-latency
+// links are drawn shorter. Graphviz requires positive integer weights.
+func dotEdgeWeight(millis float64) int {
+	weight := int(1000 / (millis + 1))
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
+
+// writeTopologyExport serves the topology of the given chains in an export
+// format
+func (gc *GeoConsenter) writeTopologyExport(w http.ResponseWriter, format string, channel string) {
+	gc.mu.RLock()
+	var channels []string
+	for chainID := range gc.chains {
+		if channel == "" || chainID == channel {
+			channels = append(channels, chainID)
+		}
+	}
+	sort.Strings(channels)
+	chains := make([]*GeoEtcdRaft, len(channels))
+	for i, chainID := range channels {
+		chains[i] = gc.chains[chainID]
+	}
+	gc.mu.RUnlock()
+
+	if channel != "" && len(chains) == 0 {
+		http.Error(w, fmt.Sprintf("Chain %s not found", channel), http.StatusNotFound)
+		return
+	}
+
+	snapshots := make([]topologySnapshot, len(chains))
+	for i, chain := range chains {
+		snapshots[i] = chain.exportTopology(channels[i])
+	}
+
+	switch format {
+	case TopologyFormatGeoJSON:
+		w.Header().Set("Content-Type", "application/geo+json")
+		json.NewEncoder(w).Encode(topologyGeoJSON(snapshots))
+	case TopologyFormatDOT:
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		writeTopologyDOT(w, snapshots)
+	}
+}
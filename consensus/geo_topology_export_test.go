@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoJSONLinkCutsAtAntimeridian(t *testing.T) {
+	tokyo := GeoLocation{Latitude: 35.6762, Longitude: 139.6503}
+	sanFrancisco := GeoLocation{Latitude: 37.7749, Longitude: -122.4194}
+	london := GeoLocation{Latitude: 51.5074, Longitude: -0.1278}
+
+	link := geoJSONLink(london, tokyo)
+	require.Equal(t, "LineString", link.Type)
+
+	for _, pair := range [][2]GeoLocation{{tokyo, sanFrancisco}, {sanFrancisco, tokyo}} {
+		link = geoJSONLink(pair[0], pair[1])
+		require.Equal(t, "MultiLineString", link.Type)
+		lines := link.Coordinates.([][][]float64)
+		require.Len(t, lines, 2)
+		require.Equal(t, geoJSONPosition(pair[0]), lines[0][0])
+		require.Equal(t, geoJSONPosition(pair[1]), lines[1][1])
+
+		// Both halves meet at the same latitude on opposite sides
+		cut, resume := lines[0][1], lines[1][0]
+		require.Equal(t, 180.0, math.Abs(cut[0]))
+		require.Equal(t, -cut[0], resume[0])
+		require.Equal(t, cut[1], resume[1])
+		require.True(t, cut[1] > tokyo.Latitude && cut[1] < sanFrancisco.Latitude)
+	}
+	require.Equal(t, 180.0, geoJSONLink(tokyo, sanFrancisco).Coordinates.([][][]float64)[0][1][0])
+}
+
+func TestTopologyDOTCombinesStyles(t *testing.T) {
+	var out bytes.Buffer
+	writeTopologyDOT(&out, []topologySnapshot{{
+		Channel: "ch1",
+		Nodes: []topologyNode{
+			{NodeID: 1, Location: GeoLocation{Region: "us-east"}, Role: NodeRoleLeader, IsLeader: true, Draining: true},
+			{NodeID: 2, Location: GeoLocation{Region: "eu-west"}, Role: NodeRoleRegionLeader},
+			{NodeID: 3, Location: GeoLocation{Region: "eu-west"}, Role: NodeRoleFollower, Draining: true},
+		},
+	}})
+
+	for _, line := range strings.Split(out.String(), "\n") {
+		require.LessOrEqual(t, strings.Count(line, "style="), 1, line)
+	}
+	require.Contains(t, out.String(), `"ch1/1" [label="node 1\n\nleader", shape=doublecircle, style="bold,dashed"]`)
+	require.Contains(t, out.String(), `style="bold"]`)
+	require.Contains(t, out.String(), `"ch1/3" [label="node 3\n\nfollower", style="dashed"]`)
+}
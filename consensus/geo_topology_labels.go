@@ -0,0 +1,135 @@
+package main
+
+import "sort"
+
+// Built-in topology labels, backed by the dedicated GeoLocation fields
+const (
+	LabelRegion     = "region"
+	LabelZone       = "zone"
+	LabelDataCenter = "datacenter"
+)
+
+// defaultZoneAffinity is the proximity bonus for nodes sharing a zone when
+// no topology labels are configured
+const defaultZoneAffinity = 1.5
+
+// TopologyLabel is one level of the topology hierarchy. Nodes that share the
+// label's value, and the values of every broader label, have their
+// proximity multiplied by Affinity. An affinity of 0 groups nodes without
+// changing their proximity.
+type TopologyLabel struct {
+	Name     string  `json:"name"`
+	Affinity float64 `json:"affinity"`
+}
+
+// DomainTolerance is how many whole fault domains of one label the chain
+// can lose while keeping a quorum, and which domains are a single point of
+// failure
+type DomainTolerance struct {
+	Failures int      `json:"failures"`
+	Critical []string `json:"critical,omitempty"`
+}
+
+// Label returns the location's value for a topology label. region, zone
+// and datacenter read the dedicated fields unless Labels overrides them.
+func (l GeoLocation) Label(name string) string {
+	if value, ok := l.Labels[name]; ok {
+		return value
+	}
+	switch name {
+	case LabelRegion:
+		return l.Region
+	case LabelZone:
+		return l.Zone
+	case LabelDataCenter:
+		return l.DataCenter
+	}
+	return ""
+}
+
+// topologyLabels returns the configured labels, broadest first. Without
+// configuration the hierarchy is region, weighted by RegionWeight, then
+// zone.
+func (c *GeoConfig) topologyLabels() []TopologyLabel {
+	if len(c.TopologyLabels) > 0 {
+		return c.TopologyLabels
+	}
+	return []TopologyLabel{
+		{Name: LabelRegion, Affinity: c.RegionWeight},
+		{Name: LabelZone, Affinity: defaultZoneAffinity},
+	}
+}
+
+// labelAffinity multiplies the affinities of the labels two locations share,
+// walking from the broadest label down and stopping at the first one on
+// which they differ. Labels neither location sets are skipped.
+func labelAffinity(labels []TopologyLabel, a, b GeoLocation) float64 {
+	affinity := 1.0
+	for _, label := range labels {
+		valueA, valueB := a.Label(label.Name), b.Label(label.Name)
+		if valueA == "" && valueB == "" {
+			continue
+		}
+		if valueA != valueB {
+			break
+		}
+		if label.Affinity > 0 {
+			affinity *= label.Affinity
+		}
+	}
+	return affinity
+}
+
+// domainSizes counts the locations in each fault domain of a label.
+// Locations without the label are not in any domain.
+func domainSizes(locations []GeoLocation, label string) map[string]int {
+	sizes := make(map[string]int)
+	for _, location := range locations {
+		if value := location.Label(label); value != "" {
+			sizes[value]++
+		}
+	}
+	return sizes
+}
+
+// domainTolerance computes how many domains of a label can fail, largest
+// first, before the locations lose their quorum
+func domainTolerance(locations []GeoLocation, label string, quorum int) DomainTolerance {
+	var tolerance DomainTolerance
+	total := len(locations)
+	if total == 0 {
+		return tolerance
+	}
+
+	var sizes []int
+	for domain, size := range domainSizes(locations, label) {
+		sizes = append(sizes, size)
+		if total-size < quorum {
+			tolerance.Critical = append(tolerance.Critical, domain)
+		}
+	}
+	sort.Strings(tolerance.Critical)
+
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	remaining := total
+	for _, size := range sizes {
+		if remaining-size < quorum {
+			break
+		}
+		remaining -= size
+		tolerance.Failures++
+	}
+	return tolerance
+}
+
+// domainDeficit is how many nodes short of a quorum the locations are after
+// losing their largest domain of a label
+func domainDeficit(locations []GeoLocation, label string, quorum int) int {
+	deficit := 0
+	for _, size := range domainSizes(locations, label) {
+		if missing := quorum - (len(locations) - size); missing > deficit {
+			deficit = missing
+		}
+	}
+	return deficit
+}
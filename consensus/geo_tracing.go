@@ -0,0 +1,435 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	cb "github.com/hyperledger/fabric/protos/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported trace exporters
+const (
+	TraceExporterNone   = ""
+	TraceExporterOTLP   = "otlp"
+	TraceExporterFile   = "file"
+	TraceExporterStdout = "stdout"
+)
+
+const tracerName = "fabric-geo-consensus"
+
+// pendingTraceTTL bounds how long an ordered envelope may wait to be cut
+// into a raft entry, and the entry to be committed, before its trace is
+// abandoned
+const pendingTraceTTL = time.Minute
+
+// traceExpiryInterval is how often abandoned traces are looked for
+const traceExpiryInterval = pendingTraceTTL / 4
+
+// TracingConfig controls OpenTelemetry tracing of the ordering path
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Endpoint    string  `json:"endpoint"`
+	Insecure    bool    `json:"insecure"`
+	FilePath    string  `json:"file_path"`
+	SampleRatio float64 `json:"sample_ratio"`
+}
+
+// newTracerProvider builds a tracer provider for the configured exporter.
+// It returns a nil provider when tracing is disabled.
+func newTracerProvider(cfg TracingConfig) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Exporter {
+	case TraceExporterNone:
+		return nil, nil
+	case TraceExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		otlpExporter, err := otlptracegrpc.New(context.Background(), opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+		}
+		exporter = otlpExporter
+	case TraceExporterFile, TraceExporterStdout:
+		var writer io.Writer = os.Stdout
+		var file *os.File
+		if cfg.Exporter == TraceExporterFile {
+			if cfg.FilePath == "" {
+				return nil, fmt.Errorf("trace exporter %q requires a file path", cfg.Exporter)
+			}
+			var err error
+			file, err = os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %v", err)
+			}
+			writer = file
+		}
+		stdoutExporter, err := stdouttrace.New(stdouttrace.WithWriter(writer))
+		if err != nil {
+			if file != nil {
+				file.Close()
+			}
+			return nil, fmt.Errorf("failed to create %s trace exporter: %v", cfg.Exporter, err)
+		}
+		exporter = stdoutExporter
+		if file != nil {
+			exporter = fileSpanExporter{SpanExporter: stdoutExporter, file: file}
+		}
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if cfg.SampleRatio > 0 && cfg.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName("geo-consenter"),
+		)),
+	), nil
+}
+
+// fileSpanExporter closes the trace file once the exporter has shut down,
+// which the tracer provider does when the consenter halts
+type fileSpanExporter struct {
+	sdktrace.SpanExporter
+	file *os.File
+}
+
+// Shutdown flushes the exporter and closes its file
+func (e fileSpanExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// envelopeTrace holds the open spans of a single ordered envelope
+type envelopeTrace struct {
+	ctx       context.Context
+	root      trace.Span
+	received  time.Time
+	proposed  time.Time
+	replicate trace.Span
+	acked     map[uint64]bool
+}
+
+// orderTracer follows envelopes from Order through replication to commit.
+// Envelopes are tracked by digest until they are cut into a raft entry and
+// by raft index afterwards, since followers acknowledge entries, not
+// envelopes.
+type orderTracer struct {
+	tracer   trace.Tracer
+	channel  string
+	mu       sync.Mutex
+	pending  map[string]*envelopeTrace
+	inflight map[uint64][]*envelopeTrace
+}
+
+// newOrderTracer creates an order tracer for a channel
+func newOrderTracer(provider trace.TracerProvider, channel string) *orderTracer {
+	return &orderTracer{
+		tracer:   provider.Tracer(tracerName),
+		channel:  channel,
+		pending:  make(map[string]*envelopeTrace),
+		inflight: make(map[uint64][]*envelopeTrace),
+	}
+}
+
+// envelopeDigest identifies an envelope across the ordering path
+func envelopeDigest(env *cb.Envelope) string {
+	hash := sha256.Sum256(env.Payload)
+	return hex.EncodeToString(hash[:])
+}
+
+// nodeAttributes returns the span attributes describing a node
+func nodeAttributes(prefix string, node *GeoNode) []attribute.KeyValue {
+	if node == nil {
+		return nil
+	}
+	return []attribute.KeyValue{
+		attribute.Int64(prefix+".id", int64(node.NodeID)),
+		attribute.String(prefix+".region", node.Location.Region),
+		attribute.String(prefix+".zone", node.Location.Zone),
+	}
+}
+
+// EnableTracing turns on tracing of the ordering path for this chain
+func (g *GeoEtcdRaft) EnableTracing(provider trace.TracerProvider, channel string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.tracer = newOrderTracer(provider, channel)
+}
+
+// currentTracer returns the chain's order tracer, or nil when tracing is off
+func (g *GeoEtcdRaft) currentTracer() *orderTracer {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.tracer
+}
+
+// Order traces an envelope submitted to the chain and hands it to the
+// underlying etcdraft chain for proposal
+func (g *GeoEtcdRaft) Order(env *cb.Envelope, configSeq uint64) error {
+	tracer := g.currentTracer()
+	if tracer == nil {
+		return g.Chain.Order(env, configSeq)
+	}
+	return tracer.order(g, env, configSeq)
+}
+
+// order records the receive and forward or propose spans for an envelope
+func (t *orderTracer) order(g *GeoEtcdRaft, env *cb.Envelope, configSeq uint64) error {
+	digest := envelopeDigest(env)
+
+	ctx, root := t.tracer.Start(context.Background(), "geo.order",
+		trace.WithAttributes(
+			attribute.String("channel", t.channel),
+			attribute.String("envelope.digest", digest),
+			attribute.Int64("config.seq", int64(configSeq)),
+		))
+
+	g.mu.RLock()
+	local := g.nodes[g.localNodeID]
+	var leader *GeoNode
+	for _, node := range g.nodes {
+		if node.IsLeader {
+			leader = node
+			break
+		}
+	}
+	g.mu.RUnlock()
+
+	_, receive := t.tracer.Start(ctx, "geo.order.receive",
+		trace.WithAttributes(nodeAttributes("node", local)...))
+	receive.SetAttributes(attribute.Int("envelope.size", len(env.Payload)))
+	receive.End()
+
+	// Followers forward envelopes to the leader, which proposes them
+	spanName := "geo.order.propose"
+	attrs := nodeAttributes("leader", leader)
+	if leader != nil && local != nil && leader.NodeID != local.NodeID {
+		spanName = "geo.order.forward"
+		attrs = append(attrs, attribute.String("region_pair",
+			regionPairKey(local.Location.Region, leader.Location.Region)))
+	}
+
+	_, submit := t.tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+	err := g.Chain.Order(env, configSeq)
+	if err != nil {
+		submit.RecordError(err)
+		submit.SetStatus(codes.Error, err.Error())
+		submit.End()
+		root.RecordError(err)
+		root.SetStatus(codes.Error, err.Error())
+		root.End()
+		return err
+	}
+	submit.End()
+
+	t.mu.Lock()
+	t.pending[digest] = &envelopeTrace{ctx: ctx, root: root, received: time.Now()}
+	t.mu.Unlock()
+
+	return nil
+}
+
+// TraceEntryProposed associates ordered envelopes with the raft entry they
+// were cut into. The transport calls it for the entries of every append
+// message it carries, so both the leader and the follower that received an
+// envelope see its entry.
+func (g *GeoEtcdRaft) TraceEntryProposed(index uint64, envs []*cb.Envelope) {
+	t := g.currentTracer()
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for _, env := range envs {
+		digest := envelopeDigest(env)
+		et := t.pending[digest]
+		if et == nil {
+			continue
+		}
+		delete(t.pending, digest)
+
+		et.proposed = now
+		et.acked = make(map[uint64]bool)
+		_, et.replicate = t.tracer.Start(et.ctx, "geo.order.replicate",
+			trace.WithAttributes(attribute.Int64("raft.index", int64(index))))
+		t.inflight[index] = append(t.inflight[index], et)
+	}
+}
+
+// hasPending reports whether any ordered envelope awaits its raft entry
+func (t *orderTracer) hasPending() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.pending) > 0
+}
+
+// TraceAppendAck records a follower acknowledging the raft entries up to
+// index. Each follower is recorded once per entry.
+func (g *GeoEtcdRaft) TraceAppendAck(index uint64, followerID uint64) {
+	t := g.currentTracer()
+	if t == nil {
+		return
+	}
+
+	g.mu.RLock()
+	follower := g.nodes[followerID]
+	var leader *GeoNode
+	for _, node := range g.nodes {
+		if node.IsLeader {
+			leader = node
+			break
+		}
+	}
+	g.mu.RUnlock()
+
+	attrs := append(nodeAttributes("follower", follower),
+		attribute.Int64("raft.index", int64(index)))
+	if follower != nil && leader != nil {
+		attrs = append(attrs, attribute.String("region_pair",
+			regionPairKey(leader.Location.Region, follower.Location.Region)))
+	}
+	if follower == nil {
+		attrs = append(attrs, attribute.String("follower.id", strconv.FormatUint(followerID, 10)))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for entryIndex, traces := range t.inflight {
+		if entryIndex > index {
+			continue
+		}
+		for _, et := range traces {
+			if et.acked[followerID] {
+				continue
+			}
+			et.acked[followerID] = true
+			_, ack := t.tracer.Start(et.ctx, "geo.order.append_ack",
+				trace.WithTimestamp(et.proposed),
+				trace.WithAttributes(attrs...))
+			ack.End()
+		}
+	}
+}
+
+// TraceCommit records the raft entry at index as committed and ends the
+// traces of all envelopes it contains. It is called once the block cut into
+// the entry has been written.
+func (g *GeoEtcdRaft) TraceCommit(index uint64) {
+	t := g.currentTracer()
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	traces := t.inflight[index]
+	delete(t.inflight, index)
+	t.mu.Unlock()
+
+	for _, et := range traces {
+		_, commit := t.tracer.Start(et.ctx, "geo.order.commit",
+			trace.WithAttributes(attribute.Int64("raft.index", int64(index))))
+		commit.End()
+		et.replicate.End()
+		et.root.End()
+	}
+}
+
+// expire abandons the traces of envelopes that were not proposed, or whose
+// entry was not committed, within pendingTraceTTL, e.g. because they were
+// dropped after a leader change
+func (t *orderTracer) expire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for digest, et := range t.pending {
+		if now.Sub(et.received) > pendingTraceTTL {
+			et.root.SetStatus(codes.Error, "envelope was not proposed")
+			et.root.End()
+			delete(t.pending, digest)
+		}
+	}
+	for index, traces := range t.inflight {
+		if len(traces) > 0 && now.Sub(traces[0].proposed) > pendingTraceTTL {
+			for _, et := range traces {
+				et.replicate.End()
+				et.root.SetStatus(codes.Error, "entry was not committed")
+				et.root.End()
+			}
+			delete(t.inflight, index)
+		}
+	}
+}
+
+// abandon ends every open trace, which the chain does when it halts
+func (t *orderTracer) abandon(reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for digest, et := range t.pending {
+		et.root.SetStatus(codes.Error, reason)
+		et.root.End()
+		delete(t.pending, digest)
+	}
+	for index, traces := range t.inflight {
+		for _, et := range traces {
+			et.replicate.End()
+			et.root.SetStatus(codes.Error, reason)
+			et.root.End()
+		}
+		delete(t.inflight, index)
+	}
+}
+
+// expireTraces abandons stale traces until ctx is done
+func (g *GeoEtcdRaft) expireTraces(ctx context.Context, t *orderTracer) {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(traceExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			t.expire(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
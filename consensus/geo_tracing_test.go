@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/orderer/consensus"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/orderer"
+	raftprotos "github.com/hyperledger/fabric/protos/orderer/etcdraft"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testSupport records the blocks a chain writes
+type testSupport struct {
+	consensus.ConsenterSupport
+	channelID string
+	written   []*cb.Block
+}
+
+func (s *testSupport) ChannelID() string { return s.channelID }
+
+func (s *testSupport) WriteBlock(block *cb.Block, encodedMetadataValue []byte) {
+	s.written = append(s.written, block)
+}
+
+func (s *testSupport) WriteConfigBlock(block *cb.Block, encodedMetadataValue []byte) {
+	s.written = append(s.written, block)
+}
+
+// testRPC records the consensus messages a chain sends
+type testRPC struct {
+	sent []*orderer.ConsensusRequest
+}
+
+func (r *testRPC) SendConsensus(dest uint64, msg *orderer.ConsensusRequest) error {
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func (r *testRPC) SendSubmit(dest uint64, request *orderer.SubmitRequest, report func(err error)) error {
+	return nil
+}
+
+// newTestChain returns an unstarted chain of nodes in three regions
+func newTestChain(t *testing.T) *GeoEtcdRaft {
+	chain := NewGeoEtcdRaft(nil, NewGeoConfig())
+	chain.channelID = "testchannel"
+	locations := []GeoLocation{
+		{Latitude: 37.7749, Longitude: -122.4194, Region: "us-west"},
+		{Latitude: 40.7128, Longitude: -74.0060, Region: "us-east"},
+		{Latitude: 51.5074, Longitude: -0.1278, Region: "eu-west"},
+	}
+	for i, location := range locations {
+		require.NoError(t, chain.RegisterNode(uint64(i+1), location))
+	}
+	return chain
+}
+
+// testBlock returns a block of envelopes and its marshaled form
+func testBlock(t *testing.T, number uint64, envs ...*cb.Envelope) (*cb.Block, []byte) {
+	block := &cb.Block{
+		Header: &cb.BlockHeader{Number: number},
+		Data:   &cb.BlockData{},
+	}
+	for _, env := range envs {
+		envBytes, err := proto.Marshal(env)
+		require.NoError(t, err)
+		block.Data.Data = append(block.Data.Data, envBytes)
+	}
+	blockBytes, err := proto.Marshal(block)
+	require.NoError(t, err)
+	return block, blockBytes
+}
+
+// raftMetadata returns the consenter metadata etcdraft writes with a block
+func raftMetadata(t *testing.T, index uint64) []byte {
+	metadata, err := proto.Marshal(&raftprotos.BlockMetadata{RaftIndex: index})
+	require.NoError(t, err)
+	return metadata
+}
+
+// raftRequest wraps a raft message in a consensus request
+func raftRequest(t *testing.T, msg raftpb.Message) *orderer.ConsensusRequest {
+	payload, err := msg.Marshal()
+	require.NoError(t, err)
+	return &orderer.ConsensusRequest{Channel: "testchannel", Payload: payload}
+}
+
+// traceEnvelope starts the trace of an envelope as Order does
+func traceEnvelope(chain *GeoEtcdRaft, env *cb.Envelope, received time.Time) {
+	t := chain.tracer
+	ctx, root := t.tracer.Start(context.Background(), "geo.order")
+	t.pending[envelopeDigest(env)] = &envelopeTrace{ctx: ctx, root: root, received: received}
+}
+
+// spanNames returns the names of the ended spans
+func spanNames(recorder *tracetest.SpanRecorder) map[string]int {
+	names := make(map[string]int)
+	for _, span := range recorder.Ended() {
+		names[span.Name()]++
+	}
+	return names
+}
+
+func TestTracingFollowsEntryThroughTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	chain := newTestChain(t)
+	chain.EnableTracing(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), "testchannel")
+
+	env := &cb.Envelope{Payload: []byte("transaction")}
+	traceEnvelope(chain, env, time.Now())
+	block, blockBytes := testBlock(t, 5, env)
+
+	rpc := &testRPC{}
+	transport := chain.WrapRPC(rpc)
+	require.NoError(t, transport.SendConsensus(2, raftRequest(t, raftpb.Message{
+		Type:    raftpb.MsgApp,
+		From:    1,
+		To:      2,
+		Entries: []raftpb.Entry{{Type: raftpb.EntryNormal, Index: 7, Data: blockBytes}},
+	})))
+	require.Len(t, rpc.sent, 1)
+	require.Empty(t, chain.tracer.pending)
+	require.Len(t, chain.tracer.inflight[7], 1)
+
+	// Acknowledgements cover every entry up to their index, once per follower
+	for _, from := range []uint64{2, 2, 3} {
+		require.NoError(t, transport.SendConsensus(1, raftRequest(t, raftpb.Message{
+			Type:  raftpb.MsgAppResp,
+			From:  from,
+			To:    1,
+			Index: 8,
+		})))
+	}
+	require.Equal(t, 2, spanNames(recorder)["geo.order.append_ack"])
+
+	support := &testSupport{}
+	chain.WrapSupport(support).WriteBlock(block, raftMetadata(t, 7))
+	require.Len(t, support.written, 1)
+	require.Empty(t, chain.tracer.inflight)
+
+	names := spanNames(recorder)
+	require.Equal(t, 1, names["geo.order.replicate"])
+	require.Equal(t, 1, names["geo.order.commit"])
+	require.Equal(t, 1, names["geo.order"])
+}
+
+func TestTracingExpiresAbandonedTraces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	chain := newTestChain(t)
+	chain.EnableTracing(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), "testchannel")
+
+	now := time.Now()
+	proposed := &cb.Envelope{Payload: []byte("proposed")}
+	traceEnvelope(chain, proposed, now)
+	traceEnvelope(chain, &cb.Envelope{Payload: []byte("dropped")}, now)
+	chain.TraceEntryProposed(3, []*cb.Envelope{proposed})
+
+	chain.tracer.expire(now.Add(pendingTraceTTL / 2))
+	require.Empty(t, recorder.Ended())
+
+	chain.tracer.expire(now.Add(2 * pendingTraceTTL))
+	require.Empty(t, chain.tracer.pending)
+	require.Empty(t, chain.tracer.inflight)
+	require.Equal(t, 2, spanNames(recorder)["geo.order"])
+
+	// Halting ends whatever is still open
+	traceEnvelope(chain, &cb.Envelope{Payload: []byte("open")}, now)
+	chain.Halt()
+	require.Equal(t, 3, spanNames(recorder)["geo.order"])
+}
+
+func TestTracingCanBeEnabledWhileTrafficFlows(t *testing.T) {
+	chain := newTestChain(t)
+	payload := raftRequest(t, raftpb.Message{Type: raftpb.MsgAppResp, From: 2, To: 1, Index: 4}).Payload
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			chain.observeRaftMessage(payload)
+			chain.TraceCommit(uint64(i))
+		}
+	}()
+	chain.EnableTracing(sdktrace.NewTracerProvider(), "testchannel")
+	<-done
+
+	require.NotNil(t, chain.currentTracer())
+}
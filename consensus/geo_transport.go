@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/orderer/consensus/etcdraft"
+	cb "github.com/hyperledger/fabric/protos/common"
+	"github.com/hyperledger/fabric/protos/orderer"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+// geoRPC wraps the RPC the etcdraft chain sends consensus messages through,
+// so that the geo layer sees the raft messages the local node sends. Appends
+// to other regions are batched and compressed into append frames, other
+// messages flush the destination's batch and go out at once. A message that
+// is neither batched nor compressed is sent unchanged.
+type geoRPC struct {
+	etcdraft.RPC
+	chain   *GeoEtcdRaft
+	batcher *AppendBatcher
+
+	mu       sync.Mutex
+	metadata map[uint64][]byte
+}
+
+// WrapRPC returns the RPC the base etcdraft chain is to be built with.
+// Messages from other orderers reach the geo layer through Consensus. Without
+// compression and batching the raft messages are sent unchanged, so orderers
+// without the geo layer can share the channel; once either is configured
+// every orderer of the channel must run the geo layer to read the frames.
+func (g *GeoEtcdRaft) WrapRPC(rpc etcdraft.RPC) etcdraft.RPC {
+	r := &geoRPC{RPC: rpc, chain: g, metadata: make(map[uint64][]byte)}
+	r.batcher = g.NewAppendBatcher(0, r.sendFrame)
+
+	g.mu.Lock()
+	g.batcher = r.batcher
+	g.mu.Unlock()
+	return r
+}
+
+// SendConsensus observes a raft message and sends it to another orderer
+func (r *geoRPC) SendConsensus(dest uint64, req *orderer.ConsensusRequest) error {
+	msgType := r.chain.observeRaftMessage(req.Payload)
+
+	// Frames carry the latest metadata etcdraft attached for the destination
+	r.mu.Lock()
+	r.metadata[dest] = req.Metadata
+	r.mu.Unlock()
+
+	if msgType == raftpb.MsgApp {
+		return r.batcher.Submit(dest, req.Payload)
+	}
+	return r.batcher.SubmitNow(dest, req.Payload)
+}
+
+// sendFrame sends an append frame to another orderer
+func (r *geoRPC) sendFrame(dest uint64, frame []byte) error {
+	r.mu.Lock()
+	metadata := r.metadata[dest]
+	r.mu.Unlock()
+
+	return r.RPC.SendConsensus(dest, &orderer.ConsensusRequest{
+		Channel:  r.chain.channelID,
+		Payload:  frame,
+		Metadata: metadata,
+	})
+}
+
+// Consensus unpacks an append frame from another orderer, observes its raft
+// messages and hands them to the underlying etcdraft chain in order. A plain
+// raft message is observed and handed on as it is.
+func (g *GeoEtcdRaft) Consensus(req *orderer.ConsensusRequest, sender uint64) error {
+	messages, err := DecodeAppends(req.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid consensus request from node %d on channel %s: %v", sender, g.channelID, err)
+	}
+
+	for _, payload := range messages {
+		g.observeRaftMessage(payload)
+		if err := g.Chain.Consensus(&orderer.ConsensusRequest{
+			Channel:  req.Channel,
+			Payload:  payload,
+			Metadata: req.Metadata,
+		}, sender); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeRaftMessage feeds a raft message crossing the transport to the geo
+// layer: the entries of an append are proposed blocks, a successful append
+// response acknowledges the entries up to its index, and a snapshot brings
+// its receiver up to the snapshot's index. It returns the message's type,
+// or MsgHup for undecodable messages.
+func (g *GeoEtcdRaft) observeRaftMessage(payload []byte) raftpb.MessageType {
+	var msg raftpb.Message
+	if err := msg.Unmarshal(payload); err != nil {
+		logger.Debugf("Ignoring undecodable raft message on channel %s: %v", g.channelID, err)
+		return raftpb.MsgHup
+	}
+
+	switch msg.Type {
+	case raftpb.MsgApp:
+		if tracer := g.currentTracer(); tracer == nil || !tracer.hasPending() {
+			return msg.Type
+		}
+		for _, entry := range msg.Entries {
+			if entry.Type != raftpb.EntryNormal || len(entry.Data) == 0 {
+				continue
+			}
+			if envs := blockEnvelopes(entry.Data); len(envs) > 0 {
+				g.TraceEntryProposed(entry.Index, envs)
+			}
+		}
+	case raftpb.MsgAppResp:
+		if !msg.Reject {
+			g.TraceAppendAck(msg.Index, msg.From)
+			g.recordAppendProgress(msg.From, msg.Index)
+		}
+	case raftpb.MsgSnap:
+		g.recordSnapshotProgress(msg.To, msg.Snapshot.Metadata.Index)
+	}
+	return msg.Type
+}
+
+// blockEnvelopes returns the envelopes of a block carried in a raft entry
+func blockEnvelopes(data []byte) []*cb.Envelope {
+	block := &cb.Block{}
+	if err := proto.Unmarshal(data, block); err != nil {
+		return nil
+	}
+
+	var envs []*cb.Envelope
+	for _, envBytes := range block.GetData().GetData() {
+		env := &cb.Envelope{}
+		if err := proto.Unmarshal(envBytes, env); err != nil {
+			continue
+		}
+		envs = append(envs, env)
+	}
+	return envs
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+func TestTransportBatchesCrossRegionAppends(t *testing.T) {
+	chain := newTestChain(t)
+	chain.config.Compression = CompressionConfig{Algorithm: CompressionZstd, BatchLatencyBudget: time.Hour}
+	require.NoError(t, chain.RegisterNode(4, GeoLocation{Latitude: 34.0522, Longitude: -118.2437, Region: "us-west"}))
+	chain.SetLocalNode(1)
+
+	rpc := &testRPC{}
+	transport := chain.WrapRPC(rpc)
+	defer chain.Halt()
+
+	// Appends to London wait for the budget, the same-region one does not
+	apps := []*raftpb.Message{
+		{Type: raftpb.MsgApp, From: 1, To: 3, Index: 1},
+		{Type: raftpb.MsgApp, From: 1, To: 3, Index: 2},
+	}
+	for i, msg := range apps {
+		req := raftRequest(t, *msg)
+		req.Metadata = []byte{byte(i)}
+		require.NoError(t, transport.SendConsensus(3, req))
+	}
+	require.NoError(t, transport.SendConsensus(4, raftRequest(t, raftpb.Message{Type: raftpb.MsgApp, From: 1, To: 4, Index: 2})))
+	require.Len(t, rpc.sent, 1)
+
+	// Anything else flushes the batch ahead of it
+	require.NoError(t, transport.SendConsensus(3, raftRequest(t, raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, To: 3})))
+	require.Len(t, rpc.sent, 2)
+
+	frame := rpc.sent[1]
+	require.Equal(t, "testchannel", frame.Channel)
+	require.Nil(t, frame.Metadata)
+	messages, err := DecodeAppends(frame.Payload)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	for i, want := range []raftpb.MessageType{raftpb.MsgApp, raftpb.MsgApp, raftpb.MsgHeartbeat} {
+		var msg raftpb.Message
+		require.NoError(t, msg.Unmarshal(messages[i]))
+		require.Equal(t, want, msg.Type)
+	}
+	require.Equal(t, int64(3), chain.GetMetrics().Compression[regionPairKey("us-west", "eu-west")].Messages)
+}
+
+func TestDecodeAppendsRejectsOversizedFrames(t *testing.T) {
+	// A snappy block announcing more than the limit
+	snappyFrame := binary.AppendUvarint([]byte{frameMagic, frameCodecSnappy}, maxFrameBytes+1)
+	_, err := DecodeAppends(append(snappyFrame, 0, 0, 0))
+	require.ErrorContains(t, err, "more than")
+
+	// A single-segment zstd frame announcing more than the limit, followed
+	// by an empty last block
+	zstdFrame := []byte{frameMagic, frameCodecZstd, 0x28, 0xb5, 0x2f, 0xfd, 0xe0}
+	zstdFrame = binary.LittleEndian.AppendUint64(zstdFrame, maxFrameBytes+1)
+	_, err = DecodeAppends(append(zstdFrame, 0x01, 0x00, 0x00))
+	require.ErrorContains(t, err, "exceeds configured limit")
+
+	// Frames within the limit still decode
+	frame, err := compressFrame(CompressionZstd, frameBody([][]byte{make([]byte, 1<<20)}))
+	require.NoError(t, err)
+	messages, err := DecodeAppends(frame)
+	require.NoError(t, err)
+	require.Len(t, messages[0], 1<<20)
+}
+
+func TestTransportSendsPlainRaftMessagesWithoutCompression(t *testing.T) {
+	chain := newTestChain(t)
+	chain.SetLocalNode(1)
+
+	rpc := &testRPC{}
+	transport := chain.WrapRPC(rpc)
+	defer chain.Halt()
+
+	// Without compression and batching orderers without the geo layer read
+	// every message
+	for _, msg := range []raftpb.Message{
+		{Type: raftpb.MsgApp, From: 1, To: 3, Index: 1},
+		{Type: raftpb.MsgHeartbeat, From: 1, To: 2},
+	} {
+		req := raftRequest(t, msg)
+		req.Metadata = []byte("metadata")
+		require.NoError(t, transport.SendConsensus(msg.To, req))
+		sent := rpc.sent[len(rpc.sent)-1]
+		require.Equal(t, req.Payload, sent.Payload)
+		require.Equal(t, req.Metadata, sent.Metadata)
+	}
+
+	// Plain raft messages from other orderers are passed on unchanged
+	payload := raftRequest(t, raftpb.Message{Type: raftpb.MsgAppResp, From: 3, To: 1, Index: 1}).Payload
+	require.NotEqual(t, frameMagic, payload[0])
+	messages, err := DecodeAppends(payload)
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{payload}, messages)
+}
+
+func TestAppendBatcherDoesNotBlockOtherPeers(t *testing.T) {
+	chain := newTestChain(t)
+
+	blocked, release := make(chan struct{}), make(chan struct{})
+	batcher := chain.NewAppendBatcher(1, func(to uint64, frame []byte) error {
+		if to == 3 {
+			close(blocked)
+			<-release
+		}
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- batcher.SubmitNow(3, []byte{0x08, 3}) }()
+	<-blocked
+
+	// Node 2 is reached while the send to node 3 hangs
+	require.NoError(t, batcher.SubmitNow(2, []byte{0x08, 2}))
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, batcher.Close())
+}
+
+func TestAppendBatcherReportsFailedTimedFlush(t *testing.T) {
+	chain := newTestChain(t)
+	chain.config.Compression = CompressionConfig{BatchLatencyBudget: time.Millisecond}
+
+	var mu sync.Mutex
+	attempts := 0
+	batcher := chain.NewAppendBatcher(1, func(to uint64, frame []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		return fmt.Errorf("node %d unreachable", to)
+	})
+
+	require.NoError(t, batcher.Submit(3, []byte{0x08, 1}))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts == 1
+	}, time.Second, time.Millisecond)
+
+	// The next message to the peer learns the flush failed
+	require.EqualError(t, batcher.Submit(3, []byte{0x08, 2}), "node 3 unreachable")
+	batcher.Close()
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations of a planned topology change
+const (
+	PlanOpAdd    = "add"
+	PlanOpRemove = "remove"
+	PlanOpMove   = "move"
+)
+
+// PlanChange is a hypothetical change to a chain's topology
+type PlanChange struct {
+	Op       string       `json:"op"`
+	NodeID   uint64       `json:"node_id"`
+	Location *GeoLocation `json:"location,omitempty"`
+}
+
+// FaultTolerance describes how many failures a topology survives while
+// keeping a raft quorum. Domains repeats the region analysis for every
+// topology label the nodes set.
+type FaultTolerance struct {
+	NodeFailures    int                        `json:"node_failures"`
+	RegionFailures  int                        `json:"region_failures"`
+	CriticalRegions []string                   `json:"critical_regions,omitempty"`
+	Domains         map[string]DomainTolerance `json:"domains,omitempty"`
+}
+
+// PlanPrediction is the predicted behaviour of a topology
+type PlanPrediction struct {
+	Nodes               int                      `json:"nodes"`
+	Regions             []string                 `json:"regions"`
+	LeaderID            uint64                   `json:"leader_id"`
+	LeaderRegion        string                   `json:"leader_region"`
+	Candidates          []leaderCandidate        `json:"candidates"`
+	QuorumSize          int                      `json:"quorum_size"`
+	LeaderQuorumLatency time.Duration            `json:"leader_quorum_latency"`
+	CommitLatency       map[string]time.Duration `json:"commit_latency"`
+	FaultTolerance      FaultTolerance           `json:"fault_tolerance"`
+}
+
+// WhatIfResult compares a chain's current topology with the topology
+// after a set of planned changes
+type WhatIfResult struct {
+	CurrentLeaderID uint64         `json:"current_leader_id"`
+	Changes         []PlanChange   `json:"changes"`
+	Baseline        PlanPrediction `json:"baseline"`
+	Predicted       PlanPrediction `json:"predicted"`
+	LeaderChanged   bool           `json:"leader_changed"`
+}
+
+// clone returns a detached copy of the chain's topology for planning. The
+// copy has no underlying etcdraft chain, event stream or election history,
+// so nothing done to it is visible outside.
+func (g *GeoEtcdRaft) clone() *GeoEtcdRaft {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	planning := newPlanningChain(g.nodes, g.config)
+	planning.clock = g.clock
+	planning.baseTimeouts = g.baseTimeouts
+	planning.carbonSource = g.carbonSource
+	// Observed blocks carry over so plans weigh egress cost
+	planning.metrics.EgressCost = g.metrics.EgressCost
+	planning.metrics.EgressCost.MonthlyCost = nil
+	return planning
+}
+
+// newPlanningChain builds a detached chain from a set of nodes, copying
+// them and the config and recomputing the proximity matrix
+func newPlanningChain(nodes map[uint64]*GeoNode, config *GeoConfig) *GeoEtcdRaft {
+	planning := NewGeoEtcdRaft(nil, config.Clone())
+
+	for nodeID, node := range nodes {
+		copied := *node
+		copied.NodeID = nodeID
+		copied.Latency = make(map[uint64]time.Duration, len(node.Latency))
+		for otherID, latency := range node.Latency {
+			copied.Latency[otherID] = latency
+		}
+		planning.nodes[nodeID] = &copied
+		if copied.IsLeader {
+			planning.regionLeaders[copied.Location.Region] = nodeID
+		}
+	}
+	for nodeID := range planning.nodes {
+		planning.updateProximityMatrix(nodeID)
+	}
+
+	return planning
+}
+
+// applyPlanChange applies a planned change to a planning chain. Latencies
+// to added or moved nodes are estimated from distance. Callers must hold
+// g.mu.
+func (g *GeoEtcdRaft) applyPlanChange(change PlanChange) error {
+	node := g.nodes[change.NodeID]
+
+	switch change.Op {
+	case PlanOpAdd:
+		if change.NodeID == 0 || change.Location == nil {
+			return fmt.Errorf("add requires node_id and location")
+		}
+		if node != nil {
+			return fmt.Errorf("node %d is already registered", change.NodeID)
+		}
+		node = &GeoNode{
+			NodeID:   change.NodeID,
+			Location: *change.Location,
+			LastSeen: g.now(),
+			Latency:  make(map[uint64]time.Duration),
+		}
+		g.nodes[change.NodeID] = node
+	case PlanOpMove:
+		if change.Location == nil {
+			return fmt.Errorf("move requires a location")
+		}
+		if node == nil {
+			return fmt.Errorf("node %d is not registered", change.NodeID)
+		}
+		if node.IsLeader {
+			delete(g.regionLeaders, node.Location.Region)
+			g.regionLeaders[change.Location.Region] = change.NodeID
+		}
+		node.Location = *change.Location
+	case PlanOpRemove:
+		if node == nil {
+			return fmt.Errorf("node %d is not registered", change.NodeID)
+		}
+		delete(g.nodes, change.NodeID)
+		delete(g.proximityMatrix, change.NodeID)
+		for _, row := range g.proximityMatrix {
+			delete(row, change.NodeID)
+		}
+		for _, other := range g.nodes {
+			delete(other.Latency, change.NodeID)
+		}
+		for region, leaderID := range g.regionLeaders {
+			if leaderID == change.NodeID {
+				delete(g.regionLeaders, region)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown plan operation %q", change.Op)
+	}
+
+	// Estimate latencies of the added or moved node
+	for otherID, other := range g.nodes {
+		if otherID == change.NodeID {
+			continue
+		}
+		node.Latency[otherID] = g.estimateLatency(node.Location, other.Location)
+		other.Latency[change.NodeID] = g.estimateLatency(other.Location, node.Location)
+	}
+	g.updateProximityMatrix(change.NodeID)
+
+	return nil
+}
+
+// pairLatency returns the latest latency between two nodes, estimating it
+// from distance if it was never measured. Callers must hold g.mu.
+func (g *GeoEtcdRaft) pairLatency(from, to uint64) time.Duration {
+	if from == to {
+		return 0
+	}
+	fromNode, toNode := g.nodes[from], g.nodes[to]
+	if fromNode == nil || toNode == nil {
+		return 0
+	}
+	if latency, exists := fromNode.Latency[to]; exists {
+		return latency
+	}
+	if latency, exists := toNode.Latency[from]; exists {
+		return latency
+	}
+	return g.estimateLatency(fromNode.Location, toNode.Location)
+}
+
+// faultTolerance computes how many node failures, and whole-domain failures
+// of each topology label, the topology survives. Callers must hold g.mu.
+func (g *GeoEtcdRaft) faultTolerance() FaultTolerance {
+	total := len(g.nodes)
+	quorum := quorumSize(total)
+	tolerance := FaultTolerance{NodeFailures: total - quorum}
+	if total == 0 {
+		tolerance.NodeFailures = 0
+		return tolerance
+	}
+
+	locations := make([]GeoLocation, 0, total)
+	for _, node := range g.nodes {
+		locations = append(locations, node.Location)
+	}
+
+	regions := domainTolerance(locations, LabelRegion, quorum)
+	tolerance.RegionFailures = regions.Failures
+	tolerance.CriticalRegions = regions.Critical
+
+	tolerance.Domains = make(map[string]DomainTolerance)
+	for _, label := range g.config.topologyLabels() {
+		if len(domainSizes(locations, label.Name)) > 0 {
+			tolerance.Domains[label.Name] = domainTolerance(locations, label.Name, quorum)
+		}
+	}
+
+	return tolerance
+}
+
+// predict scores the chain's nodes and predicts leader, commit latency
+// per region and fault tolerance. Callers must hold g.mu.
+func (g *GeoEtcdRaft) predict() PlanPrediction {
+	prediction := PlanPrediction{
+		Nodes:          len(g.nodes),
+		Regions:        g.getUniqueRegions(),
+		Candidates:     g.rankCandidates(g.nodeIDs()),
+		QuorumSize:     quorumSize(len(g.nodes)),
+		CommitLatency:  make(map[string]time.Duration),
+		FaultTolerance: g.faultTolerance(),
+	}
+	sort.Strings(prediction.Regions)
+	if prediction.Candidates == nil {
+		prediction.Candidates = []leaderCandidate{}
+	}
+
+	if len(prediction.Candidates) == 0 {
+		return prediction
+	}
+
+	leaderID := prediction.Candidates[0].NodeID
+	prediction.LeaderID = leaderID
+	prediction.LeaderRegion = g.nodes[leaderID].Location.Region
+	prediction.LeaderQuorumLatency = g.leaderQuorumLatency(leaderID)
+	prediction.CommitLatency = g.regionCommitLatency(leaderID)
+
+	return prediction
+}
+
+// regionCommitLatency returns the commit latency seen by clients in each
+// region under the given leader. Clients submit to their closest orderer,
+// which forwards to the leader, which then waits for its quorum. Callers
+// must hold g.mu.
+func (g *GeoEtcdRaft) regionCommitLatency(leaderID uint64) map[string]time.Duration {
+	quorumLatency := g.leaderQuorumLatency(leaderID)
+
+	commit := make(map[string]time.Duration)
+	for nodeID, node := range g.nodes {
+		latency := g.pairLatency(nodeID, leaderID) + quorumLatency
+		if current, exists := commit[node.Location.Region]; !exists || latency < current {
+			commit[node.Location.Region] = latency
+		}
+	}
+	return commit
+}
+
+// PlanWhatIf predicts the effect of the given changes on the chain without
+// modifying it
+func (g *GeoEtcdRaft) PlanWhatIf(changes []PlanChange) (*WhatIfResult, error) {
+	planning := g.clone()
+	planning.mu.Lock()
+	defer planning.mu.Unlock()
+
+	result := &WhatIfResult{
+		CurrentLeaderID: planning.leaderID(),
+		Changes:         changes,
+		Baseline:        planning.predict(),
+	}
+
+	for i, change := range changes {
+		if err := planning.applyPlanChange(change); err != nil {
+			return nil, fmt.Errorf("change %d: %v", i+1, err)
+		}
+	}
+
+	result.Predicted = planning.predict()
+	result.LeaderChanged = result.Predicted.LeaderID != result.Baseline.LeaderID
+
+	return result, nil
+}
+
+// whatIfRequest is the body accepted by /chains/whatif
+type whatIfRequest struct {
+	Changes []PlanChange `json:"changes"`
+}
+
+// handleWhatIf predicts the effect of hypothetical node changes on a chain.
+// It never changes the chain.
+func (gc *GeoConsenter) handleWhatIf(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chainID := r.URL.Query().Get("id")
+	if chainID == "" {
+		http.Error(w, "Query parameter id is required", http.StatusBadRequest)
+		return
+	}
+
+	gc.mu.RLock()
+	chain, exists := gc.chains[chainID]
+	gc.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, fmt.Sprintf("Chain %s not found", chainID), http.StatusNotFound)
+		return
+	}
+
+	var req whatIfRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result, err := chain.PlanWhatIf(req.Changes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	response := map[string]interface{}{
+		"chain_id":  chainID,
+		"timestamp": time.Now(),
+		"plan":      result,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// planChangeFlag collects plan changes from repeated command line flags,
+// keeping their order
+type planChangeFlag struct {
+	op      string
+	changes *[]PlanChange
+}
+
+func (f planChangeFlag) String() string {
+	return ""
+}
+
+// Set parses "id" for remove and "id,lat,lon,region[,zone[,datacenter]]"
+// for add and move
+func (f planChangeFlag) Set(value string) error {
+	fields := strings.Split(value, ",")
+	nodeID, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid node id %q", fields[0])
+	}
+	change := PlanChange{Op: f.op, NodeID: nodeID}
+
+	if f.op != PlanOpRemove {
+		if len(fields) < 4 || len(fields) > 6 {
+			return fmt.Errorf("expected id,lat,lon,region[,zone[,datacenter]], got %q", value)
+		}
+		location := &GeoLocation{Region: strings.TrimSpace(fields[3])}
+		if location.Latitude, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err != nil {
+			return fmt.Errorf("invalid latitude %q", fields[1])
+		}
+		if location.Longitude, err = strconv.ParseFloat(strings.TrimSpace(fields[2]), 64); err != nil {
+			return fmt.Errorf("invalid longitude %q", fields[2])
+		}
+		if len(fields) > 4 {
+			location.Zone = strings.TrimSpace(fields[4])
+		}
+		if len(fields) > 5 {
+			location.DataCenter = strings.TrimSpace(fields[5])
+		}
+		change.Location = location
+	} else if len(fields) != 1 {
+		return fmt.Errorf("expected a node id, got %q", value)
+	}
+
+	*f.changes = append(*f.changes, change)
+	return nil
+}
+
+// runWhatIf implements the whatif command
+func runWhatIf(args []string) error {
+	flags := flag.NewFlagSet("whatif", flag.ContinueOnError)
+	topologyFile := flags.String("topology", "", "saved response of the /topology endpoint (required)")
+	channel := flags.String("channel", "", "channel to plan for, if the topology holds several")
+	changesFile := flags.String("changes", "", `JSON file with {"changes": [{"op": ..., "node_id": ..., "location": {...}}]}`)
+
+	var changes []PlanChange
+	flags.Var(planChangeFlag{op: PlanOpAdd, changes: &changes}, "add", "add a node: id,lat,lon,region[,zone[,datacenter]] (repeatable)")
+	flags.Var(planChangeFlag{op: PlanOpMove, changes: &changes}, "move", "move a node: id,lat,lon,region[,zone[,datacenter]] (repeatable)")
+	flags.Var(planChangeFlag{op: PlanOpRemove, changes: &changes}, "remove", "remove a node: id (repeatable)")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *topologyFile == "" {
+		flags.Usage()
+		return fmt.Errorf("-topology is required")
+	}
+
+	// Changes from the file come before those given as flags
+	if *changesFile != "" {
+		data, err := os.ReadFile(*changesFile)
+		if err != nil {
+			return err
+		}
+		var req whatIfRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", *changesFile, err)
+		}
+		changes = append(req.Changes, changes...)
+	}
+	if len(changes) == 0 {
+		return fmt.Errorf("no changes given, use -add, -move, -remove or -changes")
+	}
+
+	chain, chainID, err := loadTopologyChain(*topologyFile, *channel)
+	if err != nil {
+		return err
+	}
+
+	result, err := chain.PlanWhatIf(changes)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(map[string]interface{}{
+		"chain_id": chainID,
+		"plan":     result,
+	})
+}
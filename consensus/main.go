@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// cliCommand is an offline geo-consenter tool
+type cliCommand struct {
+	summary string
+	run     func(args []string) error
+}
+
+// cliCommands lists the tools available as geo-consenter subcommands
+var cliCommands = map[string]cliCommand{
+	"placement": {"recommend orderer sites that minimize commit latency and survive a region loss", runPlacement},
+	"replay":    {"compare GeoConfig settings and scoring strategies over a recorded latency trace", runReplay},
+	"whatif":    {"predict leader, commit latency and fault tolerance after adding, moving or removing nodes", runWhatIf},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	command, exists := cliCommands[os.Args[1]]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err := command.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "geo-consenter %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// printUsage lists the available subcommands
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: geo-consenter <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, cliCommands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun geo-consenter <command> -h for the flags of a command.")
+}
+
+// topologyDump is the response of the /topology endpoint
+type topologyDump struct {
+	Timestamp time.Time `json:"timestamp"`
+	Topology  map[string]struct {
+		Nodes  map[uint64]*GeoNode `json:"nodes"`
+		Config *GeoConfig          `json:"config"`
+	} `json:"topology"`
+}
+
+// loadTopologyChain builds a detached chain from a saved /topology
+// response. channel may be empty if the dump holds a single chain.
+func loadTopologyChain(path string, channel string) (*GeoEtcdRaft, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var dump topologyDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, "", fmt.Errorf("failed to parse topology %s: %v", path, err)
+	}
+
+	if channel == "" {
+		if len(dump.Topology) != 1 {
+			return nil, "", fmt.Errorf("topology holds %d chains, select one with -channel", len(dump.Topology))
+		}
+		for chainID := range dump.Topology {
+			channel = chainID
+		}
+	}
+
+	chain, exists := dump.Topology[channel]
+	if !exists {
+		return nil, "", fmt.Errorf("chain %s not found in %s", channel, path)
+	}
+
+	config := chain.Config
+	if config == nil {
+		config = NewGeoConfig()
+	}
+
+	// Shift LastSeen so that nodes live when the dump was taken are not
+	// scored as inactive now
+	if !dump.Timestamp.IsZero() {
+		age := time.Since(dump.Timestamp)
+		for _, node := range chain.Nodes {
+			node.LastSeen = node.LastSeen.Add(age)
+		}
+	}
+
+	return newPlanningChain(chain.Nodes, config), channel, nil
+}
+
+// readJSONFile decodes a JSON file into value
+func readJSONFile(path string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return nil
+}
+
+// writeJSON prints a value as indented JSON on stdout
+func writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
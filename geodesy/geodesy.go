@@ -0,0 +1,153 @@
+// Package geodesy provides the geographic calculations shared by the
+// geo-aware orderer and the geo-asset chaincode: great-circle distances,
+// bearings, destination points and bounding boxes on a spherical Earth, and
+// Vincenty's ellipsoidal distance on WGS-84.
+//
+// Positions are in decimal degrees, distances in kilometres and bearings in
+// degrees clockwise from true north, in [0, 360).
+package geodesy
+
+import "math"
+
+// EarthRadiusKm is the mean Earth radius used by the spherical functions
+const EarthRadiusKm = 6371.0
+
+// Point is a position in decimal degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// Box is a latitude/longitude bounding box. A box crossing the
+// antimeridian has MinLon > MaxLon.
+type Box struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// Haversine returns the great-circle distance between two points on the
+// mean sphere
+func Haversine(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	deltaLat := radians(b.Lat - a.Lat)
+	deltaLon := radians(b.Lon - a.Lon)
+
+	h := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(deltaLon/2)*math.Sin(deltaLon/2)
+
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// InitialBearing returns the great-circle bearing at a towards b
+func InitialBearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	deltaLon := radians(b.Lon - a.Lon)
+
+	y := math.Sin(deltaLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(deltaLon)
+
+	return normalizeBearing(degrees(math.Atan2(y, x)))
+}
+
+// FinalBearing returns the great-circle bearing on arrival at b from a
+func FinalBearing(a, b Point) float64 {
+	return normalizeBearing(InitialBearing(b, a) + 180)
+}
+
+// Destination returns the point reached by travelling distanceKm along the
+// great circle leaving start at the given bearing
+func Destination(start Point, bearing, distanceKm float64) Point {
+	lat1, lon1 := radians(start.Lat), radians(start.Lon)
+	theta := radians(bearing)
+	delta := distanceKm / EarthRadiusKm
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) +
+		math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1),
+		math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+
+	return Point{Lat: degrees(lat2), Lon: normalizeLongitude(degrees(lon2))}
+}
+
+// Midpoint returns the point halfway along the great circle from a to b
+func Midpoint(a, b Point) Point {
+	lat1, lon1 := radians(a.Lat), radians(a.Lon)
+	lat2 := radians(b.Lat)
+	deltaLon := radians(b.Lon - a.Lon)
+
+	bx := math.Cos(lat2) * math.Cos(deltaLon)
+	by := math.Cos(lat2) * math.Sin(deltaLon)
+
+	lat := math.Atan2(math.Sin(lat1)+math.Sin(lat2), math.Sqrt((math.Cos(lat1)+bx)*(math.Cos(lat1)+bx)+by*by))
+	lon := lon1 + math.Atan2(by, math.Cos(lat1)+bx)
+
+	return Point{Lat: degrees(lat), Lon: normalizeLongitude(degrees(lon))}
+}
+
+// BoundingBox returns the smallest box containing every point within
+// radiusKm of center on the mean sphere. Boxes reaching a pole span all
+// longitudes.
+func BoundingBox(center Point, radiusKm float64) Box {
+	delta := radiusKm / EarthRadiusKm
+	lat := radians(center.Lat)
+
+	box := Box{
+		MinLat: degrees(lat - delta),
+		MaxLat: degrees(lat + delta),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+
+	if box.MinLat <= -90 || box.MaxLat >= 90 {
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	deltaLon := degrees(math.Asin(math.Sin(delta) / math.Cos(lat)))
+	box.MinLon = normalizeLongitude(center.Lon - deltaLon)
+	box.MaxLon = normalizeLongitude(center.Lon + deltaLon)
+	return box
+}
+
+// Contains reports whether the box contains the point
+func (b Box) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	lon := normalizeLongitude(p.Lon)
+	if b.MinLon <= b.MaxLon {
+		return lon >= b.MinLon && lon <= b.MaxLon
+	}
+	return lon >= b.MinLon || lon <= b.MaxLon
+}
+
+// radians converts degrees to radians
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// degrees converts radians to degrees
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// normalizeBearing maps a bearing to [0, 360)
+func normalizeBearing(bearing float64) float64 {
+	bearing = math.Mod(bearing, 360)
+	if bearing < 0 {
+		bearing += 360
+	}
+	return bearing
+}
+
+// normalizeLongitude maps a longitude to [-180, 180)
+func normalizeLongitude(lon float64) float64 {
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
@@ -0,0 +1,295 @@
+package geodesy
+
+import (
+	"math"
+	"testing"
+)
+
+// referenceVector is a published geodesic with its expected distance and
+// bearings. Tolerances are in kilometres and degrees.
+type referenceVector struct {
+	Source            string
+	Ellipsoid         *Ellipsoid // nil for the mean sphere
+	From              Point
+	To                Point
+	DistanceKm        float64
+	InitialBearing    float64
+	FinalBearing      float64 // NaN if not published
+	DistanceTolerance float64
+	BearingTolerance  float64
+}
+
+// referenceVectors are published test lines for the spherical and
+// ellipsoidal solutions
+var referenceVectors = []referenceVector{
+	{
+		// T. Vincenty, Direct and Inverse Solutions of Geodesics on the
+		// Ellipsoid, Survey Review XXIII (176), 1975, test line (a)
+		Source:            "Vincenty 1975 (a)",
+		Ellipsoid:         &Bessel,
+		From:              Point{Lat: dms(55, 45, 0), Lon: 0},
+		To:                Point{Lat: -dms(33, 26, 0), Lon: dms(108, 13, 0)},
+		DistanceKm:        14110.526170,
+		InitialBearing:    dms(96, 36, 8.79960),
+		FinalBearing:      dms(137, 52, 22.01454),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  1e-6,
+	},
+	{
+		Source:            "Vincenty 1975 (b)",
+		Ellipsoid:         &International,
+		From:              Point{Lat: dms(37, 19, 54.95367), Lon: 0},
+		To:                Point{Lat: dms(26, 7, 42.83946), Lon: dms(41, 28, 35.50729)},
+		DistanceKm:        4085.966703,
+		InitialBearing:    dms(95, 27, 59.63089),
+		FinalBearing:      dms(118, 5, 58.96161),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  1e-6,
+	},
+	{
+		Source:            "Vincenty 1975 (c)",
+		Ellipsoid:         &International,
+		From:              Point{Lat: dms(35, 16, 11.24862), Lon: 0},
+		To:                Point{Lat: dms(67, 22, 14.77638), Lon: dms(137, 47, 28.31435)},
+		DistanceKm:        8084.823839,
+		InitialBearing:    dms(15, 44, 23.74850),
+		FinalBearing:      dms(144, 55, 39.92147),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  1e-6,
+	},
+	{
+		Source:            "Vincenty 1975 (d)",
+		Ellipsoid:         &International,
+		From:              Point{Lat: 1, Lon: 0},
+		To:                Point{Lat: -dms(0, 59, 53.83076), Lon: dms(179, 17, 48.02997)},
+		DistanceKm:        19960.000000,
+		InitialBearing:    89,
+		FinalBearing:      dms(91, 0, 6.11733),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  1e-6,
+	},
+	{
+		Source:            "Vincenty 1975 (e)",
+		Ellipsoid:         &International,
+		From:              Point{Lat: 1, Lon: 0},
+		To:                Point{Lat: dms(1, 1, 15.18952), Lon: dms(179, 46, 17.84244)},
+		DistanceKm:        19780.006558,
+		InitialBearing:    dms(4, 59, 59.99995),
+		FinalBearing:      dms(174, 59, 59.88481),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  1e-6,
+	},
+	{
+		// Geoscience Australia, Geodetic Calculations - Vincenty's
+		// Formulae, Flinders Peak to Buninyong
+		Source:            "Geoscience Australia Flinders Peak-Buninyong",
+		Ellipsoid:         &GRS80,
+		From:              Point{Lat: -dms(37, 57, 3.72030), Lon: dms(144, 25, 29.52440)},
+		To:                Point{Lat: -dms(37, 39, 10.15610), Lon: dms(143, 55, 35.38390)},
+		DistanceKm:        54.972271,
+		InitialBearing:    dms(306, 52, 5.37),
+		FinalBearing:      dms(307, 10, 25.07),
+		DistanceTolerance: 1e-6,
+		BearingTolerance:  0.01 / 3600,
+	},
+	{
+		// E. Williams, Aviation Formulary, LAX to JFK: 0.623585 rad on the
+		// sphere, initial course 66 degrees
+		Source:            "Aviation Formulary LAX-JFK",
+		From:              lax,
+		To:                jfk,
+		DistanceKm:        0.623585 * EarthRadiusKm,
+		InitialBearing:    66,
+		FinalBearing:      math.NaN(),
+		DistanceTolerance: 0.01,
+		BearingTolerance:  0.5,
+	},
+}
+
+// The airports of the Aviation Formulary examples
+var (
+	lax = Point{Lat: dms(33, 57, 0), Lon: -dms(118, 24, 0)}
+	jfk = Point{Lat: dms(40, 38, 0), Lon: -dms(73, 47, 0)}
+)
+
+// quarterKm is a quarter of a great circle on the mean sphere
+const quarterKm = math.Pi * EarthRadiusKm / 2
+
+// bearingDiff returns the absolute difference between two bearings
+func bearingDiff(a, b float64) float64 {
+	diff := math.Abs(normalizeBearing(a) - normalizeBearing(b))
+	return math.Min(diff, 360-diff)
+}
+
+// dms converts degrees, minutes and seconds to decimal degrees
+func dms(deg, min, sec float64) float64 {
+	return deg + min/60 + sec/3600
+}
+
+func TestReferenceVectors(t *testing.T) {
+	for _, v := range referenceVectors {
+		t.Run(v.Source, func(t *testing.T) {
+			var got Geodesic
+			if v.Ellipsoid != nil {
+				var err error
+				if got, err = v.Ellipsoid.Inverse(v.From, v.To); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				got = Geodesic{
+					DistanceKm:     Haversine(v.From, v.To),
+					InitialBearing: InitialBearing(v.From, v.To),
+					FinalBearing:   FinalBearing(v.From, v.To),
+				}
+			}
+
+			if math.Abs(got.DistanceKm-v.DistanceKm) > v.DistanceTolerance {
+				t.Errorf("distance %.6f km, want %.6f km", got.DistanceKm, v.DistanceKm)
+			}
+			if bearingDiff(got.InitialBearing, v.InitialBearing) > v.BearingTolerance {
+				t.Errorf("initial bearing %.8f, want %.8f", got.InitialBearing, v.InitialBearing)
+			}
+			if !math.IsNaN(v.FinalBearing) && bearingDiff(got.FinalBearing, v.FinalBearing) > v.BearingTolerance {
+				t.Errorf("final bearing %.8f, want %.8f", got.FinalBearing, v.FinalBearing)
+			}
+
+			// The direct solution must lead back to the published end point
+			if v.Ellipsoid != nil {
+				end, _ := v.Ellipsoid.Direct(v.From, v.InitialBearing, v.DistanceKm)
+				if Haversine(end, v.To) > v.DistanceTolerance {
+					t.Errorf("direct solution ends at %v, want %v", end, v.To)
+				}
+			}
+		})
+	}
+}
+
+func TestHaversine(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"same point", Point{Lat: 48.85, Lon: 2.35}, Point{Lat: 48.85, Lon: 2.35}, 0},
+		{"equator to pole", Point{Lat: 0, Lon: 0}, Point{Lat: 90, Lon: 0}, quarterKm},
+		{"quarter of the equator", Point{Lat: 0, Lon: 0}, Point{Lat: 0, Lon: 90}, quarterKm},
+		{"antipodes", Point{Lat: 0, Lon: 0}, Point{Lat: 0, Lon: 180}, 2 * quarterKm},
+		{"across the antimeridian", Point{Lat: 0, Lon: 179}, Point{Lat: 0, Lon: -179}, 2 * math.Pi * EarthRadiusKm / 180},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Haversine(tc.a, tc.b); math.Abs(got-tc.want) > 1e-6 {
+				t.Errorf("Haversine(%v, %v) = %.6f km, want %.6f km", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBearings(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		a, b           Point
+		initial, final float64
+	}{
+		{"north", Point{Lat: 0, Lon: 0}, Point{Lat: 10, Lon: 0}, 0, 0},
+		{"east along the equator", Point{Lat: 0, Lon: 0}, Point{Lat: 0, Lon: 10}, 90, 90},
+		{"south", Point{Lat: 10, Lon: 0}, Point{Lat: 0, Lon: 0}, 180, 180},
+		{"west across the antimeridian", Point{Lat: 0, Lon: -179}, Point{Lat: 0, Lon: 179}, 270, 270},
+		{"to the pole", Point{Lat: 0, Lon: 45}, Point{Lat: 90, Lon: 0}, 0, 315},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := InitialBearing(tc.a, tc.b); bearingDiff(got, tc.initial) > 1e-9 {
+				t.Errorf("initial bearing %.9f, want %.9f", got, tc.initial)
+			}
+			if got := FinalBearing(tc.a, tc.b); bearingDiff(got, tc.final) > 1e-9 {
+				t.Errorf("final bearing %.9f, want %.9f", got, tc.final)
+			}
+		})
+	}
+}
+
+func TestDestination(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		start      Point
+		bearing    float64
+		distanceKm float64
+		want       Point
+	}{
+		{"nowhere", Point{Lat: 12, Lon: 34}, 123, 0, Point{Lat: 12, Lon: 34}},
+		{"east along the equator", Point{Lat: 0, Lon: 0}, 90, quarterKm, Point{Lat: 0, Lon: 90}},
+		{"north to the pole", Point{Lat: 0, Lon: 0}, 0, quarterKm, Point{Lat: 90, Lon: 0}},
+		{"across the antimeridian", Point{Lat: 0, Lon: 170}, 90, 2 * quarterKm / 9, Point{Lat: 0, Lon: -170}},
+		{"LAX to JFK", lax, InitialBearing(lax, jfk), Haversine(lax, jfk), jfk},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Destination(tc.start, tc.bearing, tc.distanceKm); Haversine(got, tc.want) > 1e-6 {
+				t.Errorf("Destination = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBoundingBox(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		center   Point
+		radiusKm float64
+		want     Box
+		inside   []Point
+		outside  []Point
+	}{
+		{
+			name:     "equator",
+			center:   Point{Lat: 0, Lon: 0},
+			radiusKm: quarterKm / 9,
+			want:     Box{MinLat: -10, MinLon: -10, MaxLat: 10, MaxLon: 10},
+			inside:   []Point{{Lat: 9.9, Lon: 0}, {Lat: 0, Lon: -9.9}},
+			outside:  []Point{{Lat: 10.1, Lon: 0}, {Lat: 0, Lon: 10.1}},
+		},
+		{
+			name:     "across the antimeridian",
+			center:   Point{Lat: 0, Lon: 179},
+			radiusKm: quarterKm / 45,
+			want:     Box{MinLat: -2, MinLon: 177, MaxLat: 2, MaxLon: -179},
+			inside:   []Point{{Lat: 0, Lon: 180}, {Lat: 1, Lon: -179.5}, {Lat: -1, Lon: 178}},
+			outside:  []Point{{Lat: 0, Lon: 0}, {Lat: 0, Lon: -178}, {Lat: 0, Lon: 176}},
+		},
+		{
+			name:     "reaching the pole",
+			center:   Point{Lat: 85, Lon: 30},
+			radiusKm: quarterKm / 9,
+			want:     Box{MinLat: 75, MinLon: -180, MaxLat: 90, MaxLon: 180},
+			inside:   []Point{{Lat: 89, Lon: -150}, {Lat: 76, Lon: 30}},
+			outside:  []Point{{Lat: 74, Lon: 30}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := BoundingBox(tc.center, tc.radiusKm)
+			for _, pair := range [][2]float64{
+				{got.MinLat, tc.want.MinLat}, {got.MinLon, tc.want.MinLon},
+				{got.MaxLat, tc.want.MaxLat}, {got.MaxLon, tc.want.MaxLon},
+			} {
+				if math.Abs(pair[0]-pair[1]) > 1e-9 {
+					t.Fatalf("BoundingBox = %+v, want %+v", got, tc.want)
+				}
+			}
+			for _, p := range tc.inside {
+				if !got.Contains(p) {
+					t.Errorf("%+v does not contain %v", got, p)
+				}
+			}
+			for _, p := range tc.outside {
+				if got.Contains(p) {
+					t.Errorf("%+v contains %v", got, p)
+				}
+			}
+
+			// Every point on the circle lies in the box
+			for bearing := 0.0; bearing < 360; bearing += 15 {
+				if p := Destination(tc.center, bearing, tc.radiusKm); !got.Contains(p) {
+					t.Errorf("%+v does not contain %v at bearing %v", got, p, bearing)
+				}
+			}
+		})
+	}
+}
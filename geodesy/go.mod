@@ -0,0 +1,3 @@
+module fabric-geo-consensus/geodesy
+
+go 1.19
@@ -0,0 +1,183 @@
+package geodesy
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrNoConvergence is returned by Inverse for nearly antipodal points,
+// where Vincenty's iteration does not converge
+var ErrNoConvergence = errors.New("geodesy: vincenty formula failed to converge")
+
+const (
+	vincentyTolerance     = 1e-12
+	vincentyMaxIterations = 200
+)
+
+// Ellipsoid is a reference ellipsoid given by its semi-major axis in metres
+// and its flattening
+type Ellipsoid struct {
+	Name       string
+	SemiMajor  float64
+	Flattening float64
+}
+
+// Reference ellipsoids
+var (
+	WGS84         = Ellipsoid{Name: "WGS-84", SemiMajor: 6378137, Flattening: 1 / 298.257223563}
+	GRS80         = Ellipsoid{Name: "GRS 80", SemiMajor: 6378137, Flattening: 1 / 298.257222101}
+	International = Ellipsoid{Name: "International 1924", SemiMajor: 6378388, Flattening: 1.0 / 297}
+	Bessel        = Ellipsoid{Name: "Bessel 1841", SemiMajor: 6377397.155, Flattening: 1 / 299.1528128}
+)
+
+// Geodesic is the shortest path between two points on an ellipsoid
+type Geodesic struct {
+	DistanceKm     float64 `json:"distance_km"`
+	InitialBearing float64 `json:"initial_bearing"`
+	FinalBearing   float64 `json:"final_bearing"`
+}
+
+// Distance returns the WGS-84 ellipsoidal distance between two points,
+// falling back to the spherical distance for nearly antipodal points
+func Distance(a, b Point) float64 {
+	geodesic, err := WGS84.Inverse(a, b)
+	if err != nil {
+		return Haversine(a, b)
+	}
+	return geodesic.DistanceKm
+}
+
+// Vincenty returns the WGS-84 ellipsoidal distance between two points
+func Vincenty(a, b Point) (float64, error) {
+	geodesic, err := WGS84.Inverse(a, b)
+	return geodesic.DistanceKm, err
+}
+
+// semiMinor returns the semi-minor axis in metres
+func (e Ellipsoid) semiMinor() float64 {
+	return (1 - e.Flattening) * e.SemiMajor
+}
+
+// Inverse solves Vincenty's inverse problem: the distance and bearings of
+// the geodesic from a to b
+func (e Ellipsoid) Inverse(a, b Point) (Geodesic, error) {
+	f := e.Flattening
+	semiMinor := e.semiMinor()
+
+	L := radians(normalizeLongitude(b.Lon - a.Lon))
+	tanU1 := (1 - f) * math.Tan(radians(a.Lat))
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	tanU2 := (1 - f) * math.Tan(radians(b.Lat))
+	cosU2 := 1 / math.Sqrt(1+tanU2*tanU2)
+	sinU2 := tanU2 * cosU2
+
+	lambda := L
+	var sinLambda, cosLambda, sinSigma, cosSigma, sigma, cosSqAlpha, cos2SigmaM float64
+	converged := false
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda = math.Sin(lambda), math.Cos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			// Coincident points
+			return Geodesic{}, nil
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cosSqAlpha != 0 {
+			// Otherwise the geodesic runs along the equator
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+
+		previous := lambda
+		lambda = L + (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda) > math.Pi {
+			return Geodesic{}, ErrNoConvergence
+		}
+		if math.Abs(lambda-previous) < vincentyTolerance {
+			converged = true
+			break
+		}
+	}
+	if !converged {
+		return Geodesic{}, ErrNoConvergence
+	}
+
+	uSq := cosSqAlpha * (e.SemiMajor*e.SemiMajor - semiMinor*semiMinor) / (semiMinor * semiMinor)
+	A, B := vincentyCoefficients(uSq)
+	deltaSigma := vincentyDeltaSigma(B, sinSigma, cosSigma, cos2SigmaM)
+
+	distance := semiMinor * A * (sigma - deltaSigma)
+	alpha1 := math.Atan2(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+	alpha2 := math.Atan2(cosU1*sinLambda, -sinU1*cosU2+cosU1*sinU2*cosLambda)
+
+	return Geodesic{
+		DistanceKm:     distance / 1000,
+		InitialBearing: normalizeBearing(degrees(alpha1)),
+		FinalBearing:   normalizeBearing(degrees(alpha2)),
+	}, nil
+}
+
+// Direct solves Vincenty's direct problem: the point reached by travelling
+// distanceKm along the geodesic leaving start at the given bearing, and the
+// bearing on arrival
+func (e Ellipsoid) Direct(start Point, bearing, distanceKm float64) (Point, float64) {
+	f := e.Flattening
+	semiMinor := e.semiMinor()
+	s := distanceKm * 1000
+
+	alpha1 := radians(bearing)
+	sinAlpha1, cosAlpha1 := math.Sin(alpha1), math.Cos(alpha1)
+
+	tanU1 := (1 - f) * math.Tan(radians(start.Lat))
+	cosU1 := 1 / math.Sqrt(1+tanU1*tanU1)
+	sinU1 := tanU1 * cosU1
+	sigma1 := math.Atan2(tanU1, cosAlpha1)
+	sinAlpha := cosU1 * sinAlpha1
+	cosSqAlpha := 1 - sinAlpha*sinAlpha
+	uSq := cosSqAlpha * (e.SemiMajor*e.SemiMajor - semiMinor*semiMinor) / (semiMinor * semiMinor)
+	A, B := vincentyCoefficients(uSq)
+
+	sigma := s / (semiMinor * A)
+	var sinSigma, cosSigma, cos2SigmaM float64
+	for i := 0; i < vincentyMaxIterations; i++ {
+		cos2SigmaM = math.Cos(2*sigma1 + sigma)
+		sinSigma, cosSigma = math.Sin(sigma), math.Cos(sigma)
+		deltaSigma := vincentyDeltaSigma(B, sinSigma, cosSigma, cos2SigmaM)
+
+		previous := sigma
+		sigma = s/(semiMinor*A) + deltaSigma
+		if math.Abs(sigma-previous) < vincentyTolerance {
+			break
+		}
+	}
+	sinSigma, cosSigma = math.Sin(sigma), math.Cos(sigma)
+	cos2SigmaM = math.Cos(2*sigma1 + sigma)
+
+	x := sinU1*sinSigma - cosU1*cosSigma*cosAlpha1
+	lat2 := math.Atan2(sinU1*cosSigma+cosU1*sinSigma*cosAlpha1, (1-f)*math.Hypot(sinAlpha, x))
+	lambda := math.Atan2(sinSigma*sinAlpha1, cosU1*cosSigma-sinU1*sinSigma*cosAlpha1)
+	C := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+	L := lambda - (1-C)*f*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+	alpha2 := math.Atan2(sinAlpha, -x)
+
+	end := Point{Lat: degrees(lat2), Lon: normalizeLongitude(start.Lon + degrees(L))}
+	return end, normalizeBearing(degrees(alpha2))
+}
+
+// vincentyCoefficients returns Vincenty's A and B series coefficients
+func vincentyCoefficients(uSq float64) (float64, float64) {
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	return A, B
+}
+
+// vincentyDeltaSigma returns Vincenty's correction to the spherical arc
+func vincentyDeltaSigma(B, sinSigma, cosSigma, cos2SigmaM float64) float64 {
+	return B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+}
@@ -68,6 +68,7 @@ test_chaincode_packaging() {
     # Check if package exists or create it
     if [ ! -f "geo-asset.tar.gz" ]; then
         print_status "Creating chaincode package..."
+        (cd chaincode && go mod vendor)
         peer lifecycle chaincode package geo-asset.tar.gz \
             --path ./chaincode \
             --lang golang \
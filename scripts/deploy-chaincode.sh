@@ -125,6 +125,9 @@ package_chaincode() {
         go mod init geo-asset-chaincode
     fi
     go mod tidy
+    # Vendor dependencies so the shared geodesy module, which is replaced
+    # with ../geodesy, is packaged with the chaincode
+    go mod vendor
     cd ..
     
     # Package chaincode
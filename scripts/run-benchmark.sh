@@ -82,6 +82,7 @@ install_chaincode() {
     
     # Package chaincode
     if [ ! -f "geo-asset.tar.gz" ]; then
+        (cd chaincode && go mod vendor)
         ./bin/peer lifecycle chaincode package geo-asset.tar.gz --path ./chaincode --lang golang --label geo-asset_1.0
         print_status "Chaincode packaged."
     fi